@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/sirupsen/logrus"
@@ -8,9 +9,16 @@ import (
 	"gorm.io/gorm/logger"
 	"log"
 	"os"
+	"time"
 	"tx55/pkg/configurations"
 	"tx55/pkg/konamiserver"
 	"tx55/pkg/metalgearonline1"
+	"tx55/pkg/metalgearonline1/achievements"
+	"tx55/pkg/metalgearonline1/anomaly"
+	"tx55/pkg/metalgearonline1/control"
+	"tx55/pkg/metalgearonline1/outbox"
+	"tx55/pkg/metalgearonline1/rating"
+	"tx55/pkg/metalgearonline1/session"
 	"tx55/pkg/metalgearonline1/types"
 	// Handlers need to be imported to be registered
 	// annoying, but it allows for easy swapping out and testing
@@ -57,6 +65,36 @@ func main() {
 		Db:      db,
 		LobbyID: types.LobbyID(serverConfig.LobbyID),
 		Log:     l,
+
+		CommandInterval: time.Duration(serverConfig.CommandPollSeconds) * time.Second,
+	}
+
+	anomaly.Configure(serverConfig.StatsAnomaly)
+	if serverConfig.StatsAnomaly.Disabled {
+		l.Info("Stats anomaly rules are disabled, all host reported stats will be applied")
+	}
+
+	rating.Configure(serverConfig.VsRating)
+
+	if err := achievements.Configure(serverConfig.Achievements); err != nil {
+		l.WithError(err).Fatal("Invalid achievements config")
+		return
+	}
+
+	if err := session.Configure(serverConfig.Sessions); err != nil {
+		l.WithError(err).Fatal("Invalid sessions config")
+		return
+	}
+
+	if endpoint, found := os.LookupEnv("EVENTS_ENDPOINT"); found {
+		serverConfig.Events.Subscribers = append(serverConfig.Events.Subscribers, configurations.EventSubscriber{
+			Name: "default",
+			URL:  endpoint,
+		})
+	}
+	outbox.Configure(serverConfig.Events)
+	if !outbox.Enabled() {
+		l.Info("No event subscribers configured, events will not be broadcast to external services")
 	}
 
 	server := metalgearonline1.NewGameServer(cfg)
@@ -76,14 +114,27 @@ func main() {
 		server.KonamiServer.AddHook(uint16(types.ServerHostInfo), konamiserver.HookOutputPacket, hookConnectionInfo)
 	}
 
-	l.WithField("address", cfg.Address).Info("Starting server")
-	if endpoint, found := os.LookupEnv("EVENTS_ENDPOINT"); !found {
-		l.Info("EVENTS_ENDPOINT not set, events will not be broadcast to external service")
-	} else {
-		l.WithField("events_endpoint", endpoint).Info("Sending events to external service")
+	if serverConfig.Control.Address != "" {
+		controlServer, err := control.NewServer(serverConfig.Control, server, server.KonamiServer, l)
+		if err != nil {
+			l.WithError(err).Fatal("Unable to create control api")
+			return
+		}
+		go func() {
+			l.WithField("address", controlServer.Address).Info("Starting control api")
+			if err := controlServer.Listen(); err != nil {
+				l.WithError(err).Error("Control api stopped")
+			}
+		}()
 	}
 
+	l.WithField("address", cfg.Address).Info("Starting server")
+
 	if err := server.Start(); err != nil {
+		if errors.Is(err, metalgearonline1.ErrShutdown) {
+			l.Info("Server shut down")
+			return
+		}
 		panic(err)
 	}
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/swaggo/gin-swagger"
 	"tx55/cmd/restserver/docs"
 	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/achievements"
 	"tx55/pkg/restapi"
 	_ "tx55/pkg/restapi/admin"
 	"tx55/pkg/restapi/crons"
@@ -74,6 +75,11 @@ func main() {
 		return
 	}
 
+	if err := achievements.Configure(config.Achievements); err != nil {
+		l.WithError(err).Fatal("Invalid achievements config")
+		return
+	}
+
 	if *shouldMigrate {
 		l.Info("Running database migrations")
 		migrate(config)
@@ -89,8 +95,16 @@ func main() {
 	}
 
 	if config.RunCronJobs {
+		adminDB, err := config.AdminDatabase.Open(&gorm.Config{
+			Logger: logger.New(log.New(os.Stdout, "\r\n", 0), config.AdminDatabase.LogConfig.LoggerConfig()),
+		})
+		if err != nil {
+			l.WithError(err).Error("Unable to open admin database")
+			return
+		}
+
 		scheduler := gocron.NewScheduler(time.UTC)
-		if err = crons.Schedule(scheduler, db); err != nil {
+		if err = crons.Schedule(scheduler, db, adminDB, config); err != nil {
 			l.WithError(err).Error("Unable to schedule crons")
 			return
 		} else {
@@ -12,6 +12,97 @@ type MetalGearOnline1 struct {
 	LobbyID  uint
 	Database DatabaseConfig
 	LogLevel LogLevelOptions
+	// StatsAnomaly configures the rules used to quarantine suspicious host-reported stats
+	StatsAnomaly StatsAnomalyConfig
+	// VsRating configures the server-side VS rating calculation
+	VsRating VsRatingConfig
+	// Achievements replace the built-in achievements, they must match the Achievements of the restapi. Leave it empty
+	// to keep the built-in ones.
+	Achievements []AchievementConfig
+	// CommandPollSeconds is how often the server checks for commands from the admin API, such as new bans to
+	// enforce on connected players. Defaults to 5 seconds.
+	CommandPollSeconds int
+	// Control is the operator API for inspecting and managing the running server, it is off unless an address is set
+	Control ControlConfig
+	// Events configures delivering game events to the restapi and other webhooks
+	Events EventsConfig
+	// Sessions configures what happens when a user logs in while they are already connected to a game lobby
+	Sessions SessionsConfig
+}
+
+// SessionsConfig is shared by every lobby through the database, so a user logged into one lobby is seen by the
+// others. Only sessions in game lobbies count, the gate and account lobbies are just steps of logging in.
+type SessionsConfig struct {
+	// DuplicateLogin is "takeover" (the default) to disconnect the old session, closing any game it was hosting,
+	// "reject" to refuse the new login, or "allow" to let the user be logged in more than once
+	DuplicateLogin DuplicateLoginPolicy
+	// StaleSeconds is how long a lobby can go without marking its sessions alive before they no longer count, so
+	// the sessions of a lobby that crashed don't lock their users out. Defaults to 180.
+	StaleSeconds int
+	// LifetimeDays is how long the session id the game gets on login can go unused before it expires, every use
+	// extends it. Defaults to 14.
+	LifetimeDays int
+}
+
+type DuplicateLoginPolicy string
+
+const (
+	DuplicateLoginTakeover DuplicateLoginPolicy = "takeover"
+	DuplicateLoginReject   DuplicateLoginPolicy = "reject"
+	DuplicateLoginAllow    DuplicateLoginPolicy = "allow"
+)
+
+// EventsConfig lists where game events are delivered. Events are queued in the database and retried until each
+// subscriber accepts them, the events of a game are always delivered in order. Setting the EVENTS_ENDPOINT
+// environment variable adds an unsigned subscriber named "default".
+type EventsConfig struct {
+	Subscribers []EventSubscriber
+	// MaxAttempts is how many times delivery is tried before the event is skipped, defaults to 12
+	MaxAttempts int
+	// RetentionDays is how long delivered events are kept, defaults to 7
+	RetentionDays int
+}
+
+type EventSubscriber struct {
+	// Name identifies the subscriber's deliveries, changing it starts the subscriber from the next new event
+	Name string
+	// URL is posted every event as JSON, a 2xx response is a successful delivery
+	URL string
+	// Secret signs each delivery, the X-Event-Signature header is "sha256=" followed by the hex HMAC-SHA256 of the
+	// X-Event-Timestamp header, a "." and the body. Deliveries aren't signed without a secret.
+	Secret string
+	// TimeoutSeconds defaults to 10
+	TimeoutSeconds int
+}
+
+type ControlConfig struct {
+	// Address is either a TCP address like 127.0.0.1:8110 or a unix socket like unix:/run/mgo/lobby.sock
+	Address string
+	// Token must be sent in the X-CONTROL-TOKEN header of every request
+	Token string
+}
+
+// VsRatingConfig tunes the server computed VS rating. Which rating is authoritative is an admin setting stored in the
+// database so it can be changed without restarting every lobby.
+type VsRatingConfig struct {
+	// KFactor is the maximum rating change in a single round, defaults to 32
+	KFactor float64
+	// DiscrepancyThreshold is how far the host-reported rating can be from the server rating before it is flagged
+	DiscrepancyThreshold uint
+}
+
+// StatsAnomalyConfig tunes the anomaly rules run against host-reported stats. Any zero values fallback to defaults.
+type StatsAnomalyConfig struct {
+	// Disabled turns off the anomaly rules entirely, stats are applied as soon as they are reported
+	Disabled bool
+	// MaxKillsPerMinute is the highest kill rate accepted relative to the reported play time
+	MaxKillsPerMinute float64
+	// MaxPointsPerMinute is keyed by the short mode name (dm, tdm, res, cap, sne)
+	MaxPointsPerMinute map[string]float64
+	// RepeatThreshold is the number of quarantined submissions a host can make for the same player within
+	// RepeatWindowDays before every submission from that host for that player is quarantined
+	RepeatThreshold  int
+	RepeatWindowDays int
 }
 
 func LoadTOML(filename string, v interface{}) error {
@@ -19,8 +19,23 @@ type RestAPI struct {
 	SessionSecret string
 	// Events is the configuration for the events websocket and reporting endpoints
 	Events RestAPIEvents
+	// Names configures the checks on the usernames, display names and passwords players choose
+	Names RestAPINames
 	// RunCronJobs triggers whether the scheduled jobs like rank updates run
 	RunCronJobs bool
+	// Seasons configures how the stats archives are rolled up when the cron jobs are running
+	Seasons RestAPISeasons
+	// Population configures the snapshots of the lobbies taken for the /population endpoints when the cron jobs are
+	// running
+	Population RestAPIPopulation
+	// Awards are the emblems handed out each week when the weekly stats are cleared. Leaving it empty keeps the
+	// single "Champion" emblem for the weekly points leader.
+	Awards []AwardConfig
+	// Achievements replace the built-in achievements, they must match the Achievements of every gameserver. Leave it
+	// empty to keep the built-in ones.
+	Achievements []AchievementConfig
+	// Gameservers are the control APIs of the lobbies that admins can manage through the /admin/lobbies endpoints
+	Gameservers []GameserverControl
 	// AllowedCredentialOrigins is a list of origins that are allowed to fully interact with the API, including proving the X-API-TOKEN header, and using cookies for logged in sessions.
 	AllowedCredentialOrigins []string
 	// AllowedOrigins is less privileged than the Credential origins. These origins can read responses but not send custom headers or cookies. If you want to allow all origins use a single entry of `*`.
@@ -33,4 +48,91 @@ type RestAPIEvents struct {
 	Enabled bool
 	// AccessTokens are unique strings that game lobbies use as the :token parameter when posting events
 	AccessTokens []string
+	// ReplaySize is how many recent events are kept for clients that ask for a replay when they connect, defaults to
+	// 1000
+	ReplaySize int
+	// QueueSize is how many messages can wait to be sent to a single client, defaults to 256. A replay takes up a
+	// single message.
+	QueueSize int
+	// WriteTimeoutSeconds is how long a write to a client may take before the client is disconnected, defaults to 10
+	WriteTimeoutSeconds int
+	// SlowConsumer is what happens to a client whose queue is full: "disconnect" (the default) closes the connection so
+	// the client can reconnect and replay what it missed, "drop" discards the event
+	SlowConsumer SlowConsumerPolicy
+	// HistoryRetentionDays is how long received events are kept for the /events history endpoint, defaults to 30. Set
+	// it to -1 to keep them forever.
+	HistoryRetentionDays int
+}
+
+type SlowConsumerPolicy string
+
+const (
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"
+	SlowConsumerDrop       SlowConsumerPolicy = "drop"
+)
+
+type RestAPINames struct {
+	// ReservedWords can't be used as a whole username or display name, ignoring case, spacing, accents and leetspeak.
+	// Leave empty to reserve the staff and server names like "admin" and "moderator".
+	ReservedWords []string
+	// BlockedWords can't appear anywhere in a username or display name, with the same folding as ReservedWords
+	BlockedWords []string
+	// RegistrationsPerIP is how many accounts an address can register within RegistrationWindowHours, defaults to 3.
+	// Set it to -1 to turn the limit off.
+	RegistrationsPerIP int
+	// RegistrationWindowHours defaults to 24
+	RegistrationWindowHours int
+}
+
+type RestAPISeasons struct {
+	// Length is how often a longer season is archived in addition to the weekly ones, either "monthly" or
+	// "quarterly". The longer seasons are made up of the weekly seasons that ended within them. Leave empty to only
+	// keep weekly seasons.
+	Length string
+}
+
+type RestAPIPopulation struct {
+	// SampleMinutes is how often the players and games of each lobby are sampled, defaults to 5. Set it to -1 to stop
+	// sampling.
+	SampleMinutes int
+	// RetentionDays is how long the samples are kept, defaults to 365. Set it to -1 to keep them forever.
+	RetentionDays int
+}
+
+type AwardConfig struct {
+	// Name identifies the award in the award history, it must be unique and should not be changed once used
+	Name string
+	// EmblemText is the emblem shown in-game while the award is held, limited to 16 characters
+	EmblemText string
+	// Criteria is one of "top_rank", "most_headshots", "most_kerotans_placed" or "vs_rating_leader". All but the VS
+	// rating leader are judged on the weekly stats.
+	Criteria string
+	// Mode limits the weekly stats criteria to a single game mode like "cap" or "tdm". Empty uses every mode.
+	Mode string
+	// Count is how many players receive the award, defaults to 1
+	Count int
+	// Days is how long the award is held before the previous emblem is restored, defaults to 7
+	Days int
+	// AllowRepeat lets the holders of the award win it again straight away
+	AllowRepeat bool
+}
+
+type AchievementConfig struct {
+	// Key is stored with every unlock, it must be unique and should not be changed once used
+	Key         string
+	Name        string
+	Description string
+	// Stat is the all-time stat counted towards the threshold, like "kills", "head_shots" or "play_time" (in seconds)
+	Stat string
+	// Mode limits the stat to a single game mode like "cap" or "tdm". Empty counts every mode.
+	Mode      string
+	Threshold uint64
+}
+
+type GameserverControl struct {
+	// LobbyID is the lobby the gameserver was configured with
+	LobbyID uint
+	// Address and Token match the Control section of the gameserver's config
+	Address string
+	Token   string
 }
@@ -0,0 +1,269 @@
+// Package events is the schema of the events the gameservers and the restapi publish. Producers build one of the
+// event structs and wrap it in an Envelope, consumers use Decode to get the typed event back.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version is bumped whenever a change to the schema could break an existing consumer, adding events or fields
+// doesn't change it
+const Version = 1
+
+type Type string
+
+const (
+	TypeGameCreated      Type = "game_created"
+	TypeGameDeleted      Type = "game_deleted"
+	TypeGameNewRound     Type = "game_new_round"
+	TypeGamePlayerJoined Type = "game_player_joined"
+	TypeGamePlayerLeft   Type = "game_player_left"
+	TypePlayerKicked     Type = "player_kicked"
+	TypeHostQuit         Type = "host_quit"
+	TypeStatsReported    Type = "stats_reported"
+	TypeTeamChange       Type = "team_change"
+	TypeLogin            Type = "login"
+	TypeLogout           Type = "logout"
+	TypeLobbyJoin        Type = "lobby_join"
+	TypeLobbyLeave       Type = "lobby_leave"
+	TypeBanIssued        Type = "ban_issued"
+	TypeNewsPublished    Type = "news_published"
+)
+
+// Event is the data of an event, each type has its own struct
+type Event interface {
+	EventType() Type
+}
+
+// registry creates an empty event of each type for decoding, every type must be listed here
+var registry = map[Type]func() Event{
+	TypeGameCreated:      func() Event { return &GameCreated{} },
+	TypeGameDeleted:      func() Event { return &GameDeleted{} },
+	TypeGameNewRound:     func() Event { return &GameNewRound{} },
+	TypeGamePlayerJoined: func() Event { return &GamePlayerJoined{} },
+	TypeGamePlayerLeft:   func() Event { return &GamePlayerLeft{} },
+	TypePlayerKicked:     func() Event { return &PlayerKicked{} },
+	TypeHostQuit:         func() Event { return &HostQuit{} },
+	TypeStatsReported:    func() Event { return &StatsReported{} },
+	TypeTeamChange:       func() Event { return &TeamChange{} },
+	TypeLogin:            func() Event { return &Login{} },
+	TypeLogout:           func() Event { return &Logout{} },
+	TypeLobbyJoin:        func() Event { return &LobbyJoin{} },
+	TypeLobbyLeave:       func() Event { return &LobbyLeave{} },
+	TypeBanIssued:        func() Event { return &BanIssued{} },
+	TypeNewsPublished:    func() Event { return &NewsPublished{} },
+}
+
+// Envelope is the JSON sent to consumers. GameID and UserID repeat the event's ids, if it has them, so consumers can
+// filter events without knowing every type.
+type Envelope struct {
+	// ID is assigned by whoever stores the event, it increases with every event
+	ID        uint            `json:"id"`
+	Version   int             `json:"version"`
+	Event     Type            `json:"event"`
+	Lobby     uint            `json:"lobby"`
+	GameID    uint            `json:"game_id,omitempty"`
+	UserID    uint            `json:"user_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewEnvelope wraps the event for the lobby, lobby 0 is for events that don't come from a gameserver
+func NewEnvelope(lobby uint, event Event) (Envelope, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		Version:   Version,
+		Event:     event.EventType(),
+		Lobby:     lobby,
+		GameID:    GameIDOf(event),
+		UserID:    UserIDOf(event),
+		CreatedAt: time.Now(),
+		Data:      data,
+	}, nil
+}
+
+// Decode returns the typed event in the envelope's data
+func (e *Envelope) Decode() (Event, error) {
+	if e.Version < 1 || e.Version > Version {
+		return nil, fmt.Errorf("unsupported event version %d", e.Version)
+	}
+	return DecodeData(e.Event, e.Data)
+}
+
+// DecodeData returns the typed event for the data of an event
+func DecodeData(t Type, data []byte) (Event, error) {
+	factory, found := registry[t]
+	if !found {
+		return nil, fmt.Errorf("unknown event type %q", t)
+	}
+	event := factory()
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, fmt.Errorf("invalid %s event: %w", t, err)
+	}
+	return event, nil
+}
+
+// Types lists every event type
+func Types() []Type {
+	out := make([]Type, 0, len(registry))
+	for t := range registry {
+		out = append(out, t)
+	}
+	return out
+}
+
+// Game is embedded in the events about a game
+type Game struct {
+	GameID uint `json:"game_id"`
+}
+
+func (g Game) EventGameID() uint { return g.GameID }
+
+// User is embedded in the events about a player, or in the game events the player that caused them
+type User struct {
+	UserID uint `json:"user_id"`
+}
+
+func (u User) EventUserID() uint { return u.UserID }
+
+// GameIDOf returns the game the event is about, or 0
+func GameIDOf(e Event) uint {
+	if g, ok := e.(interface{ EventGameID() uint }); ok {
+		return g.EventGameID()
+	}
+	return 0
+}
+
+// UserIDOf returns the player the event is about, or 0
+func UserIDOf(e Event) uint {
+	if u, ok := e.(interface{ EventUserID() uint }); ok {
+		return u.EventUserID()
+	}
+	return 0
+}
+
+type Round struct {
+	Map  string `json:"map"`
+	Mode string `json:"mode"`
+}
+
+// GameCreated is sent when a player starts hosting, User is the host
+type GameCreated struct {
+	Game
+	User
+	Name        string  `json:"name"`
+	HasPassword bool    `json:"has_password"`
+	Host        string  `json:"host"`
+	Rules       []Round `json:"rules"`
+}
+
+// GameDeleted is sent when a game closes, whether the host quit or disconnected
+type GameDeleted struct {
+	Game
+}
+
+type GameNewRound struct {
+	Game
+	Round int    `json:"round"`
+	Map   string `json:"map"`
+	Mode  string `json:"mode"`
+}
+
+type GamePlayerJoined struct {
+	Game
+	User
+}
+
+type GamePlayerLeft struct {
+	Game
+	User
+}
+
+// PlayerKicked is sent when the host kicks a player, GamePlayerLeft follows once they've left
+type PlayerKicked struct {
+	Game
+	User
+}
+
+// HostQuit is sent when the host closes the game from the menu, User is the host
+type HostQuit struct {
+	Game
+	User
+}
+
+// StatsReported is sent when the host reports a player's stats for a round. Quarantined stats are held for an admin
+// to review instead of being applied.
+type StatsReported struct {
+	Game
+	User
+	Map         string `json:"map"`
+	Mode        string `json:"mode"`
+	Kills       int32  `json:"kills"`
+	Deaths      int32  `json:"deaths"`
+	Points      int32  `json:"points"`
+	Quarantined bool   `json:"quarantined"`
+}
+
+type TeamChange struct {
+	Game
+	User
+	TeamID uint8 `json:"team_id"`
+	// Team is "Red", "Blue", "Spectator" or "Unknown" for the uniform teams of modes without red and blue
+	Team string `json:"team"`
+}
+
+// Login is sent when a player logs in with their password
+type Login struct {
+	User
+	DisplayName string `json:"display_name"`
+}
+
+// Logout is sent when a logged in player disconnects from a lobby
+type Logout struct {
+	User
+}
+
+// LobbyJoin is sent when a player enters a game lobby
+type LobbyJoin struct {
+	User
+	DisplayName string `json:"display_name"`
+}
+
+// LobbyLeave is sent when a player that entered a game lobby disconnects
+type LobbyLeave struct {
+	User
+}
+
+// BanIssued is sent when an admin creates a ban, User is the banned player if there is one
+type BanIssued struct {
+	User
+	BanID     uint      `json:"ban_id"`
+	Type      string    `json:"type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type NewsPublished struct {
+	NewsID uint   `json:"news_id"`
+	Topic  string `json:"topic"`
+}
+
+func (GameCreated) EventType() Type      { return TypeGameCreated }
+func (GameDeleted) EventType() Type      { return TypeGameDeleted }
+func (GameNewRound) EventType() Type     { return TypeGameNewRound }
+func (GamePlayerJoined) EventType() Type { return TypeGamePlayerJoined }
+func (GamePlayerLeft) EventType() Type   { return TypeGamePlayerLeft }
+func (PlayerKicked) EventType() Type     { return TypePlayerKicked }
+func (HostQuit) EventType() Type         { return TypeHostQuit }
+func (StatsReported) EventType() Type    { return TypeStatsReported }
+func (TeamChange) EventType() Type       { return TypeTeamChange }
+func (Login) EventType() Type            { return TypeLogin }
+func (Logout) EventType() Type           { return TypeLogout }
+func (LobbyJoin) EventType() Type        { return TypeLobbyJoin }
+func (LobbyLeave) EventType() Type       { return TypeLobbyLeave }
+func (BanIssued) EventType() Type        { return TypeBanIssued }
+func (NewsPublished) EventType() Type    { return TypeNewsPublished }
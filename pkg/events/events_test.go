@@ -0,0 +1,57 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	envelope, err := NewEnvelope(2, StatsReported{Game: Game{GameID: 7}, User: User{UserID: 3}, Kills: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.GameID != 7 || envelope.UserID != 3 || envelope.Version != Version {
+		t.Errorf("Expected the envelope to carry the ids and version, got %+v", envelope)
+	}
+
+	bs, _ := json.Marshal(envelope)
+	var decoded Envelope
+	if err = json.Unmarshal(bs, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	event, err := decoded.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats, ok := event.(*StatsReported); !ok || stats.Kills != 5 || stats.UserID != 3 {
+		t.Errorf("Expected the stats to decode, got %#v", event)
+	}
+
+	decoded.Version = Version + 1
+	if _, err = decoded.Decode(); err == nil {
+		t.Error("Expected a newer version to be rejected")
+	}
+	decoded.Version, decoded.Event = Version, "unknown"
+	if _, err = decoded.Decode(); err == nil {
+		t.Error("Expected an unknown type to be rejected")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	defs := Schema()["$defs"].(map[string]any)
+	for _, eventType := range Types() {
+		if event := registry[eventType](); event.EventType() != eventType {
+			t.Errorf("Expected %s to create a %s event, got %s", eventType, eventType, event.EventType())
+		}
+		if _, found := defs[string(eventType)]; !found {
+			t.Errorf("Expected %s in the schema", eventType)
+		}
+	}
+
+	properties := defs[string(TypeGameCreated)].(map[string]any)["properties"].(map[string]any)
+	for _, field := range []string{"game_id", "user_id", "rules"} {
+		if _, found := properties[field]; !found {
+			t.Errorf("Expected %s in the game_created schema", field)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema (draft 2020-12) of the Envelope, with the data of each event type in $defs
+func Schema() map[string]any {
+	defs := map[string]any{}
+	var variants []any
+	for _, t := range sortedTypes() {
+		name := string(t)
+		defs[name] = typeSchema(reflect.TypeOf(registry[t]()).Elem())
+		variants = append(variants, map[string]any{
+			"properties": map[string]any{
+				"event": map[string]any{"const": name},
+				"data":  map[string]any{"$ref": "#/$defs/" + name},
+			},
+		})
+	}
+
+	envelope := typeSchema(reflect.TypeOf(Envelope{}))
+	properties := envelope["properties"].(map[string]any)
+	properties["version"] = map[string]any{"const": Version}
+	events := make([]string, 0, len(registry))
+	for _, t := range sortedTypes() {
+		events = append(events, string(t))
+	}
+	properties["event"] = map[string]any{"type": "string", "enum": events}
+	properties["data"] = map[string]any{"type": "object"}
+
+	envelope["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	envelope["title"] = "Event"
+	envelope["oneOf"] = variants
+	envelope["$defs"] = defs
+	return envelope
+}
+
+func sortedTypes() []Type {
+	types := Types()
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func typeSchema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		addFields(t, properties, &required)
+		sort.Strings(required)
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": true,
+		}
+	default:
+		return map[string]any{}
+	}
+}
+
+// addFields adds the struct's fields the way encoding/json would, embedded structs without a tag are flattened
+func addFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			addFields(field.Type, properties, required)
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
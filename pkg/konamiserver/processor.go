@@ -192,13 +192,14 @@ const PacketIn PacketDirection = true
 const PacketOut PacketDirection = false
 
 func (c *client) dumpPacket(direction PacketDirection, p *packet.Packet) {
-	if !c.server.Debug {
+	debug, debugPackets := c.server.DebugSettings()
+	if !debug {
 		return
 	}
 
-	if len(c.server.DebugPackets) > 0 {
+	if len(debugPackets) > 0 {
 		found := false
-		for _, v := range c.server.DebugPackets {
+		for _, v := range debugPackets {
 			if v == (*p).Type() {
 				found = true
 				break
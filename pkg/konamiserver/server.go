@@ -3,6 +3,7 @@ package konamiserver
 import (
 	"github.com/sirupsen/logrus"
 	"net"
+	"sync"
 )
 
 type Config struct {
@@ -22,6 +23,8 @@ type Server struct {
 	Debug        bool
 	DebugPackets []uint16
 	Log          logrus.FieldLogger
+	// debugLock guards Debug and DebugPackets once the server is running
+	debugLock sync.RWMutex
 }
 
 // Start will start the server and block until the server is stopped
@@ -39,6 +42,21 @@ func (s *Server) Stop() {
 	_ = s.listener.Close()
 }
 
+// SetDebug changes the packet tracing options while the server is running. An empty packets list traces every
+// packet type. The packets slice is kept, so it must not be changed afterwards.
+func (s *Server) SetDebug(enabled bool, packets []uint16) {
+	s.debugLock.Lock()
+	defer s.debugLock.Unlock()
+	s.Debug = enabled
+	s.DebugPackets = packets
+}
+
+func (s *Server) DebugSettings() (enabled bool, packets []uint16) {
+	s.debugLock.RLock()
+	defer s.debugLock.RUnlock()
+	return s.Debug, s.DebugPackets
+}
+
 func NewServer(config Config) *Server {
 	return &Server{
 		clients:     make(map[string]*client),
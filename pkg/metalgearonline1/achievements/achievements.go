@@ -0,0 +1,235 @@
+package achievements
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+// Achievement is a milestone unlocked once a user's all-time total of a stat reaches the threshold
+type Achievement struct {
+	// Key is stored in user_achievements so must never change once released
+	Key         string
+	Name        string
+	Description string
+	// Stat is one of the keys of StatValues
+	Stat string
+	// Mode limits the stat to a single game mode, ModeOverall counts every mode
+	Mode      types.GameMode
+	Threshold uint64
+}
+
+// StatValues reads a single stat out of the totals. Streaks are the best streak, everything else is summed.
+var StatValues = map[string]func(s types.HostReportedStats) uint64{
+	"kills":               func(s types.HostReportedStats) uint64 { return positive(s.Kills) },
+	"points":              func(s types.HostReportedStats) uint64 { return positive(s.Points) },
+	"kill_streak":         func(s types.HostReportedStats) uint64 { return uint64(s.KillStreak) },
+	"stuns":               func(s types.HostReportedStats) uint64 { return uint64(s.Stuns) },
+	"snake_frags":         func(s types.HostReportedStats) uint64 { return uint64(s.SnakeFrags) },
+	"rounds_played":       func(s types.HostReportedStats) uint64 { return uint64(s.RoundsPlayed) },
+	"rounds_no_death":     func(s types.HostReportedStats) uint64 { return uint64(s.RoundsNoDeath) },
+	"kerotans_for_win":    func(s types.HostReportedStats) uint64 { return uint64(s.KerotansForWin) },
+	"kerotans_placed":     func(s types.HostReportedStats) uint64 { return uint64(s.KerotansPlaced) },
+	"cqc_attacks":         func(s types.HostReportedStats) uint64 { return uint64(s.CQCAttacks) },
+	"head_shots":          func(s types.HostReportedStats) uint64 { return uint64(s.HeadShots) },
+	"team_wins":           func(s types.HostReportedStats) uint64 { return uint64(s.TeamWins) },
+	"kills_with_scorpion": func(s types.HostReportedStats) uint64 { return uint64(s.KillsWithScorpion) },
+	"kills_with_knife":    func(s types.HostReportedStats) uint64 { return uint64(s.KillsWithKnife) },
+	"times_eaten":         func(s types.HostReportedStats) uint64 { return uint64(s.TimesEaten) },
+	"rolls":               func(s types.HostReportedStats) uint64 { return uint64(s.Rolls) },
+	"play_time":           func(s types.HostReportedStats) uint64 { return uint64(s.PlayTime) },
+}
+
+func positive(v int32) uint64 {
+	if v < 0 {
+		return 0
+	}
+	return uint64(v)
+}
+
+// All is every achievement that can be unlocked, see Configure
+var All = Default
+
+// Default are the achievements used when none are configured
+var Default = []Achievement{
+	{Key: "first_blood", Name: "First Blood", Description: "Get your first kill", Stat: "kills", Mode: types.ModeOverall, Threshold: 1},
+	{Key: "kills_100", Name: "Soldier", Description: "Get 100 kills", Stat: "kills", Mode: types.ModeOverall, Threshold: 100},
+	{Key: "kills_1000", Name: "Veteran Soldier", Description: "Get 1,000 kills", Stat: "kills", Mode: types.ModeOverall, Threshold: 1000},
+	{Key: "kills_10000", Name: "Legendary Soldier", Description: "Get 10,000 kills", Stat: "kills", Mode: types.ModeOverall, Threshold: 10000},
+	{Key: "kill_streak_10", Name: "Unstoppable", Description: "Get a 10 kill streak", Stat: "kill_streak", Mode: types.ModeOverall, Threshold: 10},
+	{Key: "head_shots_500", Name: "Head Hunter", Description: "Land 500 head shots", Stat: "head_shots", Mode: types.ModeOverall, Threshold: 500},
+	{Key: "cqc_250", Name: "CQC Expert", Description: "Perform 250 CQC attacks", Stat: "cqc_attacks", Mode: types.ModeOverall, Threshold: 250},
+	{Key: "knife_100", Name: "Knife Master", Description: "Get 100 kills with the knife", Stat: "kills_with_knife", Mode: types.ModeOverall, Threshold: 100},
+	{Key: "scorpion_250", Name: "Scorpion Sting", Description: "Get 250 kills with the Scorpion", Stat: "kills_with_scorpion", Mode: types.ModeOverall, Threshold: 250},
+	{Key: "snake_frags_25", Name: "Snake Hunter", Description: "Take down Snake 25 times", Stat: "snake_frags", Mode: types.ModeOverall, Threshold: 25},
+	{Key: "kerotans_placed_25", Name: "Frog Collector", Description: "Collect 25 Kerotans as Snake", Stat: "kerotans_placed", Mode: types.ModeSneaking, Threshold: 25},
+	{Key: "gakos_50", Name: "Gako Rescuer", Description: "Rescue the Gako 50 times", Stat: "kerotans_for_win", Mode: types.ModeRescue, Threshold: 50},
+	{Key: "times_eaten_10", Name: "Snack Time", Description: "Get eaten 10 times", Stat: "times_eaten", Mode: types.ModeOverall, Threshold: 10},
+	{Key: "rolls_1000", Name: "Rolling Thunder", Description: "Roll 1,000 times", Stat: "rolls", Mode: types.ModeOverall, Threshold: 1000},
+	{Key: "rounds_no_death_100", Name: "Untouchable", Description: "Survive 100 rounds without dying", Stat: "rounds_no_death", Mode: types.ModeOverall, Threshold: 100},
+	{Key: "rounds_1000", Name: "Regular", Description: "Play 1,000 rounds", Stat: "rounds_played", Mode: types.ModeOverall, Threshold: 1000},
+	{Key: "team_wins_250", Name: "Team Player", Description: "Win 250 team rounds", Stat: "team_wins", Mode: types.ModeOverall, Threshold: 250},
+	{Key: "dm_points_10000", Name: "Deathmatch Specialist", Description: "Score 10,000 points in Deathmatch", Stat: "points", Mode: types.ModeDeathmatch, Threshold: 10000},
+	{Key: "play_time_100h", Name: "Dedicated", Description: "Play for 100 hours", Stat: "play_time", Mode: types.ModeOverall, Threshold: 100 * 60 * 60},
+}
+
+// Configure replaces the achievements with the configured ones, an empty config keeps the defaults
+func Configure(configs []configurations.AchievementConfig) error {
+	if len(configs) == 0 {
+		All = Default
+		return nil
+	}
+
+	configured := make([]Achievement, len(configs))
+	keys := map[string]bool{}
+	for i, cfg := range configs {
+		a := Achievement{
+			Key:         cfg.Key,
+			Name:        cfg.Name,
+			Description: cfg.Description,
+			Stat:        cfg.Stat,
+			Mode:        types.ModeOverall,
+			Threshold:   cfg.Threshold,
+		}
+		if cfg.Mode != "" {
+			a.Mode = types.GameModeString(cfg.Mode).GameMode()
+		}
+		if err := a.validate(); err != nil {
+			return err
+		}
+		if keys[a.Key] {
+			return fmt.Errorf("achievement %q is defined more than once", a.Key)
+		}
+		keys[a.Key] = true
+		configured[i] = a
+	}
+	All = configured
+	return nil
+}
+
+// validate checks an achievement can be stored and unlocked, the notification title is limited to 64 characters
+func (a Achievement) validate() error {
+	if a.Key == "" || a.Name == "" {
+		return errors.New("achievement is missing a key or name")
+	}
+	if len(a.Key) > 64 || len("Achievement: "+a.Name) > 64 {
+		return fmt.Errorf("achievement %q key or name is too long", a.Key)
+	}
+	if _, found := StatValues[a.Stat]; !found {
+		return fmt.Errorf("achievement %q has unknown stat %q", a.Key, a.Stat)
+	}
+	if a.Mode == types.ModeInvalid {
+		return fmt.Errorf("achievement %q has an unknown mode", a.Key)
+	}
+	if a.Threshold == 0 {
+		return fmt.Errorf("achievement %q has no threshold", a.Key)
+	}
+	return nil
+}
+
+// Find returns the achievement with the given key
+func Find(key string) (Achievement, bool) {
+	for _, a := range All {
+		if a.Key == key {
+			return a, true
+		}
+	}
+	return Achievement{}, false
+}
+
+// Progress is how close a user is to unlocking an achievement
+type Progress struct {
+	Achievement
+	Value      uint64
+	Unlocked   bool
+	UnlockedAt time.Time
+}
+
+// Totals sums the stats for each mode, ModeOverall holds the sum of every mode
+func Totals(stats []models.PlayerStats) map[types.GameMode]types.HostReportedStats {
+	out := map[types.GameMode]types.HostReportedStats{}
+	for _, s := range stats {
+		reported := s.ToHostReportedStats()
+		for _, mode := range []types.GameMode{s.Mode, types.ModeOverall} {
+			total := out[mode]
+			total.AddStats(reported)
+			out[mode] = total
+		}
+	}
+	return out
+}
+
+// Value is the user's current value for the achievement's stat
+func (a Achievement) Value(totals map[types.GameMode]types.HostReportedStats) uint64 {
+	value, found := StatValues[a.Stat]
+	if !found {
+		return 0
+	}
+	return value(totals[a.Mode])
+}
+
+// UserProgress returns the progress of every achievement for the user
+func UserProgress(db *gorm.DB, userID uint) ([]Progress, error) {
+	var stats []models.PlayerStats
+	if err := db.Where("user_id = ? AND period = ?", userID, types.PeriodAllTime).Find(&stats).Error; err != nil {
+		return nil, err
+	}
+
+	var unlocked []models.UserAchievement
+	if err := db.Where("user_id = ?", userID).Find(&unlocked).Error; err != nil {
+		return nil, err
+	}
+	unlockedAt := map[string]time.Time{}
+	for _, u := range unlocked {
+		unlockedAt[u.Achievement] = u.CreatedAt
+	}
+
+	totals := Totals(stats)
+	out := make([]Progress, len(All))
+	for i, a := range All {
+		out[i] = Progress{Achievement: a, Value: a.Value(totals)}
+		out[i].UnlockedAt, out[i].Unlocked = unlockedAt[a.Key]
+	}
+	return out, nil
+}
+
+// Evaluate unlocks any achievements the user has reached but not been given yet, and lets them know in-game with a
+// notification
+func Evaluate(db *gorm.DB, userID uint) (unlocked []Achievement, err error) {
+	progress, err := UserProgress(db, userID)
+	if err != nil {
+		return
+	}
+
+	for _, p := range progress {
+		if p.Unlocked || p.Value < p.Threshold {
+			continue
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Stats for a user can be reported by more than one game at once, only the first unlock counts
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UserAchievement{
+				UserID:      userID,
+				Achievement: p.Key,
+			})
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			unlocked = append(unlocked, p.Achievement)
+			return tx.Create(&models.Notification{
+				UserID: userID,
+				Title:  "Achievement: " + p.Name,
+				Body:   fmt.Sprintf("Achievement unlocked! %s: %s.", p.Name, p.Description),
+			}).Error
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package achievements
+
+import (
+	"testing"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+func TestDefinitions(t *testing.T) {
+	keys := map[string]bool{}
+	for _, a := range Default {
+		if keys[a.Key] {
+			t.Errorf("Duplicate achievement key %s", a.Key)
+		}
+		keys[a.Key] = true
+		if err := a.validate(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer Configure(nil)
+
+	err := Configure([]configurations.AchievementConfig{
+		{Key: "cap_kills_50", Name: "Flag Defender", Description: "Get 50 kills in Capture", Stat: "kills", Mode: "cap", Threshold: 50},
+		{Key: "rolls_10", Name: "Roller", Description: "Roll 10 times", Stat: "rolls", Threshold: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(All) != 2 || All[0].Mode != types.ModeCapture || All[1].Mode != types.ModeOverall {
+		t.Errorf("Expected the configured achievements, got %+v", All)
+	}
+
+	invalid := [][]configurations.AchievementConfig{
+		{{Key: "a", Name: "A", Stat: "kills", Threshold: 1}, {Key: "a", Name: "B", Stat: "kills", Threshold: 1}},
+		{{Key: "a", Name: "A", Stat: "unknown", Threshold: 1}},
+		{{Key: "a", Name: "A", Stat: "kills", Mode: "unknown", Threshold: 1}},
+		{{Key: "a", Name: "A", Stat: "kills"}},
+		{{Name: "A", Stat: "kills", Threshold: 1}},
+	}
+	for _, configs := range invalid {
+		if err = Configure(configs); err == nil {
+			t.Errorf("Expected %+v to be rejected", configs)
+		}
+	}
+
+	if err = Configure(nil); err != nil || len(All) != len(Default) {
+		t.Errorf("Expected an empty config to use the defaults")
+	}
+}
+
+func TestTotals(t *testing.T) {
+	stats := []models.PlayerStats{
+		{Mode: types.ModeDeathmatch, Map: types.MapLostForest, Kills: 3, KillStreak: 2, Points: 10},
+		{Mode: types.ModeDeathmatch, Map: types.MapGhostFactory, Kills: 4, KillStreak: 5, Points: -20},
+		{Mode: types.ModeSneaking, Map: types.MapGhostFactory, Kills: 1, KerotansPlaced: 2},
+	}
+	totals := Totals(stats)
+
+	kills := Achievement{Stat: "kills", Mode: types.ModeOverall}
+	if v := kills.Value(totals); v != 8 {
+		t.Errorf("Expected 8 overall kills, got %d", v)
+	}
+	kills.Mode = types.ModeSneaking
+	if v := kills.Value(totals); v != 1 {
+		t.Errorf("Expected 1 sneaking kill, got %d", v)
+	}
+
+	streak := Achievement{Stat: "kill_streak", Mode: types.ModeOverall}
+	if v := streak.Value(totals); v != 5 {
+		t.Errorf("Expected the best streak of 5, got %d", v)
+	}
+
+	points := Achievement{Stat: "points", Mode: types.ModeDeathmatch}
+	if v := points.Value(totals); v != 0 {
+		t.Errorf("Expected negative points to count as 0, got %d", v)
+	}
+}
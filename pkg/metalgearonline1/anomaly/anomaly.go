@@ -0,0 +1,97 @@
+package anomaly
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+// Submission is a single host-reported stats entry along with the game context needed to judge it
+type Submission struct {
+	HostID uint
+	UserID uint
+	GameID uint
+	Rules  types.GameRules
+	Stats  types.HostReportedStats
+}
+
+// Violation describes why a rule flagged a submission
+type Violation struct {
+	Rule   string
+	Reason string
+}
+
+// Rule is a single check run against host-reported stats before they are applied. Rules that don't need the
+// database can ignore the db argument.
+type Rule interface {
+	Name() string
+	Check(db *gorm.DB, s *Submission) (flagged bool, reason string)
+}
+
+type Engine struct {
+	Rules []Rule
+}
+
+// Active is the engine used by the gameserver, it can be replaced with Configure
+var Active = NewEngine(configurations.StatsAnomalyConfig{})
+
+// Configure replaces the Active engine with one built from the given config
+func Configure(cfg configurations.StatsAnomalyConfig) {
+	Active = NewEngine(cfg)
+}
+
+func NewEngine(cfg configurations.StatsAnomalyConfig) *Engine {
+	e := &Engine{}
+	if cfg.Disabled {
+		return e
+	}
+
+	killsPerMinute := KillsPerMinute{Limit: cfg.MaxKillsPerMinute}
+	if killsPerMinute.Limit <= 0 {
+		killsPerMinute.Limit = DefaultMaxKillsPerMinute
+	}
+
+	modeConsistency := ModeConsistency{MaxPointsPerMinute: map[types.GameMode]float64{}}
+	for mode, limit := range DefaultMaxPointsPerMinute {
+		modeConsistency.MaxPointsPerMinute[mode] = limit
+	}
+	for name, limit := range cfg.MaxPointsPerMinute {
+		mode := types.GameModeString(strings.ToLower(name)).GameMode()
+		if mode == types.ModeInvalid || limit <= 0 {
+			continue
+		}
+		modeConsistency.MaxPointsPerMinute[mode] = limit
+	}
+
+	repeat := RepeatOffender{Threshold: cfg.RepeatThreshold, Window: time.Duration(cfg.RepeatWindowDays) * 24 * time.Hour}
+	if repeat.Threshold <= 0 {
+		repeat.Threshold = DefaultRepeatThreshold
+	}
+	if repeat.Window <= 0 {
+		repeat.Window = DefaultRepeatWindow
+	}
+
+	e.Rules = []Rule{killsPerMinute, HeadShotsOverKills{}, modeConsistency, repeat}
+	return e
+}
+
+// Evaluate runs every rule against the submission and returns all the violations found
+func (e *Engine) Evaluate(db *gorm.DB, s *Submission) (out []Violation) {
+	for _, rule := range e.Rules {
+		if flagged, reason := rule.Check(db, s); flagged {
+			out = append(out, Violation{Rule: rule.Name(), Reason: reason})
+		}
+	}
+	return
+}
+
+// Reasons joins the violations in the format stored on the quarantine entry
+func Reasons(violations []Violation) string {
+	lines := make([]string, len(violations))
+	for i, v := range violations {
+		lines[i] = v.Rule + ": " + v.Reason
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,107 @@
+package anomaly
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+const DefaultMaxKillsPerMinute = 6.0
+const DefaultRepeatThreshold = 3
+const DefaultRepeatWindow = 30 * 24 * time.Hour
+
+// DefaultMaxPointsPerMinute are intentionally generous, objective modes give out more points than the kill based ones
+var DefaultMaxPointsPerMinute = map[types.GameMode]float64{
+	types.ModeDeathmatch:     10,
+	types.ModeTeamDeathmatch: 10,
+	types.ModeRescue:         20,
+	types.ModeCapture:        20,
+	types.ModeSneaking:       25,
+}
+
+// minutes converts the reported PlayTime (seconds) to minutes, it's never less than one minute so that very short
+// rounds don't produce absurd rates
+func minutes(stats types.HostReportedStats) float64 {
+	m := float64(stats.PlayTime) / 60
+	if m < 1 {
+		return 1
+	}
+	return m
+}
+
+// KillsPerMinute flags kill counts that are too high for the amount of time played
+type KillsPerMinute struct {
+	Limit float64
+}
+
+func (r KillsPerMinute) Name() string { return "kills_per_minute" }
+
+func (r KillsPerMinute) Check(_ *gorm.DB, s *Submission) (bool, string) {
+	rate := float64(s.Stats.Kills) / minutes(s.Stats)
+	if rate > r.Limit {
+		return true, fmt.Sprintf("%d kills in %ds (%.1f/min, limit %.1f)", s.Stats.Kills, s.Stats.PlayTime, rate, r.Limit)
+	}
+	return false, ""
+}
+
+// HeadShotsOverKills flags submissions with more headshots than kills
+type HeadShotsOverKills struct{}
+
+func (r HeadShotsOverKills) Name() string { return "headshots_over_kills" }
+
+func (r HeadShotsOverKills) Check(_ *gorm.DB, s *Submission) (bool, string) {
+	if s.Stats.Kills >= 0 && s.Stats.HeadShots > uint32(s.Stats.Kills) {
+		return true, fmt.Sprintf("%d headshots with only %d kills", s.Stats.HeadShots, s.Stats.Kills)
+	}
+	return false, ""
+}
+
+// ModeConsistency flags points that are too high for the mode, and mode specific stats showing up in other modes
+type ModeConsistency struct {
+	MaxPointsPerMinute map[types.GameMode]float64
+}
+
+func (r ModeConsistency) Name() string { return "mode_consistency" }
+
+func (r ModeConsistency) Check(_ *gorm.DB, s *Submission) (bool, string) {
+	if limit, found := r.MaxPointsPerMinute[s.Rules.Mode]; found {
+		rate := float64(s.Stats.Points) / minutes(s.Stats)
+		if rate > limit {
+			return true, fmt.Sprintf("%d points in %ds (%.1f/min, limit %.1f for %s)", s.Stats.Points, s.Stats.PlayTime, rate, limit, s.Rules.Mode.String())
+		}
+	}
+
+	// Snake only exists in sneaking mode
+	if s.Rules.Mode != types.ModeSneaking && s.Stats.SnakeFrags > 0 {
+		return true, fmt.Sprintf("%d snake frags reported in %s", s.Stats.SnakeFrags, s.Rules.Mode.String())
+	}
+	return false, ""
+}
+
+// RepeatOffender flags every submission from a host for a player once that host has already had several
+// submissions for the same player quarantined
+type RepeatOffender struct {
+	Threshold int
+	Window    time.Duration
+}
+
+func (r RepeatOffender) Name() string { return "repeat_offender" }
+
+func (r RepeatOffender) Check(db *gorm.DB, s *Submission) (bool, string) {
+	if db == nil {
+		return false, ""
+	}
+
+	var count int64
+	q := db.Model(&models.QuarantinedStats{}).Where("host_id = ? AND user_id = ? AND created_at > ?", s.HostID, s.UserID, time.Now().Add(-r.Window))
+	if err := q.Count(&count).Error; err != nil {
+		return false, ""
+	}
+
+	if count >= int64(r.Threshold) {
+		return true, fmt.Sprintf("host %d has %d quarantined submissions for this player", s.HostID, count)
+	}
+	return false, ""
+}
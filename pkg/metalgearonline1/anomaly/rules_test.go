@@ -0,0 +1,102 @@
+package anomaly
+
+import (
+	"testing"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+func TestKillsPerMinute_Check(t *testing.T) {
+	r := KillsPerMinute{Limit: 6}
+
+	s := &Submission{Stats: types.HostReportedStats{Kills: 30, PlayTime: 300}}
+	if flagged, _ := r.Check(nil, s); flagged {
+		t.Errorf("Expected 6 kills/min to be allowed")
+	}
+
+	s.Stats.Kills = 31
+	if flagged, _ := r.Check(nil, s); !flagged {
+		t.Errorf("Expected 6.2 kills/min to be flagged")
+	}
+
+	// Short rounds are treated as a full minute
+	s = &Submission{Stats: types.HostReportedStats{Kills: 5, PlayTime: 10}}
+	if flagged, _ := r.Check(nil, s); flagged {
+		t.Errorf("Expected 5 kills in a short round to be allowed")
+	}
+}
+
+func TestHeadShotsOverKills_Check(t *testing.T) {
+	r := HeadShotsOverKills{}
+
+	s := &Submission{Stats: types.HostReportedStats{Kills: 5, HeadShots: 5}}
+	if flagged, _ := r.Check(nil, s); flagged {
+		t.Errorf("Expected headshots == kills to be allowed")
+	}
+
+	s.Stats.HeadShots = 6
+	if flagged, _ := r.Check(nil, s); !flagged {
+		t.Errorf("Expected headshots > kills to be flagged")
+	}
+}
+
+func TestModeConsistency_Check(t *testing.T) {
+	r := ModeConsistency{MaxPointsPerMinute: map[types.GameMode]float64{types.ModeDeathmatch: 10}}
+
+	s := &Submission{
+		Rules: types.GameRules{Mode: types.ModeDeathmatch},
+		Stats: types.HostReportedStats{Points: 50, PlayTime: 300},
+	}
+	if flagged, _ := r.Check(nil, s); flagged {
+		t.Errorf("Expected 10 points/min to be allowed")
+	}
+
+	s.Stats.Points = 51
+	if flagged, _ := r.Check(nil, s); !flagged {
+		t.Errorf("Expected 10.2 points/min to be flagged")
+	}
+
+	s.Stats.Points = 10
+	s.Stats.SnakeFrags = 1
+	if flagged, _ := r.Check(nil, s); !flagged {
+		t.Errorf("Expected snake frags outside of sneaking to be flagged")
+	}
+
+	s.Rules.Mode = types.ModeSneaking
+	if flagged, _ := r.Check(nil, s); flagged {
+		t.Errorf("Expected snake frags in sneaking to be allowed")
+	}
+}
+
+func TestNewEngine(t *testing.T) {
+	if e := NewEngine(configurations.StatsAnomalyConfig{Disabled: true}); len(e.Rules) != 0 {
+		t.Errorf("Expected a disabled engine to have no rules, got %d", len(e.Rules))
+	}
+
+	e := NewEngine(configurations.StatsAnomalyConfig{
+		MaxPointsPerMinute: map[string]float64{"tdm": 99, "bogus": 1},
+	})
+	for _, rule := range e.Rules {
+		switch r := rule.(type) {
+		case KillsPerMinute:
+			if r.Limit != DefaultMaxKillsPerMinute {
+				t.Errorf("Expected default kill limit, got %f", r.Limit)
+			}
+		case ModeConsistency:
+			if r.MaxPointsPerMinute[types.ModeTeamDeathmatch] != 99 {
+				t.Errorf("Expected tdm limit to be overridden, got %f", r.MaxPointsPerMinute[types.ModeTeamDeathmatch])
+			}
+			if r.MaxPointsPerMinute[types.ModeDeathmatch] != DefaultMaxPointsPerMinute[types.ModeDeathmatch] {
+				t.Errorf("Expected dm limit to be the default")
+			}
+		}
+	}
+
+	violations := e.Evaluate(nil, &Submission{
+		Rules: types.GameRules{Mode: types.ModeDeathmatch},
+		Stats: types.HostReportedStats{Kills: 100, HeadShots: 101, PlayTime: 60},
+	})
+	if len(violations) != 2 {
+		t.Errorf("Expected 2 violations, got %d", len(violations))
+	}
+}
@@ -0,0 +1,138 @@
+package metalgearonline1
+
+import (
+	"github.com/sirupsen/logrus"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/session"
+)
+
+const DefaultCommandInterval = 5 * time.Second
+
+// PollCommands handles the server commands created after the server started, it never returns
+func (gs *GameServer) PollCommands() {
+	var lastID uint
+	if err := gs.Db.Model(&models.ServerCommand{}).Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+		gs.Log.WithError(err).Error("Failed to find the latest server command, commands will not be handled")
+		return
+	}
+
+	ticker := time.NewTicker(gs.CommandInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		var commands []models.ServerCommand
+		q := gs.Db.Where("id > ? AND (lobby_id = 0 OR lobby_id = ?)", lastID, gs.LobbyID).Order("id")
+		if err := q.Find(&commands).Error; err != nil {
+			gs.Log.WithError(err).Error("Failed to poll server commands")
+			continue
+		}
+
+		for _, cmd := range commands {
+			lastID = cmd.ID
+			gs.handleCommand(cmd)
+		}
+	}
+}
+
+func (gs *GameServer) handleCommand(cmd models.ServerCommand) {
+	l := gs.Log.WithFields(logrus.Fields{
+		"command_id": cmd.ID,
+		"command":    cmd.Command,
+		"created_by": cmd.CreatedBy,
+	})
+	l.Info("Handling server command")
+
+	switch cmd.Command {
+	case models.CommandEnforceBan:
+		gs.EnforceBan(cmd.BanID)
+	case models.CommandEndSession:
+		gs.EndSession(cmd.SessionID)
+	default:
+		l.Warn("Unknown server command")
+	}
+}
+
+// EnforceBan disconnects every session the ban applies to. User bans match the logged-in user, IP bans also match
+// any session from an IP the banned user has connected from. Range and fingerprint bans match any session from the
+// range or reporting the fingerprint, whichever user is logged in. Games hosted by those sessions are closed as part of
+// the normal disconnect handling.
+func (gs *GameServer) EnforceBan(banID uint) {
+	l := gs.Log.WithField("ban_id", banID)
+
+	// The ban may have added or removed IPs
+	gs.banLock.Lock()
+	gs.LastBanUpdate = time.Time{}
+	gs.banLock.Unlock()
+
+	var ban models.Ban
+	if err := gs.Db.First(&ban, banID).Error; err != nil {
+		l.WithError(err).Error("Failed to find ban to enforce")
+		return
+	}
+	if ban.ExpiresAt.Before(time.Now()) {
+		l.Info("Ban has expired, nothing to enforce")
+		return
+	}
+
+	for _, sess := range gs.SessionList() {
+		// The session is changed by its own goroutine while this runs
+		snapshot := sess.Snapshot()
+		matchesUser := snapshot.UserID > 0 && snapshot.UserID == ban.UserID
+		matchesIP := (ban.Type == models.IPBan && gs.IsBannedIP(sess.IP)) || ban.MatchesIP(sess.IP)
+		matchesFingerprint := ban.MatchesFingerprint(snapshot.Connection.LocalAddr, snapshot.Connection.LocalPort)
+		if !matchesUser && !matchesIP && !matchesFingerprint {
+			continue
+		}
+
+		enforcement := models.BanEnforcement{
+			BanID:   ban.ID,
+			LobbyID: uint32(gs.LobbyID),
+			IP:      sess.IP,
+			UserID:  snapshot.UserID,
+			GameID:  uint(snapshot.GameID),
+		}
+
+		sl := sess.LogEntry().WithField("ban_id", ban.ID)
+		if err := sess.Disconnect(); err != nil {
+			sl.WithError(err).Error("Failed to disconnect banned session")
+			continue
+		}
+		sl.Info("Disconnected banned session")
+
+		if err := gs.Db.Create(&enforcement).Error; err != nil {
+			sl.WithError(err).Error("Failed to record ban enforcement")
+		}
+	}
+}
+
+// EndSession disconnects a session that was taken over by its user logging in again, any game it was hosting is closed
+// as part of the normal disconnect handling
+func (gs *GameServer) EndSession(id string) {
+	l := gs.Log.WithField("session_id", id)
+
+	gs.sessionLock.Lock()
+	sess, found := gs.Sessions[id]
+	gs.sessionLock.Unlock()
+	if !found {
+		l.Info("Session to end has already disconnected")
+		return
+	}
+
+	if err := sess.Disconnect(); err != nil {
+		sess.LogEntry().WithError(err).Error("Failed to disconnect taken over session")
+		return
+	}
+	sess.LogEntry().Info("Disconnected taken over session")
+}
+
+// KeepPlaySessionsAlive marks the lobby's open play sessions as alive so other lobbies know the users are still
+// connected, it never returns
+func (gs *GameServer) KeepPlaySessionsAlive() {
+	ticker := time.NewTicker(session.HeartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := models.TouchLobbyPlaySessions(gs.Db, uint(gs.LobbyID)); err != nil {
+			gs.Log.WithError(err).Error("Failed to mark play sessions alive")
+		}
+	}
+}
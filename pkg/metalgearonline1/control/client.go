@@ -0,0 +1,57 @@
+package control
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client sends requests to a gameserver's control api
+type Client struct {
+	http    *http.Client
+	baseURL string
+	token   string
+}
+
+// NewClient accepts the same address formats as the server's ControlConfig
+func NewClient(address string, token string) *Client {
+	c := &Client{
+		http:    &http.Client{Timeout: 10 * time.Second},
+		baseURL: "http://" + address,
+		token:   token,
+	}
+	if path, found := strings.CutPrefix(address, "unix:"); found {
+		c.baseURL = "http://unix"
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
+	return c
+}
+
+// Do sends the request and returns the status code and raw JSON body of the response
+func (c *Client) Do(method string, path string, body io.Reader) (int, []byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set(TokenHeader, c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	return res.StatusCode, data, err
+}
@@ -0,0 +1,110 @@
+package control
+
+import (
+	"time"
+	"tx55/pkg/metalgearonline1/session"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+// TokenHeader carries the shared token on every control request
+const TokenHeader = "X-CONTROL-TOKEN"
+
+// DefaultShutdownTimeout is how long a graceful shutdown waits for sessions to clean up
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Target is the gameserver being controlled
+type Target interface {
+	SessionList() []*session.Session
+	Shutdown(timeout time.Duration)
+}
+
+type ResponseJSON struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data"`
+}
+
+type SessionJSON struct {
+	ID          string       `json:"id"`
+	UserID      uint         `json:"user_id"`
+	DisplayName string       `json:"display_name"`
+	IP          string       `json:"ip"`
+	State       string       `json:"state" enums:"connected,in-lobby,hosting"`
+	GameID      types.GameID `json:"game_id"`
+}
+
+type GamePlayerJSON struct {
+	UserID types.UserID `json:"user_id"`
+	// Team is only set once the player has picked a team
+	Team *types.Team `json:"team"`
+	// LastPlayed is the last time the player joined a non-spectator team
+	LastPlayed time.Time `json:"last_played"`
+}
+
+type GameJSON struct {
+	GameID       types.GameID         `json:"game_id"`
+	Host         SessionJSON          `json:"host"`
+	CurrentRound byte                 `json:"current_round"`
+	Mode         types.GameModeString `json:"mode"`
+	Map          types.GameMapString  `json:"map"`
+	RoundStart   time.Time            `json:"round_start"`
+	CollectStats bool                 `json:"collect_stats"`
+	Players      []GamePlayerJSON     `json:"players"`
+}
+
+type LogSettingsJSON struct {
+	Level string `json:"level" enums:"panic,fatal,error,warn,info,debug,trace"`
+	// Trace dumps packets to stdout
+	Trace bool `json:"trace"`
+	// TracePackets limits the trace to these packet types, empty traces all of them
+	TracePackets []uint16 `json:"trace_packets"`
+}
+
+func ToSessionJSON(sess *session.Session) SessionJSON {
+	return sessionJSON(sess, sess.Snapshot())
+}
+
+// sessionJSON uses a snapshot as the session is changed by its own goroutine while the control api reads it
+func sessionJSON(sess *session.Session, snapshot session.Snapshot) SessionJSON {
+	out := SessionJSON{
+		ID:    sess.ID,
+		IP:    sess.IP,
+		State: "connected",
+	}
+	if snapshot.UserID > 0 {
+		out.UserID = snapshot.UserID
+		out.DisplayName = types.BytesToString(snapshot.DisplayName)
+		out.State = "in-lobby"
+	}
+	if snapshot.GameID > 0 {
+		out.State = "hosting"
+		out.GameID = snapshot.GameID
+	}
+	return out
+}
+
+// ToGameJSON needs the snapshot the game was found in, it must be hosting a game
+func ToGameJSON(sess *session.Session, snapshot session.Snapshot) GameJSON {
+	hs := snapshot.Game
+	hs.Lock.Lock()
+	defer hs.Lock.Unlock()
+
+	rules := hs.Rules[hs.CurrentRound]
+	out := GameJSON{
+		GameID:       hs.GameID,
+		Host:         sessionJSON(sess, snapshot),
+		CurrentRound: hs.CurrentRound,
+		Mode:         rules.Mode.String(),
+		Map:          rules.Map.String(),
+		RoundStart:   hs.RoundStart,
+		CollectStats: hs.CollectStats,
+		Players:      []GamePlayerJSON{},
+	}
+	for id, lastPlayed := range hs.Players {
+		player := GamePlayerJSON{UserID: id, LastPlayed: lastPlayed}
+		if team, found := hs.Teams[id]; found {
+			player.Team = &team
+		}
+		out.Players = append(out.Players, player)
+	}
+	return out
+}
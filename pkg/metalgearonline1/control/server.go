@@ -0,0 +1,187 @@
+package control
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"tx55/pkg/configurations"
+	"tx55/pkg/konamiserver"
+	"tx55/pkg/metalgearonline1/session"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+// Server is the operator API of a running gameserver
+type Server struct {
+	Engine  *gin.Engine
+	Address string
+
+	target Target
+	ks     *konamiserver.Server
+	log    *logrus.Logger
+	token  string
+}
+
+func NewServer(config configurations.ControlConfig, target Target, ks *konamiserver.Server, log *logrus.Logger) (*Server, error) {
+	if config.Token == "" {
+		return nil, errors.New("the control api requires a token")
+	}
+	gin.SetMode(gin.ReleaseMode)
+
+	s := &Server{
+		Engine:  gin.New(),
+		Address: config.Address,
+		target:  target,
+		ks:      ks,
+		log:     log,
+		token:   config.Token,
+	}
+	s.Engine.Use(gin.Recovery(), s.authenticate)
+
+	s.Engine.GET("/sessions", s.listSessions)
+	s.Engine.POST("/sessions/:session_id/kick", s.kickSession)
+	s.Engine.GET("/games/:game_id", s.getGame)
+	s.Engine.GET("/log", s.getLogSettings)
+	s.Engine.POST("/log", s.updateLogSettings)
+	s.Engine.POST("/shutdown", s.shutdown)
+	return s, nil
+}
+
+// Listen serves the api on the configured TCP address or unix socket, it only returns on error
+func (s *Server) Listen() error {
+	var listener net.Listener
+	var err error
+	if path, found := strings.CutPrefix(s.Address, "unix:"); found {
+		// A socket left behind by a previous run would make the listen fail
+		if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if listener, err = net.Listen("unix", path); err != nil {
+			return err
+		}
+		if err = os.Chmod(path, 0660); err != nil {
+			return err
+		}
+	} else if listener, err = net.Listen("tcp", s.Address); err != nil {
+		return err
+	}
+	return http.Serve(listener, s.Engine)
+}
+
+func success(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusOK, ResponseJSON{Success: true, Data: data})
+}
+
+func failure(c *gin.Context, code int, msg string) {
+	c.AbortWithStatusJSON(code, ResponseJSON{Success: false, Data: msg})
+}
+
+func (s *Server) authenticate(c *gin.Context) {
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader(TokenHeader)), []byte(s.token)) != 1 {
+		failure(c, http.StatusUnauthorized, "invalid control token")
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) findSession(id string) *session.Session {
+	for _, sess := range s.target.SessionList() {
+		if sess.ID == id {
+			return sess
+		}
+	}
+	return nil
+}
+
+func (s *Server) listSessions(c *gin.Context) {
+	sessions := s.target.SessionList()
+	out := make([]SessionJSON, len(sessions))
+	for i, sess := range sessions {
+		out[i] = ToSessionJSON(sess)
+	}
+	success(c, out)
+}
+
+func (s *Server) kickSession(c *gin.Context) {
+	sess := s.findSession(c.Param("session_id"))
+	if sess == nil {
+		failure(c, http.StatusNotFound, "session not found")
+		return
+	}
+
+	l := sess.LogEntry()
+	if err := sess.Disconnect(); err != nil {
+		l.WithError(err).Error("Failed to kick session")
+		failure(c, http.StatusInternalServerError, "failed to kick session")
+		return
+	}
+	l.Info("Kicked session through the control api")
+	success(c, nil)
+}
+
+func (s *Server) getGame(c *gin.Context) {
+	gameID, err := strconv.ParseUint(c.Param("game_id"), 10, 32)
+	if err != nil {
+		failure(c, http.StatusBadRequest, "invalid game id")
+		return
+	}
+
+	for _, sess := range s.target.SessionList() {
+		if snapshot := sess.Snapshot(); snapshot.Game != nil && snapshot.GameID == types.GameID(gameID) {
+			success(c, ToGameJSON(sess, snapshot))
+			return
+		}
+	}
+	failure(c, http.StatusNotFound, "game not found")
+}
+
+func (s *Server) logSettings() LogSettingsJSON {
+	trace, packets := s.ks.DebugSettings()
+	if packets == nil {
+		packets = []uint16{}
+	}
+	return LogSettingsJSON{
+		Level:        s.log.GetLevel().String(),
+		Trace:        trace,
+		TracePackets: packets,
+	}
+}
+
+func (s *Server) getLogSettings(c *gin.Context) {
+	success(c, s.logSettings())
+}
+
+func (s *Server) updateLogSettings(c *gin.Context) {
+	var args LogSettingsJSON
+	if err := c.ShouldBindJSON(&args); err != nil {
+		failure(c, http.StatusBadRequest, "invalid arguments")
+		return
+	}
+
+	level, err := logrus.ParseLevel(args.Level)
+	if err != nil {
+		failure(c, http.StatusBadRequest, "invalid log level")
+		return
+	}
+
+	s.log.SetLevel(level)
+	s.ks.SetDebug(args.Trace, args.TracePackets)
+	s.log.WithFields(logrus.Fields{
+		"log_level":     level.String(),
+		"trace":         args.Trace,
+		"trace_packets": args.TracePackets,
+	}).Info("Log settings changed through the control api")
+	success(c, s.logSettings())
+}
+
+func (s *Server) shutdown(c *gin.Context) {
+	s.log.Info("Shutdown requested through the control api")
+	// Respond before the sessions are torn down, the process exits once the shutdown completes
+	go s.target.Shutdown(DefaultShutdownTimeout)
+	success(c, nil)
+}
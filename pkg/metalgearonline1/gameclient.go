@@ -21,6 +21,7 @@ func (c *GameClient) OnConnected(conn net.Conn, out chan packet.Packet) (err err
 	c.conn = conn
 	c.out = out
 	c.Session.IP = conn.RemoteAddr().(*net.TCPAddr).IP.String()
+	c.Session.SetConnection(conn)
 
 	if c.Server.IsBannedIP(c.Session.IP) {
 		c.Session.LogEntry().Info("Banned IP, closing connection")
@@ -38,6 +39,8 @@ func (c *GameClient) OnDisconnected() {
 	if c.Session.IsHost() {
 		c.Session.StopHosting()
 	}
+	c.Session.EventDisconnected()
+	c.Session.EndPlaySession()
 
 	c.Server.DeleteSession(c.Session.ID)
 	return
@@ -1,6 +1,7 @@
 package metalgearonline1
 
 import (
+	"errors"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -8,6 +9,7 @@ import (
 	"time"
 	"tx55/pkg/konamiserver"
 	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/outbox"
 	"tx55/pkg/metalgearonline1/session"
 	"tx55/pkg/metalgearonline1/types"
 )
@@ -21,16 +23,33 @@ type GameServer struct {
 	Log           logrus.FieldLogger
 	LastBanUpdate time.Time
 	BannedIPs     map[string]bool
+	// BannedRanges are the active range bans, refreshed along with BannedIPs
+	BannedRanges []models.Ban
+	banLock      sync.Mutex
+	// CommandInterval is how often the server_commands table is polled
+	CommandInterval time.Duration
+
+	shutdownOnce sync.Once
+	stopping     chan struct{}
+	stopped      chan struct{}
 }
 
+// ErrShutdown is returned by Start once the server has been shut down with Shutdown
+var ErrShutdown = errors.New("gameserver was shut down")
+
 type Config struct {
 	Address string
 	Db      *gorm.DB
 	LobbyID types.LobbyID
 	Log     logrus.FieldLogger
+	// CommandInterval defaults to DefaultCommandInterval
+	CommandInterval time.Duration
 }
 
 func (gs *GameServer) IsBannedIP(ip string) bool {
+	gs.banLock.Lock()
+	defer gs.banLock.Unlock()
+
 	if gs.LastBanUpdate.Before(time.Now().Add(-5 * time.Minute)) {
 		query := "SELECT remote_addr FROM connections WHERE user_id IN (SELECT user_id FROM bans WHERE expires_at > NOW() AND type=?) GROUP BY remote_addr"
 
@@ -42,14 +61,63 @@ func (gs *GameServer) IsBannedIP(ip string) bool {
 		for _, i := range ips {
 			gs.BannedIPs[i] = true
 		}
+
+		ranges, err := models.ActiveBans(gs.Db, models.RangeBan)
+		if err != nil {
+			gs.Log.WithError(err).Error("Failed to load range bans")
+		} else {
+			gs.BannedRanges = ranges
+		}
 	}
 
 	if _, found := gs.BannedIPs[ip]; found {
 		return true
 	}
+	for i := range gs.BannedRanges {
+		if gs.BannedRanges[i].MatchesIP(ip) {
+			return true
+		}
+	}
 	return false
 }
 
+// SessionList is a snapshot of the connected sessions
+func (gs *GameServer) SessionList() []*session.Session {
+	gs.sessionLock.Lock()
+	defer gs.sessionLock.Unlock()
+
+	sessions := make([]*session.Session, 0, len(gs.Sessions))
+	for _, sess := range gs.Sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+// Shutdown stops accepting connections and disconnects every session so hosted games are closed properly. It waits
+// up to the timeout for the sessions to clean up, after which Start returns ErrShutdown.
+func (gs *GameServer) Shutdown(timeout time.Duration) {
+	gs.shutdownOnce.Do(func() {
+		close(gs.stopping)
+		defer close(gs.stopped)
+
+		gs.Log.Info("Shutting down")
+		gs.KonamiServer.Stop()
+
+		for _, sess := range gs.SessionList() {
+			_ = sess.Disconnect()
+		}
+
+		deadline := time.Now().Add(timeout)
+		for time.Now().Before(deadline) {
+			if len(gs.SessionList()) == 0 {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		gs.Log.WithField("sessions", len(gs.SessionList())).Warn("Timed out waiting for sessions to disconnect")
+	})
+}
+
 func (gs *GameServer) DeleteSession(id string) {
 	gs.sessionLock.Lock()
 	defer gs.sessionLock.Unlock()
@@ -89,8 +157,25 @@ func (gs *GameServer) Start() error {
 	gs.Db.Where("game_id IN ?", ids).Delete(&models.GamePlayers{})
 	gs.Db.Where("lobby_id = ?", gs.LobbyID).Delete(&models.Game{})
 	gs.Db.Model(&models.Lobby{ID: uint32(gs.LobbyID)}).Update("players", 0)
+	if err := models.EndLobbyPlaySessions(gs.Db, uint(gs.LobbyID)); err != nil {
+		gs.Log.WithError(err).Error("Failed to end the play sessions left open")
+	}
+
+	go gs.PollCommands()
+	go gs.KeepPlaySessionsAlive()
+	if outbox.Enabled() {
+		dispatcher := outbox.Dispatcher{DB: gs.Db, LobbyID: uint(gs.LobbyID), Log: gs.Log}
+		go dispatcher.Run()
+	}
 
-	return gs.KonamiServer.Start()
+	err := gs.KonamiServer.Start()
+	select {
+	case <-gs.stopping:
+		<-gs.stopped
+		return ErrShutdown
+	default:
+		return err
+	}
 }
 
 func (gs *GameServer) ClientFactory(_ string) konamiserver.GameClient {
@@ -102,10 +187,16 @@ func (gs *GameServer) ClientFactory(_ string) konamiserver.GameClient {
 
 func NewGameServer(cfg Config) *GameServer {
 	gs := &GameServer{
-		Sessions: make(map[string]*session.Session),
-		Db:       cfg.Db,
-		LobbyID:  cfg.LobbyID,
-		Log:      cfg.Log,
+		Sessions:        make(map[string]*session.Session),
+		Db:              cfg.Db,
+		LobbyID:         cfg.LobbyID,
+		Log:             cfg.Log,
+		CommandInterval: cfg.CommandInterval,
+		stopping:        make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	if gs.CommandInterval <= 0 {
+		gs.CommandInterval = DefaultCommandInterval
 	}
 
 	gs.KonamiServer = konamiserver.NewServer(konamiserver.Config{
@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"errors"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"reflect"
 	"tx55/pkg/metalgearonline1/handlers"
@@ -19,6 +21,11 @@ var ErrInvalidCredentials = handlers.ErrInvalidArguments.Code
 var ErrNotFound = handlers.ErrNotFound.Code
 var ErrDatabaseError = handlers.ErrDatabase.Code
 var ErrBanned = handlers.ErrBanned.Code
+var ErrAlreadyLoggedIn = handlers.ErrAlreadyLoggedIn.Code
+
+// ErrThrottled is sent for attempts refused by the login throttle, the client has no code of its own for it so these
+// look like any other failed login
+var ErrThrottled = handlers.ErrInvalidArguments.Code
 
 type LoginHandler struct{}
 
@@ -38,8 +45,21 @@ func (h LoginHandler) Handle(_ *session.Session, _ *packet.Packet) ([]types.Resp
 }
 
 func (h LoginHandler) HandleWithCredentials(sess *session.Session, args *ArgsLoginCredentials) ([]types.Response, error) {
+	username := types.BytesToString(args.Username[:])
+	if check, err := models.CheckLogin(sess.DB, models.LoginScopeGame, username, sess.IP); err != nil {
+		sess.LogEntry().WithError(err).Error("Failed to check login throttle")
+		return []types.Response{ResponseLoginError{ErrorCode: ErrDatabaseError}}, nil
+	} else if !check.Allowed {
+		sess.LogEntry().WithFields(logrus.Fields{
+			"username": username,
+			"locked":   check.Locked,
+			"retry_at": check.RetryAt,
+		}).Info("Login throttled")
+		return []types.Response{ResponseLoginError{ErrorCode: ErrThrottled}}, nil
+	}
+
 	var row models.User
-	if tx := sess.DB.First(&row, "username LIKE ?", types.BytesToString(args.Username[:])); tx.Error != nil {
+	if tx := sess.DB.First(&row, "username_canonical = ?", models.CanonicalUsername(args.Username[:])); tx.Error != nil {
 		if tx.Error != gorm.ErrRecordNotFound {
 			sess.LogEntry().WithError(tx.Error).Error("Failed to query user")
 			return []types.Response{ResponseLoginError{ErrorCode: ErrDatabaseError}}, nil
@@ -47,13 +67,27 @@ func (h LoginHandler) HandleWithCredentials(sess *session.Session, args *ArgsLog
 	}
 
 	if row.ID == 0 || !row.CheckPassword(args.Password[:]) {
+		if err := models.RecordLoginFailure(sess.DB, models.LoginScopeGame, username, sess.IP); err != nil {
+			sess.LogEntry().WithError(err).Error("Failed to record login failure")
+		}
 		return []types.Response{ResponseLoginError{ErrorCode: ErrInvalidCredentials}}, nil
 	}
+	if err := models.RecordLoginSuccess(sess.DB, models.LoginScopeGame, username); err != nil {
+		sess.LogEntry().WithError(err).Error("Failed to reset login failures")
+	}
 
 	if err := sess.DB.First(&models.Ban{}, "user_id = ? and (type = ? or type = ?) and expires_at > NOW()", row.ID, models.UserBan, models.IPBan).Error; err == nil {
-		// We do the ban check here, but it does technically allow a user who is already connected to a lobby
-		// to stay connected to that lobby. I think it's a fair trade-off to avoid having to do an extra query
-		// on every connection since the game connects/reconnects often
+		// Users that are already connected when they are banned are disconnected by the ban enforcement
+		// command the admin API queues, so this check only needs to happen at login
+		return []types.Response{ResponseLoginError{ErrorCode: ErrBanned}}, nil
+	}
+
+	// Range bans are also checked on connect, but that list is cached so check the latest bans here too
+	if ban, err := models.FindNetworkBan(sess.DB, sess.IP, "", 0); err != nil {
+		sess.LogEntry().WithError(err).Error("Failed to query network bans")
+		return []types.Response{ResponseLoginError{ErrorCode: ErrDatabaseError}}, nil
+	} else if ban != nil {
+		sess.LogEntry().WithFields(logrus.Fields{"ban_id": ban.ID, "user_id": row.ID}).Info("Login from banned range")
 		return []types.Response{ResponseLoginError{ErrorCode: ErrBanned}}, nil
 	}
 
@@ -63,15 +97,15 @@ func (h LoginHandler) HandleWithCredentials(sess *session.Session, args *ArgsLog
 		"previous_updated_at": gorm.Expr("updated_at"),
 	})
 
-	sess.Login(&row)
-
-	// Valid login attempt, create a new session ID
-	newSession := models.Session{
-		UserID: row.ID,
+	if err := sess.Login(&row); err != nil {
+		return []types.Response{ResponseLoginError{ErrorCode: loginErrorCode(sess, err)}}, nil
 	}
+	sess.EventLogin()
 
-	tx := sess.DB.Model(&newSession).Create(&newSession)
-	if tx.Error != nil {
+	// Valid login attempt, create a new session ID
+	newSession, err := models.NewSession(sess.DB, row.ID, sess.IP, session.Lifetime)
+	if err != nil {
+		sess.LogEntry().WithError(err).Error("Failed to create session")
 		return []types.Response{ResponseLoginError{ErrorCode: ErrDatabaseError}}, nil
 	}
 
@@ -97,11 +131,17 @@ func (h LoginHandler) HandleWithSession(s *session.Session, args *ArgsLoginSessi
 		return []types.Response{ResponseLoginError{ErrorCode: ErrDatabaseError}}, nil
 	}
 
-	if tx.RowsAffected == 0 || row.User.ID == 0 {
+	// Expired sessions are left for the REST API's cron to clear
+	if tx.RowsAffected == 0 || row.User.ID == 0 || row.Expired() {
 		return []types.Response{ResponseLoginError{ErrorCode: ErrNotFound}}, nil
 	}
+	if err := row.Renew(s.DB, s.IP, session.Lifetime); err != nil {
+		s.LogEntry().WithError(err).Error("Failed to renew session")
+	}
 
-	s.Login(&row.User)
+	if err := s.Login(&row.User); err != nil {
+		return []types.Response{ResponseLoginError{ErrorCode: loginErrorCode(s, err)}}, nil
+	}
 	out = append(out, ResponseLogin{
 		ErrorCode: 0,
 		SessionID: args.SessionID,
@@ -110,6 +150,14 @@ func (h LoginHandler) HandleWithSession(s *session.Session, args *ArgsLoginSessi
 	return out, nil
 }
 
+func loginErrorCode(sess *session.Session, err error) int32 {
+	if errors.Is(err, session.ErrAlreadyLoggedIn) {
+		return ErrAlreadyLoggedIn
+	}
+	sess.LogEntry().WithError(err).Error("Failed to check the user's other sessions")
+	return ErrDatabaseError
+}
+
 // --- Packets ---
 
 func (r ResponseLogin) Type() types.PacketType      { return types.ServerLogin }
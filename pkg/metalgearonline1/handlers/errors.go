@@ -8,6 +8,7 @@ var ErrInvalidArguments = NewError(-4, "invalid arguments")
 var ErrDatabase = NewError(-5, "database error")
 var ErrNotHosting = NewError(-6, "not hosting")
 var ErrBanned = NewError(-7, "banned")
+var ErrAlreadyLoggedIn = NewError(-8, "already logged in")
 
 type GameError struct {
 	Code    int32
@@ -23,6 +23,9 @@ func (h HostQuitHandler) ArgumentTypes() []reflect.Type {
 }
 
 func (h HostQuitHandler) Handle(sess *session.Session, _ *packet.Packet) ([]types.Response, error) {
+	if sess.IsHost() {
+		sess.EventHostQuit()
+	}
 	sess.StopHosting()
 	return []types.Response{
 		ResponseHostQuit{ErrorCode: 0},
@@ -37,8 +37,7 @@ func (h HostNewRoundHandler) HandleArgs(sess *session.Session, args *ArgsHostNew
 		return
 	}
 
-	go sess.GameState.NewRound(args.RoundID)
-	sess.EventGameNewRound(args.RoundID)
+	sess.GameState.NewRound(args.RoundID)
 	out = append(out, ResponseHostNewRound{ErrorCode: 0})
 
 	sess.LogEntry().WithFields(logrus.Fields{
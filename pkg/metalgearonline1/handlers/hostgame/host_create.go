@@ -1,6 +1,7 @@
 package hostgame
 
 import (
+	"gorm.io/gorm"
 	"reflect"
 	"tx55/pkg/metalgearonline1/handlers"
 	"tx55/pkg/metalgearonline1/models"
@@ -55,12 +56,18 @@ func (h CreateGameHandler) HandleArgs(s *session.Session, args *types.CreateGame
 		ConnectionID:  s.ActiveConnection.ID,
 		GameOptionsID: opts.ID,
 	}
-	if tx := s.DB.Create(&newGame); tx.Error != nil {
-		return []types.Response{ResponseCreateGame{ErrorCode: handlers.ErrDatabase.Code}}, tx.Error
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newGame).Error; err != nil {
+			return err
+		}
+		s.EventGameCreated(tx, newGame.ID, args)
+		return nil
+	})
+	if err != nil {
+		return []types.Response{ResponseCreateGame{ErrorCode: handlers.ErrDatabase.Code}}, err
 	}
 
 	s.StartHosting(types.GameID(newGame.ID), args)
-	s.EventGameCreated(newGame.ID, args)
 
 	s.GameState.AddPlayer(types.UserID(s.User.ID))
 	return []types.Response{ResponseCreateGame{ErrorCode: 0}}, nil
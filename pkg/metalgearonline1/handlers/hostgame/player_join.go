@@ -37,8 +37,7 @@ func (h HostPlayerJoinHandler) HandleArgs(sess *session.Session, args *ArgsHostP
 		return
 	}
 
-	go sess.GameState.AddPlayer(args.UserID)
-	sess.EventGamePlayerJoined(args.UserID)
+	sess.GameState.AddPlayer(args.UserID)
 	out = append(out, ResponseHostPlayerJoin{ErrorCode: 0, UserID: args.UserID})
 
 	sess.LogEntry().WithFields(logrus.Fields{
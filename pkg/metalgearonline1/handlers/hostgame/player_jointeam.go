@@ -37,7 +37,7 @@ func (h HostPlayerJoinTeam) HandleArgs(sess *session.Session, args *ArgsHostPlay
 		return
 	}
 
-	go sess.GameState.JoinTeam(args.UserID, args.TeamID)
+	sess.GameState.JoinTeam(args.UserID, args.TeamID)
 	out = append(out, ResponseHostPlayerJoinTeam{ErrorCode: 0, UserID: args.UserID})
 
 	sess.LogEntry().WithFields(logrus.Fields{
@@ -37,7 +37,7 @@ func (h HostPlayerKickedHandler) HandleArgs(sess *session.Session, args *ArgsHos
 		return
 	}
 
-	go sess.GameState.KickPlayer(args.UserID)
+	sess.GameState.KickPlayer(args.UserID)
 	out = append(out, ResponseHostPlayerKicked{ErrorCode: 0, UserID: args.UserID})
 
 	sess.LogEntry().WithFields(logrus.Fields{
@@ -37,8 +37,7 @@ func (h HostPlayerLeaveHandler) HandleArgs(sess *session.Session, args *ArgsHost
 		return
 	}
 
-	go sess.GameState.RemovePlayer(args.UserID)
-	sess.EventGamePlayerLeft(args.UserID)
+	sess.GameState.RemovePlayer(args.UserID)
 	out = append(out, ResponseHostPlayerLeave{ErrorCode: 0, UserID: args.UserID})
 
 	sess.LogEntry().WithFields(logrus.Fields{
@@ -5,7 +5,8 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"reflect"
-	"strings"
+	"tx55/pkg/metalgearonline1/achievements"
+	"tx55/pkg/metalgearonline1/anomaly"
 	"tx55/pkg/metalgearonline1/handlers"
 	"tx55/pkg/metalgearonline1/models"
 	"tx55/pkg/metalgearonline1/session"
@@ -111,91 +112,79 @@ func (h HostPlayerStatsHandler) updatePlayerStats(sess *session.Session, UserID
 		return nil
 	}
 
-	sess.DB.Model(&models.User{
-		Model: gorm.Model{ID: UserID},
-	}).Update("vs_rating", stats.VsRating)
-
-	updates = map[string]interface{}{
-		"kills":                gorm.Expr("kills + ?", stats.Kills),
-		"deaths":               gorm.Expr("deaths + ?", stats.Deaths),
-		"stuns":                gorm.Expr("stuns + ?", stats.Stuns),
-		"stuns_received":       gorm.Expr("stuns_received + ?", stats.StunsReceived),
-		"snake_frags":          gorm.Expr("snake_frags + ?", stats.SnakeFrags),
-		"points":               gorm.Expr("points + ?", stats.Points),
-		"suicides":             gorm.Expr("suicides + ?", stats.Suicides),
-		"self_stuns":           gorm.Expr("self_stuns + ?", stats.SelfStuns),
-		"team_kills":           gorm.Expr("team_kills + ?", stats.TeamKills),
-		"team_stuns":           gorm.Expr("team_stuns + ?", stats.TeamStuns),
-		"rounds_played":        gorm.Expr("rounds_played + ?", stats.RoundsPlayed),
-		"rounds_no_death":      gorm.Expr("rounds_no_death + ?", stats.RoundsNoDeath),
-		"kerotans_for_win":     gorm.Expr("kerotans_for_win + ?", stats.KerotansForWin),
-		"kerotans_placed":      gorm.Expr("kerotans_placed + ?", stats.KerotansPlaced),
-		"radio_uses":           gorm.Expr("radio_uses + ?", stats.RadioUses),
-		"text_chat_uses":       gorm.Expr("text_chat_uses + ?", stats.TextChatUses),
-		"cqc_attacks":          gorm.Expr("cqc_attacks + ?", stats.CQCAttacks),
-		"cqc_attacks_received": gorm.Expr("cqc_attacks_received + ?", stats.CQCAttacksReceived),
-		"head_shots":           gorm.Expr("head_shots + ?", stats.HeadShots),
-		"head_shots_received":  gorm.Expr("head_shots_received + ?", stats.HeadShotsReceived),
-		"team_wins":            gorm.Expr("team_wins + ?", stats.TeamWins),
-		"kills_with_scorpion":  gorm.Expr("kills_with_scorpion + ?", stats.KillsWithScorpion),
-		"kills_with_knife":     gorm.Expr("kills_with_knife + ?", stats.KillsWithKnife),
-		"times_eaten":          gorm.Expr("times_eaten + ?", stats.TimesEaten),
-		"rolls":                gorm.Expr("rolls + ?", stats.Rolls),
-		"infrared_goggle_uses": gorm.Expr("infrared_goggle_uses + ?", stats.InfraredGoggleUses),
-		"play_time":            gorm.Expr("play_time + ?", stats.PlayTime),
-	}
-
-	// sqlite uses MAX(...) whereas others reserve MAX(...) for aggregates
-	switch strings.ToLower(sess.DB.Dialector.Name()) {
-	case "sqlite3":
-		fallthrough
-	case "sqlite":
-		updates["kill_streak"] = gorm.Expr("MAX(kill_streak, ?)", stats.KillStreak)
-		updates["death_streak"] = gorm.Expr("MAX(death_streak, ?)", stats.DeathStreak)
-	case "mssql":
-		fallthrough
-	case "postgres":
-		fallthrough
-	case "mysql":
-		updates["kill_streak"] = gorm.Expr("GREATEST(kill_streak, ?)", stats.KillStreak)
-		updates["death_streak"] = gorm.Expr("GREATEST(death_streak, ?)", stats.DeathStreak)
-	default:
-		panic("unknown dialect: " + sess.DB.Dialector.Name())
-	}
-
 	currentRules := sess.GameState.Rules[sess.GameState.CurrentRound]
-	tx := sess.DB.Model(&models.PlayerStats{})
-	tx = tx.Where("user_id = ? AND mode = ? AND map = ?", UserID, currentRules.Mode, currentRules.Map)
-	tx = tx.Updates(updates)
-
-	if tx.Error != nil {
-		// I don't believe we can get a ErrRecordNotFound with an UPDATE
-		return tx.Error
+	submission := &anomaly.Submission{
+		HostID: sess.User.ID,
+		UserID: UserID,
+		GameID: uint(sess.GameState.GameID),
+		Rules:  currentRules,
+		Stats:  stats,
+	}
+	if violations := anomaly.Active.Evaluate(sess.DB, submission); len(violations) > 0 {
+		return h.quarantineStats(sess, l, submission, violations)
 	}
 
-	if tx.RowsAffected < 2 {
+	var created bool
+	err := sess.DB.Transaction(func(tx *gorm.DB) (err error) {
+		if created, err = models.ApplyHostReportedStats(tx, UserID, currentRules, stats); err != nil {
+			return
+		}
+		sess.EventStatsReported(tx, types.UserID(UserID), currentRules, stats, false)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	if created {
 		l.Info("Creating new stats for user")
+	}
+
+	// The server rating is only calculated once every player's stats for the round are in
+	sess.GameState.RecordResult(types.UserID(UserID), stats)
+
+	l.Info("Updated user stats")
 
-		newStats := models.PlayerStats{
-			UserID: UserID,
-			Mode:   currentRules.Mode,
-			Map:    currentRules.Map,
-			Period: types.PeriodWeekly,
+	if unlocked, err := achievements.Evaluate(sess.DB, UserID); err != nil {
+		l.WithError(err).Error("Failed to evaluate achievements")
+	} else {
+		for _, a := range unlocked {
+			l.WithField("achievement", a.Key).Info("Unlocked achievement")
 		}
-		newStats.FromHostReportedStats(stats)
-		sess.DB.Create(&newStats)
-
-		newStats = models.PlayerStats{
-			UserID: UserID,
-			Mode:   currentRules.Mode,
-			Map:    currentRules.Map,
-			Period: types.PeriodAllTime,
+	}
+	return nil
+}
+
+// quarantineStats holds onto the suspicious stats for an admin to review instead of applying them
+func (h HostPlayerStatsHandler) quarantineStats(sess *session.Session, l *logrus.Entry, s *anomaly.Submission, violations []anomaly.Violation) error {
+	entry := models.QuarantinedStats{
+		UserID:  s.UserID,
+		HostID:  s.HostID,
+		GameID:  s.GameID,
+		Mode:    s.Rules.Mode,
+		Map:     s.Rules.Map,
+		Reasons: anomaly.Reasons(violations),
+		Status:  models.QuarantinePending,
+	}
+	if err := entry.SetStats(s.Stats); err != nil {
+		return err
+	}
+
+	err := sess.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
 		}
-		newStats.FromHostReportedStats(stats)
-		sess.DB.Create(&newStats)
+		sess.EventStatsReported(tx, types.UserID(s.UserID), s.Rules, s.Stats, true)
+		return nil
+	})
+	if err != nil {
+		l.WithError(err).Error("Failed to quarantine stats")
+		return err
 	}
 
-	l.Info("Updated user stats")
+	l.WithFields(logrus.Fields{
+		"quarantine_id": entry.ID,
+		"reasons":       entry.Reasons,
+	}).Warn("Quarantined suspicious stats")
 	return nil
 }
 
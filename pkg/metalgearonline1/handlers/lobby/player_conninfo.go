@@ -38,10 +38,22 @@ func (h ReportConnectionInfo) HandleArgs(sess *session.Session, args *ArgsReport
 	tx = tx.Where("local_addr = ?", types.BytesToString(args.LocalAddr[:]))
 	tx = tx.Where("local_port = ?", args.LocalPort)
 
+	localAddr := types.BytesToString(args.LocalAddr[:])
+	if ban, err := models.FindNetworkBan(sess.DB, sess.IP, localAddr, args.LocalPort); err != nil {
+		sess.LogEntry().WithError(err).Error("Failed to query network bans")
+		return []types.Response{ResponseReportConnectionInfo{ErrorCode: handlers.ErrDatabase.Code}}, handlers.ErrDatabase
+	} else if ban != nil {
+		sess.LogEntry().WithField("ban_id", ban.ID).Info("Banned fingerprint, disconnecting")
+		// Give the error response a moment to be sent before the connection is closed
+		time.AfterFunc(time.Second, func() { _ = sess.Disconnect() })
+		return []types.Response{ResponseReportConnectionInfo{ErrorCode: handlers.ErrBanned.Code}}, nil
+	}
+
 	var conn models.Connection
 	tx = tx.First(&conn)
 
-	if conn.ID == 0 {
+	newConnection := conn.ID == 0
+	if newConnection {
 		conn.UserID = sess.User.ID
 		conn.RemoteAddr = sess.IP
 		conn.RemotePort = args.RemotePort
@@ -56,7 +68,16 @@ func (h ReportConnectionInfo) HandleArgs(sess *session.Session, args *ArgsReport
 		return []types.Response{ResponseReportConnectionInfo{ErrorCode: handlers.ErrDatabase.Code}}, handlers.ErrDatabase
 	}
 
-	sess.ActiveConnection = conn
+	sess.SetActiveConnection(conn)
+
+	// A connection not seen before is the only time a new account can start to overlap with a banned one
+	if newConnection {
+		if flag, err := models.EvaluateBanEvasion(sess.DB, sess.User); err != nil {
+			sess.LogEntry().WithError(err).Error("Failed to score ban evasion")
+		} else if flag != nil {
+			sess.LogEntry().WithField("evasion_score", flag.Score).Warn("Flagged possible ban evasion")
+		}
+	}
 
 	return []types.Response{ResponseReportConnectionInfo{ErrorCode: 0}}, nil
 }
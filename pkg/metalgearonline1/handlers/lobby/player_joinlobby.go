@@ -28,6 +28,7 @@ func (h JoinHandler) ArgumentTypes() []reflect.Type {
 }
 
 func (h JoinHandler) Handle(sess *session.Session, _ *packet.Packet) ([]types.Response, error) {
+	sess.EventLobbyJoin()
 	var out []types.Response
 	out = append(out, h.overviewPacket(sess))
 	out = append(out, h.myStatsPackets(sess)...)
@@ -0,0 +1,16 @@
+package models
+
+import "gorm.io/gorm"
+
+func init() {
+	All = append(All, &UserAchievement{})
+}
+
+// UserAchievement is an achievement a user has unlocked, the achievements themselves are defined in the
+// achievements package. CreatedAt is when it was unlocked.
+type UserAchievement struct {
+	gorm.Model
+	UserID      uint `gorm:"uniqueIndex:idx_user_achievement"`
+	User        User
+	Achievement string `gorm:"size:64;uniqueIndex:idx_user_achievement"`
+}
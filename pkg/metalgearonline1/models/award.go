@@ -0,0 +1,25 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	All = append(All, &AwardHistory{})
+}
+
+// AwardHistory is a single time a user was given an award. The emblem the user had before is kept so it can be put
+// back once the award expires.
+type AwardHistory struct {
+	gorm.Model
+	UserID     uint `gorm:"index"`
+	User       User
+	Award      string `gorm:"size:64;index"`
+	EmblemText []byte `gorm:"size:16"`
+	// PreviousHasEmblem and PreviousEmblemText are restored when the award expires
+	PreviousHasEmblem  bool
+	PreviousEmblemText []byte    `gorm:"size:16"`
+	ExpiresAt          time.Time `gorm:"index"`
+	Expired            bool
+}
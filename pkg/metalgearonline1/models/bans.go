@@ -1,7 +1,11 @@
 package models
 
 import (
+	"bytes"
+	"errors"
 	"gorm.io/gorm"
+	"net"
+	"strings"
 	"time"
 )
 
@@ -14,6 +18,10 @@ type BanType byte
 const (
 	IPBan   BanType = 1
 	UserBan BanType = 2
+	// RangeBan bans every remote address in IPRange, whichever account is used
+	RangeBan BanType = 3
+	// FingerprintBan bans the LocalAddr and LocalPort a client reports after logging in, whichever account is used
+	FingerprintBan BanType = 4
 )
 
 func (b BanType) String() string {
@@ -22,6 +30,10 @@ func (b BanType) String() string {
 		return "IP"
 	case UserBan:
 		return "User"
+	case RangeBan:
+		return "Range"
+	case FingerprintBan:
+		return "Fingerprint"
 	default:
 		return "Unknown"
 	}
@@ -30,10 +42,93 @@ func (b BanType) String() string {
 type Ban struct {
 	gorm.Model
 	ExpiresAt time.Time
+	// UserID is the banned user, range and fingerprint bans use it for the user they were created for, if any
 	UserID    uint
 	User      User
 	CreatedBy string
 	UpdatedBy string
 	Reason    string
 	Type      BanType
+	// IPRange is a CIDR (10.0.0.0/8), an inclusive range (10.0.0.1-10.0.0.50) or a single address
+	IPRange   string `gorm:"type:varchar(31)"`
+	LocalAddr string `gorm:"type:varchar(15)"`
+	// LocalPort of 0 matches any port
+	LocalPort uint16
+}
+
+// ParseIPRange returns the first and last IPv4 address of a range in any of the formats IPRange accepts
+func ParseIPRange(s string) (start net.IP, end net.IP, err error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		var network *net.IPNet
+		if _, network, err = net.ParseCIDR(s); err != nil {
+			return
+		}
+		start = network.IP.To4()
+		if start == nil {
+			return nil, nil, errors.New("only IPv4 ranges are supported")
+		}
+		end = make(net.IP, len(start))
+		for i := range start {
+			end[i] = start[i] | ^network.Mask[i]
+		}
+		return
+	}
+
+	first, last, found := strings.Cut(s, "-")
+	if !found {
+		last = first
+	}
+	start = net.ParseIP(strings.TrimSpace(first)).To4()
+	end = net.ParseIP(strings.TrimSpace(last)).To4()
+	if start == nil || end == nil {
+		return nil, nil, errors.New("invalid IPv4 address in range")
+	}
+	if bytes.Compare(start, end) > 0 {
+		return nil, nil, errors.New("range starts after it ends")
+	}
+	return
+}
+
+// MatchesIP reports whether the address is inside a range ban
+func (b *Ban) MatchesIP(ip string) bool {
+	if b.Type != RangeBan {
+		return false
+	}
+	start, end, err := ParseIPRange(b.IPRange)
+	addr := net.ParseIP(ip).To4()
+	if err != nil || addr == nil {
+		return false
+	}
+	return bytes.Compare(addr, start) >= 0 && bytes.Compare(addr, end) <= 0
+}
+
+// MatchesFingerprint reports whether the connection info a client reported matches a fingerprint ban
+func (b *Ban) MatchesFingerprint(localAddr string, localPort uint16) bool {
+	if b.Type != FingerprintBan || b.LocalAddr == "" {
+		return false
+	}
+	return b.LocalAddr == localAddr && (b.LocalPort == 0 || b.LocalPort == localPort)
+}
+
+// ActiveBans returns the bans of the given types that have not expired
+func ActiveBans(db *gorm.DB, banTypes ...BanType) ([]Ban, error) {
+	var bans []Ban
+	err := db.Where("expires_at > ? AND type IN ?", time.Now(), banTypes).Find(&bans).Error
+	return bans, err
+}
+
+// FindNetworkBan returns the first active range or fingerprint ban that matches the connection, pass an empty
+// localAddr to only check the ranges
+func FindNetworkBan(db *gorm.DB, ip string, localAddr string, localPort uint16) (*Ban, error) {
+	bans, err := ActiveBans(db, RangeBan, FingerprintBan)
+	if err != nil {
+		return nil, err
+	}
+	for i := range bans {
+		if bans[i].MatchesIP(ip) || (localAddr != "" && bans[i].MatchesFingerprint(localAddr, localPort)) {
+			return &bans[i], nil
+		}
+	}
+	return nil, nil
 }
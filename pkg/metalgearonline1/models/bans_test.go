@@ -0,0 +1,52 @@
+package models
+
+import "testing"
+
+func TestParseIPRange(t *testing.T) {
+	cases := []struct {
+		in, start, end string
+	}{
+		{"10.1.0.0/16", "10.1.0.0", "10.1.255.255"},
+		{"10.1.2.3/24", "10.1.2.0", "10.1.2.255"},
+		{"10.0.0.1-10.0.0.50", "10.0.0.1", "10.0.0.50"},
+		{" 192.168.1.1 ", "192.168.1.1", "192.168.1.1"},
+	}
+	for _, c := range cases {
+		start, end, err := ParseIPRange(c.in)
+		if err != nil {
+			t.Errorf("Expected %q to parse, got %v", c.in, err)
+			continue
+		}
+		if start.String() != c.start || end.String() != c.end {
+			t.Errorf("Expected %q to be %s-%s, got %s-%s", c.in, c.start, c.end, start, end)
+		}
+	}
+
+	for _, in := range []string{"", "10.0.0.50-10.0.0.1", "10.0.0.0/33", "::1/64", "not an ip"} {
+		if _, _, err := ParseIPRange(in); err == nil {
+			t.Errorf("Expected %q to be rejected", in)
+		}
+	}
+}
+
+func TestBanMatches(t *testing.T) {
+	rangeBan := Ban{Type: RangeBan, IPRange: "10.1.0.0/16"}
+	if !rangeBan.MatchesIP("10.1.200.3") || rangeBan.MatchesIP("10.2.0.1") || rangeBan.MatchesIP("bad") {
+		t.Error("Expected the range ban to only match addresses inside 10.1.0.0/16")
+	}
+
+	userBan := Ban{Type: UserBan, IPRange: "10.1.0.0/16"}
+	if userBan.MatchesIP("10.1.200.3") {
+		t.Error("Expected only range bans to match addresses")
+	}
+
+	anyPort := Ban{Type: FingerprintBan, LocalAddr: "192.168.0.20"}
+	if !anyPort.MatchesFingerprint("192.168.0.20", 5731) || anyPort.MatchesFingerprint("192.168.0.21", 5731) {
+		t.Error("Expected a fingerprint ban without a port to match any port of the address")
+	}
+
+	onePort := Ban{Type: FingerprintBan, LocalAddr: "192.168.0.20", LocalPort: 5731}
+	if !onePort.MatchesFingerprint("192.168.0.20", 5731) || onePort.MatchesFingerprint("192.168.0.20", 5732) {
+		t.Error("Expected a fingerprint ban with a port to only match that port")
+	}
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+func init() {
+	All = append(All, &EvasionFlag{})
+}
+
+// Points added to a user's ban evasion score for each kind of overlap with a banned user or network ban
+const (
+	EvasionScoreSharedIP          = 40
+	EvasionScoreSharedFingerprint = 25
+	EvasionScoreBannedRange       = 30
+	EvasionScoreBannedFingerprint = 50
+	EvasionScoreNewAccount        = 20
+	// EvasionFlagThreshold is the score an account needs to be flagged for review
+	EvasionFlagThreshold = 60
+	// EvasionAccountAge is how long after an account is created it keeps being scored
+	EvasionAccountAge = 30 * 24 * time.Hour
+)
+
+type EvasionStatus byte
+
+const (
+	EvasionPending   EvasionStatus = 0
+	EvasionDismissed EvasionStatus = 1
+	EvasionBanned    EvasionStatus = 2
+)
+
+func (e EvasionStatus) String() string {
+	switch e {
+	case EvasionPending:
+		return "pending"
+	case EvasionDismissed:
+		return "dismissed"
+	case EvasionBanned:
+		return "banned"
+	default:
+		return "unknown"
+	}
+}
+
+// EvasionFlag marks a new account that looks like a banned player coming back
+type EvasionFlag struct {
+	gorm.Model
+	UserID uint `gorm:"uniqueIndex"`
+	User   User
+	Score  int
+	// Reasons is a newline separated list of why the account was scored
+	Reasons string `gorm:"type:text"`
+	// BannedUserIDs is a comma separated list of the banned users this account overlaps with
+	BannedUserIDs string
+	Status        EvasionStatus
+	ReviewedBy    string
+	ReviewedAt    time.Time
+}
+
+// bannedUsers filters the ids down to the users with an active user or IP ban
+func bannedUsers(db *gorm.DB, ids []uint) ([]uint, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var out []uint
+	err := db.Model(&Ban{}).Distinct("user_id").
+		Where("user_id IN ? AND type IN ? AND expires_at > ?", ids, []BanType{UserBan, IPBan}, time.Now()).
+		Pluck("user_id", &out).Error
+	return out, err
+}
+
+// ScoreBanEvasion scores how likely the user is to be a banned player on a new account, using the accounts that share
+// an IP or fingerprint with it and the network bans its connections match
+func ScoreBanEvasion(db *gorm.DB, user *User) (score int, reasons []string, banned []uint, err error) {
+	seen := map[uint]bool{}
+	addBanned := func(ids []uint) {
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				banned = append(banned, id)
+			}
+		}
+	}
+
+	sharedIP, err := bannedUsers(db, user.SharedAccounts(db))
+	if err != nil {
+		return
+	}
+	if len(sharedIP) > 0 {
+		score += EvasionScoreSharedIP
+		reasons = append(reasons, fmt.Sprintf("shares an IP with %d banned user(s)", len(sharedIP)))
+		addBanned(sharedIP)
+	}
+
+	sharedFingerprint, err := bannedUsers(db, user.SharedFingerprintAccounts(db))
+	if err != nil {
+		return
+	}
+	if len(sharedFingerprint) > 0 {
+		score += EvasionScoreSharedFingerprint
+		reasons = append(reasons, fmt.Sprintf("shares a local address and port with %d banned user(s)", len(sharedFingerprint)))
+		addBanned(sharedFingerprint)
+	}
+
+	var connections []Connection
+	if err = db.Where("user_id = ?", user.ID).Find(&connections).Error; err != nil {
+		return
+	}
+	networkBans, err := ActiveBans(db, RangeBan, FingerprintBan)
+	if err != nil {
+		return
+	}
+	var inRange, fingerprinted bool
+	for _, conn := range connections {
+		for i := range networkBans {
+			if !inRange && networkBans[i].MatchesIP(conn.RemoteAddr) {
+				inRange = true
+				score += EvasionScoreBannedRange
+				reasons = append(reasons, fmt.Sprintf("connected from banned range %s (ban %d)", networkBans[i].IPRange, networkBans[i].ID))
+			}
+			if !fingerprinted && networkBans[i].MatchesFingerprint(conn.LocalAddr, conn.LocalPort) {
+				fingerprinted = true
+				score += EvasionScoreBannedFingerprint
+				reasons = append(reasons, fmt.Sprintf("matches banned fingerprint (ban %d)", networkBans[i].ID))
+			}
+		}
+	}
+
+	// Being new only matters when there's something else pointing at evasion
+	if score > 0 && user.CreatedAt.After(time.Now().Add(-EvasionAccountAge)) {
+		score += EvasionScoreNewAccount
+		reasons = append(reasons, "account is new")
+	}
+	return
+}
+
+// EvaluateBanEvasion scores accounts younger than EvasionAccountAge and flags them once they reach the threshold.
+// Dismissed flags are only reopened if the score has gone up since they were dismissed.
+func EvaluateBanEvasion(db *gorm.DB, user *User) (*EvasionFlag, error) {
+	if user.CreatedAt.Before(time.Now().Add(-EvasionAccountAge)) {
+		return nil, nil
+	}
+
+	score, reasons, banned, err := ScoreBanEvasion(db, user)
+	if err != nil || score < EvasionFlagThreshold {
+		return nil, err
+	}
+
+	var flag EvasionFlag
+	if err = db.Where("user_id = ?", user.ID).Limit(1).Find(&flag).Error; err != nil {
+		return nil, err
+	}
+	if flag.ID > 0 && flag.Status != EvasionPending && score <= flag.Score {
+		return nil, nil
+	}
+
+	ids := make([]string, len(banned))
+	for i, id := range banned {
+		ids[i] = fmt.Sprint(id)
+	}
+	flag.UserID = user.ID
+	flag.Score = score
+	flag.Reasons = strings.Join(reasons, "\n")
+	flag.BannedUserIDs = strings.Join(ids, ",")
+	flag.Status = EvasionPending
+	return &flag, db.Save(&flag).Error
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+func init() {
+	All = append(All, &LoginFailure{}, &LoginLockout{})
+}
+
+// LoginScope keeps the game and admin accounts apart, as they can share usernames
+type LoginScope string
+
+const (
+	LoginScopeGame  LoginScope = "game"
+	LoginScopeAdmin LoginScope = "admin"
+)
+
+const (
+	// LoginFailureWindow is how long failed logins count towards delays and lockouts
+	LoginFailureWindow = 15 * time.Minute
+	// LoginDelayAfter is the number of failures for a username before each attempt has to wait, the wait doubles with
+	// each failure up to LoginMaxDelay
+	LoginDelayAfter = 3
+	LoginMaxDelay   = 30 * time.Second
+	// UsernameLockoutFailures locks a username for UsernameLockoutDuration
+	UsernameLockoutFailures = 10
+	UsernameLockoutDuration = 15 * time.Minute
+	// IPLockoutFailures locks an address for IPLockoutDuration, it's higher than the username limit as players can
+	// share an address
+	IPLockoutFailures = 30
+	IPLockoutDuration = 30 * time.Minute
+)
+
+// LoginFailure is a failed login attempt, they're deleted once they're older than LoginFailureWindow
+type LoginFailure struct {
+	ID        uint       `gorm:"primaryKey"`
+	CreatedAt time.Time  `gorm:"index"`
+	Scope     LoginScope `gorm:"size:16"`
+	Username  string     `gorm:"size:64;index"`
+	IP        string     `gorm:"size:45;index"`
+}
+
+// LoginLockout stops all logins for a username or from an address until it expires
+type LoginLockout struct {
+	ID        uint       `gorm:"primaryKey"`
+	CreatedAt time.Time  `gorm:"index"`
+	Scope     LoginScope `gorm:"size:16"`
+	// Only one of Username and IP is set
+	Username  string `gorm:"size:64;index"`
+	IP        string `gorm:"size:45;index"`
+	Failures  int64
+	ExpiresAt time.Time `gorm:"index"`
+	// ClearedBy is the admin that lifted the lockout early
+	ClearedBy string
+}
+
+func (l *LoginLockout) Active() bool {
+	return l.ExpiresAt.After(time.Now())
+}
+
+// LoginCheck is the result of CheckLogin, when the attempt isn't allowed RetryAt is when it will be
+type LoginCheck struct {
+	Allowed bool
+	Locked  bool
+	RetryAt time.Time
+}
+
+func normalizeLoginUsername(username string) string {
+	return strings.ToLower(strings.TrimRight(username, "\x00"))
+}
+
+// loginDelay is how long to wait after the last failure given the number of recent failures
+func loginDelay(failures int64) time.Duration {
+	if failures < LoginDelayAfter {
+		return 0
+	}
+	delay := time.Second << (failures - LoginDelayAfter)
+	if delay > LoginMaxDelay || delay <= 0 {
+		return LoginMaxDelay
+	}
+	return delay
+}
+
+// CheckLogin must be called before a password is checked, attempts that aren't allowed shouldn't check the password
+// or be recorded as failures
+func CheckLogin(db *gorm.DB, scope LoginScope, username string, ip string) (LoginCheck, error) {
+	username = normalizeLoginUsername(username)
+	now := time.Now()
+
+	var lockout LoginLockout
+	err := db.Where("scope = ? AND expires_at > ?", scope, now).
+		Where("(username = ? AND ip = '') OR (ip = ? AND username = '')", username, ip).
+		Order("expires_at desc").Limit(1).Find(&lockout).Error
+	if err != nil {
+		return LoginCheck{}, err
+	}
+	if lockout.ID != 0 {
+		return LoginCheck{Locked: true, RetryAt: lockout.ExpiresAt}, nil
+	}
+
+	var failures []LoginFailure
+	if err = db.Where("scope = ? AND username = ? AND created_at > ?", scope, username, now.Add(-LoginFailureWindow)).
+		Order("created_at").Find(&failures).Error; err != nil {
+		return LoginCheck{}, err
+	}
+	if len(failures) > 0 {
+		retryAt := failures[len(failures)-1].CreatedAt.Add(loginDelay(int64(len(failures))))
+		if retryAt.After(now) {
+			return LoginCheck{RetryAt: retryAt}, nil
+		}
+	}
+	return LoginCheck{Allowed: true}, nil
+}
+
+// RecordLoginFailure records a wrong password or unknown username and locks the username or address once they've had
+// too many failures
+func RecordLoginFailure(db *gorm.DB, scope LoginScope, username string, ip string) error {
+	username = normalizeLoginUsername(username)
+	now := time.Now()
+	if err := db.Create(&LoginFailure{Scope: scope, Username: username, IP: ip}).Error; err != nil {
+		return err
+	}
+
+	lock := func(column string, value string, limit int64, duration time.Duration) error {
+		var failures int64
+		if err := db.Model(&LoginFailure{}).Where("scope = ? AND created_at > ?", scope, now.Add(-LoginFailureWindow)).
+			Where(column+" = ?", value).Count(&failures).Error; err != nil {
+			return err
+		}
+		if failures < limit {
+			return nil
+		}
+		lockout := LoginLockout{Scope: scope, Failures: failures, ExpiresAt: now.Add(duration)}
+		if column == "username" {
+			lockout.Username = value
+		} else {
+			lockout.IP = value
+		}
+		if err := db.Create(&lockout).Error; err != nil {
+			return err
+		}
+		// The failures led to the lockout, start counting again once it expires
+		return db.Where("scope = ?", scope).Where(column+" = ?", value).Delete(&LoginFailure{}).Error
+	}
+
+	if err := lock("username", username, UsernameLockoutFailures, UsernameLockoutDuration); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return lock("ip", ip, IPLockoutFailures, IPLockoutDuration)
+}
+
+// RecordLoginSuccess resets the delays for the username, failures from the address still count towards its lockout
+func RecordLoginSuccess(db *gorm.DB, scope LoginScope, username string) error {
+	return db.Where("scope = ? AND username = ?", scope, normalizeLoginUsername(username)).Delete(&LoginFailure{}).Error
+}
+
+// ClearOldLoginFailures removes failures that no longer count towards delays or lockouts
+func ClearOldLoginFailures(db *gorm.DB) error {
+	return db.Where("created_at < ?", time.Now().Add(-LoginFailureWindow)).Delete(&LoginFailure{}).Error
+}
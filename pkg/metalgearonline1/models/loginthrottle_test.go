@@ -0,0 +1,26 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	cases := []struct {
+		failures int64
+		delay    time.Duration
+	}{
+		{0, 0},
+		{LoginDelayAfter - 1, 0},
+		{LoginDelayAfter, time.Second},
+		{LoginDelayAfter + 1, 2 * time.Second},
+		{LoginDelayAfter + 4, 16 * time.Second},
+		{LoginDelayAfter + 5, LoginMaxDelay},
+		{LoginDelayAfter + 100, LoginMaxDelay},
+	}
+	for _, c := range cases {
+		if delay := loginDelay(c.failures); delay != c.delay {
+			t.Errorf("Expected %d failures to wait %s, got %s", c.failures, c.delay, delay)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+func init() {
+	All = append(All, &OutboxEvent{}, &OutboxDelivery{})
+}
+
+// OutboxEvent is a game event waiting to be delivered to the event subscribers. It's written along with the change it
+// describes so it can't be lost if the gameserver or a subscriber goes down.
+type OutboxEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	LobbyID   uint      `gorm:"index"`
+	// GameID keeps the events of a game in order, events outside a game (0) have no ordering
+	GameID uint
+	UserID uint
+	Type   string `gorm:"size:32"`
+	// Version is the events schema version the payload was written with
+	Version int
+	Payload []byte
+}
+
+type OutboxDeliveryState string
+
+const (
+	OutboxPending   OutboxDeliveryState = "pending"
+	OutboxDelivered OutboxDeliveryState = "delivered"
+	// OutboxFailed deliveries ran out of attempts, they no longer hold up the events after them
+	OutboxFailed OutboxDeliveryState = "failed"
+)
+
+// OutboxDelivery tracks delivering an event to a single subscriber
+type OutboxDelivery struct {
+	ID            uint `gorm:"primaryKey"`
+	EventID       uint `gorm:"index"`
+	Event         OutboxEvent
+	Subscriber    string              `gorm:"size:64;index:idx_outbox_deliveries_pending"`
+	State         OutboxDeliveryState `gorm:"size:16;index:idx_outbox_deliveries_pending"`
+	Attempts      int
+	NextAttemptAt time.Time
+	DeliveredAt   time.Time
+	LastError     string
+}
@@ -1,7 +1,9 @@
 package models
 
 import (
+	"fmt"
 	"gorm.io/gorm"
+	"strings"
 	"tx55/pkg/metalgearonline1/types"
 )
 
@@ -16,6 +18,8 @@ type PlayerStats struct {
 	Mode   types.GameMode
 	Map    types.GameMap
 	Period types.PlayerStatsPeriod
+	// SeasonID is only set on PeriodArchive entries
+	SeasonID uint `gorm:"index"`
 
 	Rank               uint32
 	Kills              int32
@@ -120,3 +124,102 @@ func (s *PlayerStats) FromHostReportedStats(in types.HostReportedStats) {
 	s.PlayTime = in.PlayTime
 	return
 }
+
+// ApplyHostReportedStats adds the host reported stats to both the weekly and all-time entries for the user in the
+// given mode/map, creating them if they don't exist yet. It also stores the reported VS rating on the user, which
+// only becomes their actual rating when the host is the configured rating source. The returned bool indicates
+// whether new stats rows had to be created.
+func ApplyHostReportedStats(db *gorm.DB, userID uint, rules types.GameRules, stats types.HostReportedStats) (created bool, err error) {
+	ratingUpdates := map[string]interface{}{
+		"host_vs_rating": stats.VsRating,
+	}
+	if GetSetting(db, SettingVsRatingSource, DefaultVsRatingSource) == VsRatingSourceHost {
+		ratingUpdates["vs_rating"] = stats.VsRating
+	}
+	db.Model(&User{
+		Model: gorm.Model{ID: userID},
+	}).Updates(ratingUpdates)
+
+	updates := map[string]interface{}{
+		"kills":                gorm.Expr("kills + ?", stats.Kills),
+		"deaths":               gorm.Expr("deaths + ?", stats.Deaths),
+		"stuns":                gorm.Expr("stuns + ?", stats.Stuns),
+		"stuns_received":       gorm.Expr("stuns_received + ?", stats.StunsReceived),
+		"snake_frags":          gorm.Expr("snake_frags + ?", stats.SnakeFrags),
+		"points":               gorm.Expr("points + ?", stats.Points),
+		"suicides":             gorm.Expr("suicides + ?", stats.Suicides),
+		"self_stuns":           gorm.Expr("self_stuns + ?", stats.SelfStuns),
+		"team_kills":           gorm.Expr("team_kills + ?", stats.TeamKills),
+		"team_stuns":           gorm.Expr("team_stuns + ?", stats.TeamStuns),
+		"rounds_played":        gorm.Expr("rounds_played + ?", stats.RoundsPlayed),
+		"rounds_no_death":      gorm.Expr("rounds_no_death + ?", stats.RoundsNoDeath),
+		"kerotans_for_win":     gorm.Expr("kerotans_for_win + ?", stats.KerotansForWin),
+		"kerotans_placed":      gorm.Expr("kerotans_placed + ?", stats.KerotansPlaced),
+		"radio_uses":           gorm.Expr("radio_uses + ?", stats.RadioUses),
+		"text_chat_uses":       gorm.Expr("text_chat_uses + ?", stats.TextChatUses),
+		"cqc_attacks":          gorm.Expr("cqc_attacks + ?", stats.CQCAttacks),
+		"cqc_attacks_received": gorm.Expr("cqc_attacks_received + ?", stats.CQCAttacksReceived),
+		"head_shots":           gorm.Expr("head_shots + ?", stats.HeadShots),
+		"head_shots_received":  gorm.Expr("head_shots_received + ?", stats.HeadShotsReceived),
+		"team_wins":            gorm.Expr("team_wins + ?", stats.TeamWins),
+		"kills_with_scorpion":  gorm.Expr("kills_with_scorpion + ?", stats.KillsWithScorpion),
+		"kills_with_knife":     gorm.Expr("kills_with_knife + ?", stats.KillsWithKnife),
+		"times_eaten":          gorm.Expr("times_eaten + ?", stats.TimesEaten),
+		"rolls":                gorm.Expr("rolls + ?", stats.Rolls),
+		"infrared_goggle_uses": gorm.Expr("infrared_goggle_uses + ?", stats.InfraredGoggleUses),
+		"play_time":            gorm.Expr("play_time + ?", stats.PlayTime),
+	}
+
+	// sqlite uses MAX(...) whereas others reserve MAX(...) for aggregates
+	switch strings.ToLower(db.Dialector.Name()) {
+	case "sqlite3":
+		fallthrough
+	case "sqlite":
+		updates["kill_streak"] = gorm.Expr("MAX(kill_streak, ?)", stats.KillStreak)
+		updates["death_streak"] = gorm.Expr("MAX(death_streak, ?)", stats.DeathStreak)
+	case "mssql":
+		fallthrough
+	case "postgres":
+		fallthrough
+	case "mysql":
+		updates["kill_streak"] = gorm.Expr("GREATEST(kill_streak, ?)", stats.KillStreak)
+		updates["death_streak"] = gorm.Expr("GREATEST(death_streak, ?)", stats.DeathStreak)
+	default:
+		err = fmt.Errorf("unknown dialect: %s", db.Dialector.Name())
+		return
+	}
+
+	tx := db.Model(&PlayerStats{})
+	tx = tx.Where("user_id = ? AND mode = ? AND map = ?", userID, rules.Mode, rules.Map)
+	tx = tx.Where("period IN ?", []types.PlayerStatsPeriod{types.PeriodWeekly, types.PeriodAllTime})
+	tx = tx.Updates(updates)
+
+	if tx.Error != nil {
+		// I don't believe we can get a ErrRecordNotFound with an UPDATE
+		err = tx.Error
+		return
+	}
+
+	if tx.RowsAffected < 2 {
+		created = true
+
+		newStats := PlayerStats{
+			UserID: userID,
+			Mode:   rules.Mode,
+			Map:    rules.Map,
+			Period: types.PeriodWeekly,
+		}
+		newStats.FromHostReportedStats(stats)
+		db.Create(&newStats)
+
+		newStats = PlayerStats{
+			UserID: userID,
+			Mode:   rules.Mode,
+			Map:    rules.Map,
+			Period: types.PeriodAllTime,
+		}
+		newStats.FromHostReportedStats(stats)
+		db.Create(&newStats)
+	}
+	return
+}
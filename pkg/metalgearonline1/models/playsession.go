@@ -0,0 +1,175 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+func init() {
+	All = append(All, &PlaySession{})
+}
+
+// DefaultPlaySessionStaleAfter is how long since its last heartbeat an open session still counts as live
+const DefaultPlaySessionStaleAfter = 3 * time.Minute
+
+// PlaySession is a player's time connected to a lobby, from logging in until they disconnect
+type PlaySession struct {
+	ID      uint `gorm:"primaryKey"`
+	UserID  uint `gorm:"index"`
+	User    User
+	LobbyID uint `gorm:"index"`
+	// SessionID is the gameserver's id of the connection, it's only unique while the lobby is running
+	SessionID string    `gorm:"size:36"`
+	IP        string    `gorm:"size:45"`
+	StartedAt time.Time `gorm:"index"`
+	// EndedAt is null while the player is still connected
+	EndedAt *time.Time `gorm:"index"`
+	// HeartbeatAt is updated by the lobby while the session is open, an open session with an old heartbeat belongs to
+	// a lobby that stopped without closing it
+	HeartbeatAt time.Time
+	Seconds     int64
+	// Interrupted sessions were still open when their lobby restarted, they're ended when it came back up
+	Interrupted bool
+	// TakenOver sessions were ended because the user logged in again elsewhere
+	TakenOver bool
+}
+
+// Online is true while the session is open and its lobby marked it alive within staleAfter
+func (p *PlaySession) Online(staleAfter time.Duration) bool {
+	return p.EndedAt == nil && time.Since(p.HeartbeatAt) < staleAfter
+}
+
+// Duration is how long the session lasted, or has lasted so far while it's online. An open session whose lobby stopped
+// marking it alive only counts up to its last heartbeat.
+func (p *PlaySession) Duration(staleAfter time.Duration) time.Duration {
+	if p.EndedAt != nil {
+		return p.EndedAt.Sub(p.StartedAt)
+	}
+	if p.Online(staleAfter) {
+		return time.Since(p.StartedAt)
+	}
+	return p.HeartbeatAt.Sub(p.StartedAt)
+}
+
+func StartPlaySession(db *gorm.DB, userID uint, lobbyID uint, sessionID string, ip string) (*PlaySession, error) {
+	now := time.Now()
+	p := &PlaySession{
+		UserID:      userID,
+		LobbyID:     lobbyID,
+		SessionID:   sessionID,
+		IP:          ip,
+		StartedAt:   now,
+		HeartbeatAt: now,
+	}
+	return p, db.Create(p).Error
+}
+
+// End closes the session, it does nothing if the session was already closed
+func (p *PlaySession) End(db *gorm.DB, interrupted bool) error {
+	p.Interrupted = interrupted
+	return p.end(db, map[string]interface{}{"interrupted": interrupted})
+}
+
+// TakeOver ends a session replaced by a newer login and asks its lobby to disconnect it, which closes any game it
+// was hosting
+func (p *PlaySession) TakeOver(db *gorm.DB, by string) error {
+	p.TakenOver = true
+	if err := p.end(db, map[string]interface{}{"taken_over": true}); err != nil {
+		return err
+	}
+	return db.Create(&ServerCommand{
+		LobbyID:   uint32(p.LobbyID),
+		Command:   CommandEndSession,
+		SessionID: p.SessionID,
+		CreatedBy: by,
+	}).Error
+}
+
+func (p *PlaySession) end(db *gorm.DB, fields map[string]interface{}) error {
+	if p.EndedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	p.EndedAt = &now
+	p.Seconds = int64(now.Sub(p.StartedAt).Seconds())
+	fields["ended_at"] = p.EndedAt
+	fields["seconds"] = p.Seconds
+	return db.Model(p).Where("ended_at IS NULL").Updates(fields).Error
+}
+
+// TouchLobbyPlaySessions marks the open sessions of a lobby as still alive
+func TouchLobbyPlaySessions(db *gorm.DB, lobbyID uint) error {
+	return db.Model(&PlaySession{}).Where("lobby_id = ? AND ended_at IS NULL", lobbyID).Update("heartbeat_at", time.Now()).Error
+}
+
+// LiveGamePlaySessions finds a user's open sessions in game lobbies that started before the session with the given id
+// and whose lobby marked them alive within staleAfter, oldest first
+func LiveGamePlaySessions(db *gorm.DB, userID uint, beforeID uint, staleAfter time.Duration) (out []PlaySession, err error) {
+	err = db.Where("user_id = ? AND id < ? AND ended_at IS NULL AND heartbeat_at > ?", userID, beforeID, time.Now().Add(-staleAfter)).
+		Where("lobby_id IN (?)", db.Model(&Lobby{}).Select("id").Where("type = ?", types.LobbyTypeGame)).
+		Order("id").Find(&out).Error
+	return
+}
+
+// EndLobbyPlaySessions closes the sessions a lobby left open when it stopped without its players disconnecting
+func EndLobbyPlaySessions(db *gorm.DB, lobbyID uint) error {
+	var open []PlaySession
+	if err := db.Where("lobby_id = ? AND ended_at IS NULL", lobbyID).Find(&open).Error; err != nil {
+		return err
+	}
+	for i := range open {
+		if err := open[i].End(db, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type PlayTime struct {
+	Sessions int64
+	// Seconds includes the time so far of the open sessions, up to the last heartbeat of the stale ones
+	Seconds   int64
+	Online    bool
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// UserPlayTime totals the time a user has been connected to any lobby, open sessions without a heartbeat within
+// staleAfter don't count as online
+func UserPlayTime(db *gorm.DB, userID uint, staleAfter time.Duration) (out PlayTime, err error) {
+	err = db.Model(&PlaySession{}).Select("COUNT(*) AS sessions, COALESCE(SUM(seconds), 0) AS seconds").
+		Where("user_id = ? AND ended_at IS NOT NULL", userID).Scan(&out).Error
+	if err != nil {
+		return
+	}
+
+	var first, last PlaySession
+	if err = db.Where("user_id = ?", userID).Order("started_at").Limit(1).Find(&first).Error; err != nil {
+		return
+	}
+	out.FirstSeen = first.StartedAt
+	err = db.Where("user_id = ? AND ended_at IS NOT NULL", userID).Order("ended_at desc").Limit(1).Find(&last).Error
+	if err != nil {
+		return
+	}
+	if last.EndedAt != nil {
+		out.LastSeen = *last.EndedAt
+	}
+
+	var open []PlaySession
+	if err = db.Where("user_id = ? AND ended_at IS NULL", userID).Find(&open).Error; err != nil {
+		return
+	}
+	for _, p := range open {
+		out.Sessions++
+		out.Seconds += int64(p.Duration(staleAfter).Seconds())
+		if p.Online(staleAfter) {
+			out.Online = true
+			out.LastSeen = time.Now()
+		} else if p.HeartbeatAt.After(out.LastSeen) {
+			out.LastSeen = p.HeartbeatAt
+		}
+	}
+	return
+}
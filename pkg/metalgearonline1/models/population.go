@@ -0,0 +1,182 @@
+package models
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+func init() {
+	All = append(All, &PopulationSample{})
+}
+
+type PopulationKind string
+
+const (
+	// PopulationLobby samples have a lobby's player count and how many games it has
+	PopulationLobby PopulationKind = "lobby"
+	// PopulationRound samples have the games in a lobby playing a mode and map and how many players are in them
+	PopulationRound PopulationKind = "round"
+)
+
+// PopulationSample is a row of a snapshot of the lobbies, every sample taken at the same time shares its SampledAt
+type PopulationSample struct {
+	ID        uint           `gorm:"primaryKey"`
+	SampledAt time.Time      `gorm:"index"`
+	Kind      PopulationKind `gorm:"size:16;index"`
+	LobbyID   uint           `gorm:"index"`
+	Mode      string         `gorm:"size:16"`
+	Map       string         `gorm:"size:32"`
+	Players   uint
+	Games     uint
+}
+
+// SamplePopulation snapshots the players in each game lobby and the rounds being played in its games
+func SamplePopulation(db *gorm.DB, at time.Time) error {
+	var lobbies []Lobby
+	if err := db.Where("type = ?", types.LobbyTypeGame).Find(&lobbies).Error; err != nil {
+		return err
+	}
+	var games []Game
+	if err := db.Preload("GameOptions").Find(&games).Error; err != nil {
+		return err
+	}
+	var players []struct {
+		GameID  uint
+		Players uint
+	}
+	if err := db.Model(&GamePlayers{}).Select("game_id, COUNT(*) AS players").Group("game_id").Scan(&players).Error; err != nil {
+		return err
+	}
+	playersIn := make(map[uint]uint, len(players))
+	for _, p := range players {
+		playersIn[p.GameID] = p.Players
+	}
+
+	var samples []PopulationSample
+	lobbyGames := make(map[uint]uint)
+	rounds := make(map[string]*PopulationSample)
+	for _, game := range games {
+		lobbyGames[game.LobbyID]++
+		mode, gameMap := "unknown", "unknown"
+		if rules := game.GameOptions.Rules; int(game.CurrentRound) < len(rules) {
+			mode = string(rules[game.CurrentRound].Mode.String())
+			gameMap = string(rules[game.CurrentRound].Map.String())
+		}
+		key := fmt.Sprintf("%d/%s/%s", game.LobbyID, mode, gameMap)
+		round, found := rounds[key]
+		if !found {
+			round = &PopulationSample{SampledAt: at, Kind: PopulationRound, LobbyID: game.LobbyID, Mode: mode, Map: gameMap}
+			rounds[key] = round
+		}
+		round.Games++
+		round.Players += playersIn[game.ID]
+	}
+	for _, lobby := range lobbies {
+		samples = append(samples, PopulationSample{
+			SampledAt: at,
+			Kind:      PopulationLobby,
+			LobbyID:   uint(lobby.ID),
+			Players:   uint(lobby.Players),
+			Games:     lobbyGames[uint(lobby.ID)],
+		})
+	}
+	for _, round := range rounds {
+		samples = append(samples, *round)
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	return db.Create(&samples).Error
+}
+
+// ClearOldPopulationSamples removes the samples taken more than days ago
+func ClearOldPopulationSamples(db *gorm.DB, days int) error {
+	return db.Where("sampled_at < ?", time.Now().AddDate(0, 0, -days)).Delete(&PopulationSample{}).Error
+}
+
+// PopulationTotal is the players and games of every lobby at a single sample
+type PopulationTotal struct {
+	SampledAt time.Time
+	Players   uint
+	Games     uint
+}
+
+// PopulationTotals sums the lobbies of each sample taken in [from, to), oldest first. A lobby id of 0 sums every lobby.
+func PopulationTotals(db *gorm.DB, from time.Time, to time.Time, lobbyID uint) (out []PopulationTotal, err error) {
+	q := db.Model(&PopulationSample{}).Select("sampled_at, SUM(players) AS players, SUM(games) AS games").
+		Where("kind = ? AND sampled_at >= ? AND sampled_at < ?", PopulationLobby, from, to)
+	if lobbyID != 0 {
+		q = q.Where("lobby_id = ?", lobbyID)
+	}
+	err = q.Group("sampled_at").Order("sampled_at").Scan(&out).Error
+	return
+}
+
+// PopulationBucket aggregates the samples taken within an hour or a day
+type PopulationBucket struct {
+	Start       time.Time
+	Samples     int
+	AvgPlayers  float64
+	PeakPlayers uint
+	AvgGames    float64
+	PeakGames   uint
+}
+
+// BucketPopulation groups the totals into buckets of the given size, in UTC. The totals must be oldest first.
+func BucketPopulation(totals []PopulationTotal, size time.Duration) []PopulationBucket {
+	var out []PopulationBucket
+	for _, t := range totals {
+		start := t.SampledAt.UTC().Truncate(size)
+		if len(out) == 0 || !out[len(out)-1].Start.Equal(start) {
+			out = append(out, PopulationBucket{Start: start})
+		}
+		b := &out[len(out)-1]
+		b.Samples++
+		b.AvgPlayers += float64(t.Players)
+		b.AvgGames += float64(t.Games)
+		if t.Players > b.PeakPlayers {
+			b.PeakPlayers = t.Players
+		}
+		if t.Games > b.PeakGames {
+			b.PeakGames = t.Games
+		}
+	}
+	for i := range out {
+		out[i].AvgPlayers /= float64(out[i].Samples)
+		out[i].AvgGames /= float64(out[i].Samples)
+	}
+	return out
+}
+
+// Popularity is how often a mode and map were being played across the samples
+type Popularity struct {
+	Mode string
+	Map  string
+	// Games is the number of games playing it summed over every sample, so a game counts once for each sample it
+	// was seen in
+	Games   uint
+	Players uint
+}
+
+// RoundPopularity totals the rounds sampled in [from, to) by mode and map, most played first. A lobby id of 0 totals
+// every lobby.
+func RoundPopularity(db *gorm.DB, from time.Time, to time.Time, lobbyID uint) (out []Popularity, err error) {
+	q := db.Model(&PopulationSample{}).Select("mode, map, SUM(games) AS games, SUM(players) AS players").
+		Where("kind = ? AND sampled_at >= ? AND sampled_at < ?", PopulationRound, from, to)
+	if lobbyID != 0 {
+		q = q.Where("lobby_id = ?", lobbyID)
+	}
+	if err = q.Group("mode, map").Scan(&out).Error; err != nil {
+		return
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Games != out[j].Games {
+			return out[i].Games > out[j].Games
+		}
+		return out[i].Mode+out[i].Map < out[j].Mode+out[j].Map
+	})
+	return
+}
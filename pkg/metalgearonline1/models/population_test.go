@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketPopulation(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	totals := []PopulationTotal{
+		{SampledAt: start, Players: 10, Games: 2},
+		{SampledAt: start.Add(30 * time.Minute), Players: 20, Games: 4},
+		{SampledAt: start.Add(time.Hour), Players: 5, Games: 1},
+	}
+
+	hourly := BucketPopulation(totals, time.Hour)
+	if len(hourly) != 2 {
+		t.Fatalf("Expected 2 hourly buckets, got %d", len(hourly))
+	}
+	if b := hourly[0]; !b.Start.Equal(start) || b.Samples != 2 || b.AvgPlayers != 15 || b.PeakPlayers != 20 || b.AvgGames != 3 || b.PeakGames != 4 {
+		t.Errorf("Unexpected first hour %+v", b)
+	}
+	if b := hourly[1]; !b.Start.Equal(start.Add(time.Hour)) || b.Samples != 1 || b.PeakPlayers != 5 {
+		t.Errorf("Unexpected second hour %+v", b)
+	}
+
+	daily := BucketPopulation(totals, 24*time.Hour)
+	if len(daily) != 1 || daily[0].Samples != 3 || daily[0].PeakPlayers != 20 || !daily[0].Start.Equal(start.Truncate(24*time.Hour)) {
+		t.Errorf("Unexpected daily buckets %+v", daily)
+	}
+}
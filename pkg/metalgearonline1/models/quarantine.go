@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+func init() {
+	All = append(All, &QuarantinedStats{})
+}
+
+type QuarantineStatus byte
+
+const (
+	QuarantinePending  QuarantineStatus = 0
+	QuarantineApproved QuarantineStatus = 1
+	QuarantineRejected QuarantineStatus = 2
+)
+
+func (q QuarantineStatus) String() string {
+	switch q {
+	case QuarantinePending:
+		return "pending"
+	case QuarantineApproved:
+		return "approved"
+	case QuarantineRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// QuarantinedStats holds a host-reported stats submission that tripped one of the anomaly rules. The stats are
+// not applied to the player until an admin approves the entry.
+type QuarantinedStats struct {
+	gorm.Model
+	UserID uint `gorm:"index"`
+	User   User
+	// HostID is the user that was hosting the game and reported these stats
+	HostID uint `gorm:"index"`
+	Host   User `gorm:"foreignKey:HostID"`
+	GameID uint
+	Mode   types.GameMode
+	Map    types.GameMap
+	// Stats is the JSON encoded types.HostReportedStats as it was received
+	Stats string `gorm:"type:text"`
+	// Reasons is a newline separated list of the rules that flagged this submission
+	Reasons    string `gorm:"type:text"`
+	Status     QuarantineStatus
+	ReviewedBy string
+	ReviewedAt time.Time
+}
+
+func (q *QuarantinedStats) SetStats(stats types.HostReportedStats) error {
+	bs, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	q.Stats = string(bs)
+	return nil
+}
+
+func (q *QuarantinedStats) HostReportedStats() (out types.HostReportedStats, err error) {
+	err = json.Unmarshal([]byte(q.Stats), &out)
+	return
+}
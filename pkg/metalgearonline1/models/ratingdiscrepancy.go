@@ -0,0 +1,19 @@
+package models
+
+import "gorm.io/gorm"
+
+func init() {
+	All = append(All, &RatingDiscrepancy{})
+}
+
+// RatingDiscrepancy is recorded when the VS rating a host reported for a player is too far from the server's rating
+type RatingDiscrepancy struct {
+	gorm.Model
+	UserID       uint `gorm:"index"`
+	User         User
+	HostID       uint
+	Host         User `gorm:"foreignKey:HostID"`
+	GameID       uint
+	HostRating   uint
+	ServerRating uint
+}
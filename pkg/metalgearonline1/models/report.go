@@ -0,0 +1,71 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	All = append(All, &PlayerReport{})
+}
+
+type ReportCategory string
+
+const (
+	ReportCheating      ReportCategory = "cheating"
+	ReportHarassment    ReportCategory = "harassment"
+	ReportOffensiveName ReportCategory = "offensive_name"
+	ReportGriefing      ReportCategory = "griefing"
+	ReportOther         ReportCategory = "other"
+)
+
+var ReportCategories = []ReportCategory{ReportCheating, ReportHarassment, ReportOffensiveName, ReportGriefing, ReportOther}
+
+func (r ReportCategory) Valid() bool {
+	for _, c := range ReportCategories {
+		if c == r {
+			return true
+		}
+	}
+	return false
+}
+
+type ReportStatus byte
+
+const (
+	ReportOpen      ReportStatus = 0
+	ReportActioned  ReportStatus = 1
+	ReportDismissed ReportStatus = 2
+)
+
+func (r ReportStatus) String() string {
+	switch r {
+	case ReportOpen:
+		return "open"
+	case ReportActioned:
+		return "actioned"
+	case ReportDismissed:
+		return "dismissed"
+	default:
+		return "unknown"
+	}
+}
+
+// PlayerReport is a player reporting another player to the admins
+type PlayerReport struct {
+	gorm.Model
+	ReporterID uint `gorm:"index"`
+	Reporter   User `gorm:"foreignKey:ReporterID"`
+	TargetID   uint `gorm:"index"`
+	Target     User `gorm:"foreignKey:TargetID"`
+	// GameID is the game the report is about, 0 if it isn't about a specific game
+	GameID   uint
+	Category ReportCategory `gorm:"size:32"`
+	Body     string         `gorm:"type:text"`
+	Status   ReportStatus   `gorm:"index"`
+	// BanID is the ban that resulted from the report, if any
+	BanID      uint
+	Resolution string `gorm:"type:text"`
+	ResolvedBy string
+	ResolvedAt time.Time
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	All = append(All, &Season{})
+}
+
+type SeasonKind byte
+
+const (
+	SeasonWeekly    SeasonKind = 0
+	SeasonMonthly   SeasonKind = 1
+	SeasonQuarterly SeasonKind = 2
+	SeasonInvalid   SeasonKind = 255
+)
+
+func (k SeasonKind) String() string {
+	switch k {
+	case SeasonWeekly:
+		return "weekly"
+	case SeasonMonthly:
+		return "monthly"
+	case SeasonQuarterly:
+		return "quarterly"
+	default:
+		return "invalid"
+	}
+}
+
+func SeasonKindFromString(s string) SeasonKind {
+	switch s {
+	case "weekly":
+		return SeasonWeekly
+	case "monthly":
+		return SeasonMonthly
+	case "quarterly":
+		return SeasonQuarterly
+	default:
+		return SeasonInvalid
+	}
+}
+
+// Season is a finished stats period. The stats for it are kept in player_stats as PeriodArchive rows with a matching
+// SeasonID, including the ranks players had when it ended.
+type Season struct {
+	gorm.Model
+	Name      string `gorm:"size:64"`
+	Kind      SeasonKind
+	StartedAt time.Time
+	EndedAt   time.Time
+}
@@ -0,0 +1,40 @@
+package models
+
+import "gorm.io/gorm"
+
+func init() {
+	All = append(All, &ServerCommand{}, &BanEnforcement{})
+}
+
+type ServerCommandType string
+
+const (
+	// CommandEnforceBan disconnects every session matching the ban in ServerCommand.BanID
+	CommandEnforceBan ServerCommandType = "enforce_ban"
+	// CommandEndSession disconnects the session in ServerCommand.SessionID
+	CommandEndSession ServerCommandType = "end_session"
+)
+
+// ServerCommand is a queue of work for the running gameservers. Each gameserver polls for commands newer than the
+// last one it saw, so every lobby handles every command once.
+type ServerCommand struct {
+	gorm.Model
+	// LobbyID limits the command to a single lobby, 0 is every lobby
+	LobbyID   uint32
+	Command   ServerCommandType `gorm:"size:32"`
+	BanID     uint
+	SessionID string `gorm:"size:36"`
+	CreatedBy string
+}
+
+// BanEnforcement records a connected session being disconnected because of a ban
+type BanEnforcement struct {
+	gorm.Model
+	BanID   uint `gorm:"index"`
+	Ban     Ban
+	UserID  uint `gorm:"index"`
+	LobbyID uint32
+	IP      string `gorm:"size:64"`
+	// GameID is the game the session was hosting, which was closed along with the session
+	GameID uint
+}
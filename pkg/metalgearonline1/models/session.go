@@ -1,6 +1,8 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"time"
@@ -10,11 +12,21 @@ func init() {
 	All = append(All, &Session{})
 }
 
+// DefaultSessionLifetime is how long a session lasts without being used
+const DefaultSessionLifetime = 14 * 24 * time.Hour
+
+// Session is handed to the game on a login with credentials, the game uses it to log into each lobby after that
 type Session struct {
 	ID        uuid.UUID `gorm:"primary_key"`
 	CreatedAt time.Time
-	UserID    uint
+	UserID    uint `gorm:"index"`
 	User      User
+	// LastUsedAt is when the session was last used to log into a lobby
+	LastUsedAt time.Time
+	// LastIP is the address the session was last used from
+	LastIP string `gorm:"size:45"`
+	// ExpiresAt is pushed back every time the session is used
+	ExpiresAt time.Time `gorm:"index"`
 }
 
 func (s *Session) BeforeCreate(_ *gorm.DB) error {
@@ -23,3 +35,49 @@ func (s *Session) BeforeCreate(_ *gorm.DB) error {
 	}
 	return nil
 }
+
+func (s *Session) Expired() bool {
+	return !s.ExpiresAt.After(time.Now())
+}
+
+// Handle identifies the session to its user without revealing the id, which is all the game needs to log in with it
+func (s *Session) Handle() string {
+	sum := sha256.Sum256(s.ID[:])
+	return hex.EncodeToString(sum[:8])
+}
+
+// NewSession creates a session for the user that expires unless it's used within lifetime
+func NewSession(db *gorm.DB, userID uint, ip string, lifetime time.Duration) (*Session, error) {
+	now := time.Now()
+	s := &Session{
+		UserID:     userID,
+		LastUsedAt: now,
+		LastIP:     ip,
+		ExpiresAt:  now.Add(lifetime),
+	}
+	return s, db.Create(s).Error
+}
+
+// Renew records the session being used and extends it by lifetime
+func (s *Session) Renew(db *gorm.DB, ip string, lifetime time.Duration) error {
+	now := time.Now()
+	s.LastUsedAt = now
+	s.LastIP = ip
+	s.ExpiresAt = now.Add(lifetime)
+	return db.Model(s).Updates(map[string]interface{}{
+		"last_used_at": s.LastUsedAt,
+		"last_ip":      s.LastIP,
+		"expires_at":   s.ExpiresAt,
+	}).Error
+}
+
+// RevokeUserSessions removes every session of the user, the game has to log in with credentials again
+func RevokeUserSessions(db *gorm.DB, userID uint) (int64, error) {
+	tx := db.Where("user_id = ?", userID).Delete(&Session{})
+	return tx.RowsAffected, tx.Error
+}
+
+// ClearExpiredSessions removes the sessions that can no longer be used
+func ClearExpiredSessions(db *gorm.DB) error {
+	return db.Where("expires_at <= ?", time.Now()).Delete(&Session{}).Error
+}
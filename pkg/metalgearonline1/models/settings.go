@@ -0,0 +1,38 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	All = append(All, &Setting{})
+}
+
+// Setting is a simple name/value store for options admins can change at runtime that the gameservers need to see
+type Setting struct {
+	Name      string `gorm:"primaryKey;size:64"`
+	Value     string `gorm:"size:255"`
+	UpdatedAt time.Time
+}
+
+const (
+	// SettingVsRatingSource is either VsRatingSourceServer or VsRatingSourceHost
+	SettingVsRatingSource = "vs_rating_source"
+	VsRatingSourceServer  = "server"
+	VsRatingSourceHost    = "host"
+	DefaultVsRatingSource = VsRatingSourceServer
+)
+
+// GetSetting returns the stored value for the setting, or the fallback if it has never been set
+func GetSetting(db *gorm.DB, name, fallback string) string {
+	var setting Setting
+	if err := db.Where("name = ?", name).Limit(1).Find(&setting).Error; err != nil || setting.Name == "" {
+		return fallback
+	}
+	return setting.Value
+}
+
+func SetSetting(db *gorm.DB, name, value string) error {
+	return db.Save(&Setting{Name: name, Value: value}).Error
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	All = append(All, &StreamEvent{})
+}
+
+// StreamEvent is an event the REST API received and streamed to its clients, its ID is the stream id clients replay
+// and page from
+type StreamEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	// SourceID is the gameserver's outbox id, a redelivered event has the same one and isn't stored twice. It's 0 for
+	// events the REST API created itself.
+	SourceID uint   `gorm:"index:idx_stream_events_source"`
+	Lobby    uint   `gorm:"index:idx_stream_events_source;index"`
+	GameID   uint   `gorm:"index"`
+	UserID   uint   `gorm:"index"`
+	Type     string `gorm:"size:32;index"`
+	Version  int
+	Data     []byte
+}
+
+// ClearOldStreamEvents removes the events created more than days ago
+func ClearOldStreamEvents(db *gorm.DB, days int) error {
+	return db.Where("created_at < ?", time.Now().AddDate(0, 0, -days)).Delete(&StreamEvent{}).Error
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"bytes"
 	"crypto/md5"
 	"errors"
 	"golang.org/x/crypto/bcrypt"
@@ -20,18 +21,30 @@ type User struct {
 	gorm.Model
 	PreviousUpdatedAt time.Time
 	Username          []byte `gorm:"uniqueIndex,size:16"`
+	// UsernameCanonical is the case folded username used for lookups and uniqueness, see CanonicalUsername
+	UsernameCanonical []byte `gorm:"uniqueIndex;size:32"`
 	DisplayName       []byte `gorm:"uniqueIndex,size:16"`
-	Password          string `gorm:"type:varchar(128)"`
-	HasEmblem         bool
-	EmblemText        []byte `gorm:"size:16"`
-	OverallRank       uint
-	WeeklyRank        uint
-	VsRating          uint
-	VsRatingRank      uint
-	Sessions          []Session
-	PlayerSettings    PlayerSettings
-	Connections       []Connection
-	FBList            []UserList
+	// DisplayNameSkeleton is the display name with look-alike characters folded together, see DisplayNameSkeleton
+	DisplayNameSkeleton []byte `gorm:"index;size:16"`
+	// RegistrationIP is the address the account was registered from, it's used to limit registrations per address
+	RegistrationIP string `gorm:"size:45;index"`
+	Password       string `gorm:"type:varchar(128)"`
+	HasEmblem      bool
+	EmblemText     []byte `gorm:"size:16"`
+	OverallRank    uint
+	WeeklyRank     uint
+	// VsRating is the authoritative rating, copied from either HostVsRating or ServerVsRating depending on the
+	// vs_rating_source setting
+	VsRating uint
+	// HostVsRating is the last rating the host reported, kept only to compare against the server rating
+	HostVsRating uint
+	// ServerVsRating is calculated by the server from the round results
+	ServerVsRating uint
+	VsRatingRank   uint
+	Sessions       []Session
+	PlayerSettings PlayerSettings
+	Connections    []Connection
+	FBList         []UserList
 }
 
 // HashPassword will hash the password in the right format for MGO1 and then bcrypt it
@@ -81,13 +94,79 @@ func (u *User) BeforeCreate(_ *gorm.DB) error {
 	if len(u.Password) == 0 {
 		return errors.New("missing password")
 	}
+	u.UsernameCanonical = CanonicalUsername(u.Username)
+	u.DisplayNameSkeleton = DisplayNameSkeleton(u.DisplayName)
 	return u.hashIfNecessary()
 }
 
 func (u *User) BeforeUpdate(_ *gorm.DB) error {
+	if len(u.DisplayName) > 0 {
+		u.DisplayNameSkeleton = DisplayNameSkeleton(u.DisplayName)
+	}
 	return u.hashIfNecessary()
 }
 
+// CanonicalUsername folds the case of an ISO-8859-1 username, stopping at the first NUL like the game does. The
+// result is compared as binary so lookups and uniqueness behave the same on every database, whatever its collation.
+func CanonicalUsername(username []byte) []byte {
+	if i := bytes.IndexByte(username, 0); i >= 0 {
+		username = username[:i]
+	}
+	out := make([]byte, len(username))
+	for i, b := range username {
+		// A-Z and the accented capitals À-Þ, except the multiplication sign
+		if (b >= 'A' && b <= 'Z') || (b >= 0xC0 && b <= 0xDE && b != 0xD7) {
+			b += 0x20
+		}
+		out[i] = b
+	}
+	return out
+}
+
+// skeletonFolds maps the digits and symbols commonly swapped for letters, and the accented letters, to the plain
+// letter they look like. Capitals have already been folded by CanonicalUsername.
+var skeletonFolds = func() (folds [256]byte) {
+	for i := range folds {
+		folds[i] = byte(i)
+	}
+	for from, to := range map[string]byte{
+		"0òóôõöø":  'o',
+		"1!|lìíîï": 'i',
+		"3èéêë":    'e',
+		"4@àáâãäå": 'a',
+		"5$":       's',
+		"7+":       't',
+		"8ß":       'b',
+		"9":        'g',
+		"ùúûü":     'u',
+		"ýÿ":       'y',
+		"ñ":        'n',
+		"ç":        'c',
+	} {
+		for _, r := range from {
+			folds[byte(r)] = to
+		}
+	}
+	return
+}()
+
+// DisplayNameSkeleton reduces an ISO-8859-1 name to the letters it looks like: case, accents and leetspeak are folded
+// and everything but letters is dropped, so "Sn4ke" and "s n a k e" both become "snake". Names with the same skeleton
+// are too easily mistaken for each other in-game.
+func DisplayNameSkeleton(name []byte) []byte {
+	name = CanonicalUsername(name)
+	out := make([]byte, 0, len(name))
+	for _, b := range name {
+		b = skeletonFolds[b]
+		if (b >= 'a' && b <= 'z') || (b >= 0xDF && b != 0xF7) {
+			out = append(out, b)
+		}
+	}
+	// "rn" and "vv" pass for "m" and "w" in the game's font
+	out = bytes.ReplaceAll(out, []byte("rn"), []byte("m"))
+	return bytes.ReplaceAll(out, []byte("vv"), []byte("w"))
+}
+
 func (u *User) PlayerOverview() *types.PlayerOverview {
 	o := types.PlayerOverview{
 		UserID:          types.UserID(u.ID),
@@ -101,6 +180,14 @@ func (u *User) PlayerOverview() *types.PlayerOverview {
 	return &o
 }
 
+// SharedFingerprintAccounts are the other users that reported the same local address and port as this user
+func (u *User) SharedFingerprintAccounts(db *gorm.DB) []uint {
+	query := "SELECT DISTINCT c2.user_id\nFROM connections c1\nJOIN connections c2 ON c1.local_addr = c2.local_addr AND c1.local_port = c2.local_port AND c1.user_id <> c2.user_id\nWHERE c1.user_id = ? AND c1.local_addr <> '';"
+	var out []uint
+	db.Raw(query, u.ID).Scan(&out)
+	return out
+}
+
 func (u *User) SharedAccounts(db *gorm.DB) []uint {
 	query := "SELECT DISTINCT u2.id AS common_user_id\nFROM users u1\nJOIN connections c1 ON u1.id = c1.user_id\nJOIN connections c2 ON c1.remote_addr = c2.remote_addr AND c1.user_id <> c2.user_id\nJOIN users u2 ON c2.user_id = u2.id\nWHERE u1.id = ?;"
 	var out []uint
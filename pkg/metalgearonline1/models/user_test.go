@@ -0,0 +1,42 @@
+package models
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCanonicalUsername(t *testing.T) {
+	cases := []struct {
+		in, out []byte
+	}{
+		{[]byte("Snake"), []byte("snake")},
+		{[]byte("a_c%"), []byte("a_c%")},
+		{[]byte("OCELOT\x00\x00junk"), []byte("ocelot")},
+		// À and Þ fold, × does not
+		{[]byte{0xC0, 0xD7, 0xDE}, []byte{0xE0, 0xD7, 0xFE}},
+		{[]byte{}, []byte{}},
+	}
+	for _, c := range cases {
+		if out := CanonicalUsername(c.in); !bytes.Equal(out, c.out) {
+			t.Errorf("Expected %q to be %q, got %q", c.in, c.out, out)
+		}
+	}
+}
+
+func TestDisplayNameSkeleton(t *testing.T) {
+	for _, name := range []string{"Snake", "SN4KE", "s n a k e", "$nake", "5_n_4_k_3"} {
+		if out := DisplayNameSkeleton([]byte(name)); !bytes.Equal(out, []byte("snake")) {
+			t.Errorf("Expected %q to look like snake, got %q", name, out)
+		}
+	}
+	// Ê and é both become e
+	if !bytes.Equal(DisplayNameSkeleton([]byte{'R', 0xCA, 'X'}), DisplayNameSkeleton([]byte{'r', 0xE9, 'x'})) {
+		t.Error("Expected accents to be folded")
+	}
+	if !bytes.Equal(DisplayNameSkeleton([]byte("Bigboss")), DisplayNameSkeleton([]byte("B1gB0ss"))) {
+		t.Error("Expected leetspeak to be folded")
+	}
+	if !bytes.Equal(DisplayNameSkeleton([]byte("Meryl")), DisplayNameSkeleton([]byte("rneryI"))) {
+		t.Error("Expected look-alike letters to be folded")
+	}
+}
@@ -65,7 +65,8 @@ func GetPlayerStats(db *gorm.DB, UserID types.UserID) (allTimeStats, weeklyStats
 		var targetMode *types.GameTypeStatsWithRank
 		switch stat.Period {
 		case types.PeriodArchive:
-			fallthrough
+			// Archives are snapshots of stats that have already been counted in all-time
+			continue
 		case types.PeriodAllTime:
 			target = &allTimeStats
 		case types.PeriodWeekly:
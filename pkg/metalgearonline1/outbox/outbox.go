@@ -0,0 +1,312 @@
+package outbox
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"tx55/pkg/configurations"
+	"tx55/pkg/events"
+	"tx55/pkg/metalgearonline1/models"
+)
+
+const (
+	DefaultMaxAttempts   = 12
+	DefaultRetentionDays = 7
+	DefaultTimeout       = 10 * time.Second
+	// PollInterval is how often pending deliveries are checked when no new events have been queued
+	PollInterval = time.Second
+	// MaxBackoff caps the wait between attempts, the wait doubles after each failed attempt
+	MaxBackoff = 5 * time.Minute
+	batchSize  = 200
+)
+
+type subscriber struct {
+	configurations.EventSubscriber
+	client *http.Client
+	// wake is signalled when an event is queued so it's delivered without waiting for the next poll
+	wake chan struct{}
+}
+
+var (
+	subscribers   []*subscriber
+	maxAttempts   = DefaultMaxAttempts
+	retentionDays = DefaultRetentionDays
+)
+
+// Configure sets the subscribers events are queued for, it must be called before any events are queued
+func Configure(cfg configurations.EventsConfig) {
+	subscribers = nil
+	for _, sub := range cfg.Subscribers {
+		timeout := time.Duration(sub.TimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		subscribers = append(subscribers, &subscriber{
+			EventSubscriber: sub,
+			client:          &http.Client{Timeout: timeout},
+			wake:            make(chan struct{}, 1),
+		})
+	}
+
+	maxAttempts = cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	retentionDays = cfg.RetentionDays
+	if retentionDays <= 0 {
+		retentionDays = DefaultRetentionDays
+	}
+}
+
+// Enabled is false when there are no subscribers, events aren't queued at all
+func Enabled() bool {
+	return len(subscribers) > 0
+}
+
+// Queue writes the event and a delivery for every subscriber. Pass the transaction that makes the change the event
+// describes, so the event is only delivered if the change is committed.
+func Queue(db *gorm.DB, lobbyID uint, event events.Event) error {
+	if !Enabled() {
+		return nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		row := models.OutboxEvent{
+			LobbyID: lobbyID,
+			GameID:  events.GameIDOf(event),
+			UserID:  events.UserIDOf(event),
+			Type:    string(event.EventType()),
+			Version: events.Version,
+			Payload: payload,
+		}
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+		deliveries := make([]models.OutboxDelivery, len(subscribers))
+		for i, sub := range subscribers {
+			deliveries[i] = models.OutboxDelivery{
+				EventID:       row.ID,
+				Subscriber:    sub.Name,
+				State:         models.OutboxPending,
+				NextAttemptAt: row.CreatedAt,
+			}
+		}
+		return tx.Create(&deliveries).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subscribers {
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Sign returns the X-Event-Signature header for a delivery, subscribers should compare it with hmac.Equal
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff is the wait before the next attempt after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	if attempts > 20 {
+		return MaxBackoff
+	}
+	delay := time.Second << (attempts - 1)
+	if delay > MaxBackoff {
+		return MaxBackoff
+	}
+	return delay
+}
+
+// Dispatcher delivers the events of a single lobby, each lobby runs its own so they never compete for deliveries
+type Dispatcher struct {
+	DB      *gorm.DB
+	LobbyID uint
+	Log     logrus.FieldLogger
+}
+
+// Run delivers to every subscriber in its own goroutine so a slow subscriber doesn't hold up the others, it never
+// returns
+func (d *Dispatcher) Run() {
+	for _, sub := range subscribers {
+		go d.runSubscriber(sub)
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		d.clearOld()
+		<-ticker.C
+	}
+}
+
+func (d *Dispatcher) runSubscriber(sub *subscriber) {
+	l := d.Log.WithField("subscriber", sub.Name)
+	l.WithField("url", sub.URL).Info("Delivering events to subscriber")
+	for {
+		more, err := d.deliverPending(sub)
+		if err != nil {
+			l.WithError(err).Error("Failed to deliver events")
+		}
+		if more {
+			continue
+		}
+		select {
+		case <-sub.wake:
+		case <-time.After(PollInterval):
+		}
+	}
+}
+
+// deliverPending makes one attempt at each due delivery in event order. When a delivery to a game isn't due or fails,
+// the rest of the game's events wait for it. The pending deliveries are read in pages so a game that's waiting can't
+// hold up the rest of the lobby, more is true when a full batch was attempted.
+func (d *Dispatcher) deliverPending(sub *subscriber) (more bool, err error) {
+	blocked := map[uint]bool{}
+	attempted := 0
+	var after uint
+	for {
+		var deliveries []models.OutboxDelivery
+		err = d.DB.Preload("Event").
+			Where("subscriber = ? AND state = ? AND event_id > ?", sub.Name, models.OutboxPending, after).
+			Where("event_id IN (?)", d.DB.Model(&models.OutboxEvent{}).Select("id").Where("lobby_id = ?", d.LobbyID)).
+			Order("event_id").Limit(batchSize).Find(&deliveries).Error
+		if err != nil {
+			return false, err
+		}
+
+		for _, delivery := range deliveries {
+			after = delivery.EventID
+			gameID := delivery.Event.GameID
+			if gameID != 0 && blocked[gameID] {
+				continue
+			}
+			if delivery.NextAttemptAt.After(time.Now()) {
+				blocked[gameID] = true
+				continue
+			}
+
+			attempted++
+			if err = d.attempt(sub, &delivery, blocked); err != nil {
+				return false, err
+			}
+			if attempted == batchSize {
+				return true, nil
+			}
+		}
+		if len(deliveries) < batchSize {
+			return false, nil
+		}
+	}
+}
+
+// attempt sends the delivery once and records the outcome, its game is blocked if it has to be retried
+func (d *Dispatcher) attempt(sub *subscriber, delivery *models.OutboxDelivery, blocked map[uint]bool) error {
+	sendErr := d.send(sub, &delivery.Event)
+	delivery.Attempts++
+	updates := map[string]interface{}{"attempts": delivery.Attempts}
+	if sendErr == nil {
+		updates["state"] = models.OutboxDelivered
+		updates["delivered_at"] = time.Now()
+		updates["last_error"] = ""
+	} else {
+		lastError := sendErr.Error()
+		if len(lastError) > 255 {
+			lastError = lastError[:255]
+		}
+		updates["last_error"] = lastError
+		l := d.Log.WithError(sendErr).WithFields(logrus.Fields{
+			"subscriber": sub.Name,
+			"event_id":   delivery.EventID,
+			"attempts":   delivery.Attempts,
+		})
+		if delivery.Attempts >= maxAttempts {
+			l.Error("Giving up on delivering event")
+			updates["state"] = models.OutboxFailed
+		} else {
+			l.Warn("Failed to deliver event, it will be retried")
+			updates["next_attempt_at"] = time.Now().Add(backoff(delivery.Attempts))
+			blocked[delivery.Event.GameID] = true
+		}
+	}
+	return d.DB.Model(delivery).Updates(updates).Error
+}
+
+func (d *Dispatcher) send(sub *subscriber, event *models.OutboxEvent) error {
+	body, err := json.Marshal(events.Envelope{
+		ID:        event.ID,
+		Version:   event.Version,
+		Event:     events.Type(event.Type),
+		Lobby:     event.LobbyID,
+		GameID:    event.GameID,
+		UserID:    event.UserID,
+		CreatedAt: event.CreatedAt,
+		Data:      event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatUint(uint64(event.ID), 10))
+	req.Header.Set("X-Event-Timestamp", timestamp)
+	if sub.Secret != "" {
+		req.Header.Set("X-Event-Signature", Sign(sub.Secret, timestamp, body))
+	}
+
+	resp, err := sub.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("subscriber responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// clearOld removes events older than the retention period along with their deliveries, whether or not they were
+// delivered
+func (d *Dispatcher) clearOld() {
+	old := d.DB.Model(&models.OutboxEvent{}).Select("id").
+		Where("lobby_id = ? AND created_at < ?", d.LobbyID, time.Now().AddDate(0, 0, -retentionDays))
+	if err := d.DB.Where("event_id IN (?)", old).Delete(&models.OutboxDelivery{}).Error; err != nil {
+		d.Log.WithError(err).Error("Failed to clear old event deliveries")
+		return
+	}
+	if err := d.DB.Where("lobby_id = ? AND created_at < ?", d.LobbyID, time.Now().AddDate(0, 0, -retentionDays)).
+		Delete(&models.OutboxEvent{}).Error; err != nil {
+		d.Log.WithError(err).Error("Failed to clear old events")
+	}
+}
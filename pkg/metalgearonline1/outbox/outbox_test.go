@@ -0,0 +1,31 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:  0,
+		1:  time.Second,
+		2:  2 * time.Second,
+		5:  16 * time.Second,
+		9:  256 * time.Second,
+		10: MaxBackoff,
+		64: MaxBackoff,
+	}
+	for attempts, expected := range cases {
+		if delay := backoff(attempts); delay != expected {
+			t.Errorf("Expected %d attempts to wait %s, got %s", attempts, expected, delay)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"id":1}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11"
+	if got := Sign("secret", "1700000000", []byte(`{"id":1}`)); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,143 @@
+package rating
+
+import (
+	"math"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+const DefaultRating = 1000
+const DefaultKFactor = 32.0
+const DefaultDiscrepancyThreshold = 200
+
+// KFactor is the maximum rating change for a single round
+var KFactor = DefaultKFactor
+
+// DiscrepancyThreshold is how far the host-reported rating can drift from the server rating before it is flagged
+var DiscrepancyThreshold uint = DefaultDiscrepancyThreshold
+
+// Configure sets the package level options from the gameserver config, zero values keep the defaults
+func Configure(cfg configurations.VsRatingConfig) {
+	KFactor = DefaultKFactor
+	if cfg.KFactor > 0 {
+		KFactor = cfg.KFactor
+	}
+	DiscrepancyThreshold = DefaultDiscrepancyThreshold
+	if cfg.DiscrepancyThreshold > 0 {
+		DiscrepancyThreshold = cfg.DiscrepancyThreshold
+	}
+}
+
+// Participant is a single player's result for a round
+type Participant struct {
+	UserID uint
+	Rating uint
+	Team   types.Team
+	Points int32
+	// Won is set when the host reported a team win for this player
+	Won bool
+}
+
+// Expected is the standard Elo expected score of a player rated `a` against one rated `b`
+func Expected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Round calculates the rating change of every participant. Team modes are rated as the two teams against each other
+// using the reported team wins, deathmatch is rated as every player against every other player using their points.
+func Round(k float64, mode types.GameMode, participants []Participant) map[uint]int {
+	if mode == types.ModeDeathmatch {
+		return FreeForAll(k, participants)
+	}
+	return Teams(k, participants)
+}
+
+// Teams rates each player against the average rating of the opposing team. If both or neither team reported a win
+// the round is treated as a draw. Spectators and rounds with only one team are not rated.
+func Teams(k float64, participants []Participant) map[uint]int {
+	out := map[uint]int{}
+
+	type teamInfo struct {
+		total, count float64
+		won          bool
+	}
+	teams := map[types.Team]*teamInfo{}
+	for _, p := range participants {
+		if p.Team == types.TeamSpectator {
+			continue
+		}
+		t, found := teams[p.Team]
+		if !found {
+			t = &teamInfo{}
+			teams[p.Team] = t
+		}
+		t.total += float64(p.Rating)
+		t.count++
+		t.won = t.won || p.Won
+	}
+
+	if len(teams) != 2 {
+		return out
+	}
+
+	for _, p := range participants {
+		own, found := teams[p.Team]
+		if !found {
+			continue
+		}
+
+		var opponent *teamInfo
+		for team, t := range teams {
+			if team != p.Team {
+				opponent = t
+			}
+		}
+
+		score := 0.5
+		if own.won && !opponent.won {
+			score = 1
+		} else if opponent.won && !own.won {
+			score = 0
+		}
+
+		expected := Expected(float64(p.Rating), opponent.total/opponent.count)
+		out[p.UserID] = int(math.Round(k * (score - expected)))
+	}
+	return out
+}
+
+// FreeForAll rates every pair of players against each other by points, the K factor is split across the opponents
+// so a single round can't move a rating more than in a team round.
+func FreeForAll(k float64, participants []Participant) map[uint]int {
+	out := map[uint]int{}
+	if len(participants) < 2 {
+		return out
+	}
+
+	pairK := k / float64(len(participants)-1)
+	for i, a := range participants {
+		var delta float64
+		for j, b := range participants {
+			if i == j {
+				continue
+			}
+			score := 0.5
+			if a.Points > b.Points {
+				score = 1
+			} else if a.Points < b.Points {
+				score = 0
+			}
+			delta += pairK * (score - Expected(float64(a.Rating), float64(b.Rating)))
+		}
+		out[a.UserID] = int(math.Round(delta))
+	}
+	return out
+}
+
+// Apply adds the delta to the rating without letting it go below zero
+func Apply(rating uint, delta int) uint {
+	if delta < 0 && uint(-delta) > rating {
+		return 0
+	}
+	return uint(int(rating) + delta)
+}
@@ -0,0 +1,75 @@
+package rating
+
+import (
+	"testing"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+func TestExpected(t *testing.T) {
+	if e := Expected(1000, 1000); e != 0.5 {
+		t.Errorf("Expected equal ratings to give 0.5, got %f", e)
+	}
+	if e := Expected(1400, 1000); e < 0.9 || e > 0.92 {
+		t.Errorf("Expected a 400 point favourite to be ~0.91, got %f", e)
+	}
+}
+
+func TestTeams(t *testing.T) {
+	participants := []Participant{
+		{UserID: 1, Rating: 1000, Team: types.TeamRed, Won: true},
+		{UserID: 2, Rating: 1000, Team: types.TeamRed},
+		{UserID: 3, Rating: 1000, Team: types.TeamBlue},
+		{UserID: 4, Rating: 1000, Team: types.TeamBlue},
+		{UserID: 5, Rating: 1000, Team: types.TeamSpectator},
+	}
+
+	deltas := Teams(32, participants)
+	if deltas[1] != 16 || deltas[2] != 16 {
+		t.Errorf("Expected winners to gain 16, got %d and %d", deltas[1], deltas[2])
+	}
+	if deltas[3] != -16 || deltas[4] != -16 {
+		t.Errorf("Expected losers to lose 16, got %d and %d", deltas[3], deltas[4])
+	}
+	if _, found := deltas[5]; found {
+		t.Errorf("Expected spectators to not be rated")
+	}
+
+	// Neither team winning is a draw
+	participants[0].Won = false
+	deltas = Teams(32, participants)
+	if deltas[1] != 0 || deltas[3] != 0 {
+		t.Errorf("Expected a draw between equal teams to be 0, got %d and %d", deltas[1], deltas[3])
+	}
+
+	// One team only can't be rated
+	deltas = Teams(32, participants[:2])
+	if len(deltas) != 0 {
+		t.Errorf("Expected no changes for a single team, got %d", len(deltas))
+	}
+}
+
+func TestFreeForAll(t *testing.T) {
+	participants := []Participant{
+		{UserID: 1, Rating: 1000, Points: 10},
+		{UserID: 2, Rating: 1000, Points: 5},
+		{UserID: 3, Rating: 1000, Points: 0},
+	}
+
+	deltas := FreeForAll(32, participants)
+	if deltas[1] != 16 || deltas[2] != 0 || deltas[3] != -16 {
+		t.Errorf("Unexpected deltas %v", deltas)
+	}
+
+	if deltas := FreeForAll(32, participants[:1]); len(deltas) != 0 {
+		t.Errorf("Expected no changes for a single player")
+	}
+}
+
+func TestApply(t *testing.T) {
+	if r := Apply(1000, -16); r != 984 {
+		t.Errorf("Expected 984, got %d", r)
+	}
+	if r := Apply(10, -16); r != 0 {
+		t.Errorf("Expected rating to stop at 0, got %d", r)
+	}
+}
@@ -1,105 +1,119 @@
 package session
 
 import (
-	"bytes"
-	"encoding/json"
-	"net/http"
-	"os"
+	"gorm.io/gorm"
+	"tx55/pkg/events"
+	"tx55/pkg/metalgearonline1/outbox"
 	"tx55/pkg/metalgearonline1/types"
 )
 
-type EventType string
-
-const (
-	EventTypeGameCreated      EventType = "game_created"
-	EventTypeGameDeleted      EventType = "game_deleted"
-	EventTypeGameNewRound     EventType = "game_new_round"
-	EventTypeGamePlayerJoined EventType = "game_player_joined"
-	EventTypeGamePlayerLeft   EventType = "game_player_left"
-)
-
-func (s *Session) publishEvent(e EventType, data interface{}) {
-	endpoint, found := os.LookupEnv("EVENTS_ENDPOINT")
-	if !found {
-		return
-	}
-
-	var l = s.LogEntry().WithField("event", e)
-	jsonData, err := json.Marshal(map[string]interface{}{
-		"event": e,
-		"lobby": s.LobbyID,
-		"data":  data,
-	})
-
-	if err != nil {
-		l.WithError(err).Error("failed to marshal event data")
-		return
+// publishEvent queues the event for delivery to the subscribers. db should be the transaction that made the change
+// the event describes, if there is one.
+func (s *Session) publishEvent(db *gorm.DB, e events.Event) {
+	if err := outbox.Queue(db, uint(s.LobbyID), e); err != nil {
+		s.LogEntry().WithField("event", e.EventType()).WithError(err).Error("failed to queue event")
 	}
-
-	resp, err := http.Post(endpoint, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		l.WithError(err).Error("failed to post event data")
-		return
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != 200 {
-		l.WithField("status_code", resp.StatusCode).Error("failed to post event data")
-	}
-
-	return
 }
 
-func (s *Session) EventGameCreated(gameID uint, args *types.CreateGameOptions) {
-	type roundEntry struct {
-		Map  types.GameMapString
-		Mode types.GameModeString
-	}
-
-	var rounds []roundEntry
+func (s *Session) EventGameCreated(tx *gorm.DB, gameID uint, args *types.CreateGameOptions) {
+	var rounds []events.Round
 	for _, r := range args.Rules {
 		if r.Map == 0 {
 			break
 		}
-		rounds = append(rounds, roundEntry{
-			Map:  r.Map.String(),
-			Mode: r.Mode.String(),
+		rounds = append(rounds, events.Round{
+			Map:  string(r.Map.String()),
+			Mode: string(r.Mode.String()),
 		})
 	}
-	go s.publishEvent(EventTypeGameCreated, map[string]interface{}{
-		"name":         types.BytesToString(args.Name[:]),
-		"has_password": args.HasPassword,
-		"game_id":      gameID,
-		"host":         types.BytesToString(s.User.DisplayName[:]),
-		"rules":        rounds,
+	s.publishEvent(tx, events.GameCreated{
+		Game:        events.Game{GameID: gameID},
+		User:        events.User{UserID: s.User.ID},
+		Name:        types.BytesToString(args.Name[:]),
+		HasPassword: args.HasPassword,
+		Host:        types.BytesToString(s.User.DisplayName[:]),
+		Rules:       rounds,
 	})
 }
 
-func (s *Session) EventGameDeleted() {
-	go s.publishEvent(EventTypeGameDeleted, map[string]interface{}{
-		"game_id": s.GameState.GameID,
+func (s *Session) eventGame() events.Game {
+	return events.Game{GameID: uint(s.GameState.GameID)}
+}
+
+func (s *Session) EventGameDeleted(tx *gorm.DB) {
+	s.publishEvent(tx, events.GameDeleted{Game: s.eventGame()})
+}
+
+func (s *Session) EventGameNewRound(tx *gorm.DB, round byte) {
+	s.publishEvent(tx, events.GameNewRound{
+		Game:  s.eventGame(),
+		Round: int(round),
+		Map:   string(s.GameState.Rules[round].Map.String()),
+		Mode:  string(s.GameState.Rules[round].Mode.String()),
+	})
+}
+
+func (s *Session) EventGamePlayerJoined(tx *gorm.DB, id types.UserID) {
+	s.publishEvent(tx, events.GamePlayerJoined{Game: s.eventGame(), User: events.User{UserID: uint(id)}})
+}
+
+func (s *Session) EventGamePlayerLeft(tx *gorm.DB, id types.UserID) {
+	s.publishEvent(tx, events.GamePlayerLeft{Game: s.eventGame(), User: events.User{UserID: uint(id)}})
+}
+
+func (s *Session) EventPlayerKicked(tx *gorm.DB, id types.UserID) {
+	s.publishEvent(tx, events.PlayerKicked{Game: s.eventGame(), User: events.User{UserID: uint(id)}})
+}
+
+func (s *Session) EventHostQuit() {
+	s.publishEvent(s.DB, events.HostQuit{Game: s.eventGame(), User: events.User{UserID: s.User.ID}})
+}
+
+func (s *Session) EventTeamChange(tx *gorm.DB, id types.UserID, team types.Team) {
+	s.publishEvent(tx, events.TeamChange{
+		Game:   s.eventGame(),
+		User:   events.User{UserID: uint(id)},
+		TeamID: uint8(team),
+		Team:   team.ColorString(),
 	})
 }
 
-func (s *Session) EventGameNewRound(round byte) {
-	go s.publishEvent(EventTypeGameNewRound, map[string]interface{}{
-		"game_id": s.GameState.GameID,
-		"round":   round,
-		"map":     s.GameState.Rules[round].Map.String(),
-		"mode":    s.GameState.Rules[round].Mode.String(),
+func (s *Session) EventStatsReported(tx *gorm.DB, id types.UserID, rules types.GameRules, stats types.HostReportedStats, quarantined bool) {
+	s.publishEvent(tx, events.StatsReported{
+		Game:        s.eventGame(),
+		User:        events.User{UserID: uint(id)},
+		Map:         string(rules.Map.String()),
+		Mode:        string(rules.Mode.String()),
+		Kills:       stats.Kills,
+		Deaths:      stats.Deaths,
+		Points:      stats.Points,
+		Quarantined: quarantined,
 	})
 }
 
-func (s *Session) EventGamePlayerJoined(id types.UserID) {
-	go s.publishEvent(EventTypeGamePlayerJoined, map[string]interface{}{
-		"game_id": s.GameState.GameID,
-		"user_id": id,
+func (s *Session) EventLogin() {
+	s.publishEvent(s.DB, events.Login{
+		User:        events.User{UserID: s.User.ID},
+		DisplayName: types.BytesToString(s.User.DisplayName),
 	})
 }
 
-func (s *Session) EventGamePlayerLeft(id types.UserID) {
-	go s.publishEvent(EventTypeGamePlayerLeft, map[string]interface{}{
-		"game_id": s.GameState.GameID,
-		"user_id": id,
+func (s *Session) EventLobbyJoin() {
+	s.joinedLobby = true
+	s.publishEvent(s.DB, events.LobbyJoin{
+		User:        events.User{UserID: s.User.ID},
+		DisplayName: types.BytesToString(s.User.DisplayName),
 	})
 }
+
+// EventDisconnected sends the lobby leave, if the player had joined the lobby, and the logout events
+func (s *Session) EventDisconnected() {
+	if !s.IsLoggedIn() {
+		return
+	}
+	user := events.User{UserID: s.User.ID}
+	if s.joinedLobby {
+		s.publishEvent(s.DB, events.LobbyLeave{User: user})
+	}
+	s.publishEvent(s.DB, events.Logout{User: user})
+}
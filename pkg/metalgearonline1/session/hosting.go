@@ -8,12 +8,13 @@ import (
 )
 
 func (s *Session) StartHosting(id types.GameID, args *types.CreateGameOptions) {
-	s.isHost = true
-	s.GameState = &HostSession{
+	hs := &HostSession{
 		GameID:        id,
 		Rules:         args.Rules,
 		CurrentRound:  0,
 		Players:       map[types.UserID]time.Time{},
+		Teams:         map[types.UserID]types.Team{},
+		Results:       map[types.UserID]RoundResult{},
 		CollectStats:  true,
 		ParentSession: s,
 	}
@@ -21,21 +22,37 @@ func (s *Session) StartHosting(id types.GameID, args *types.CreateGameOptions) {
 		// On the original server we also flipped this if someone was kicked, since we have more insight
 		// into the games now and can see if there is Kick abuse we can get away with only turning it off
 		// when the game is private
-		s.GameState.CollectStats = false
+		hs.CollectStats = false
 	}
+
+	s.stateLock.Lock()
+	s.isHost = true
+	s.GameState = hs
+	s.stateLock.Unlock()
 }
 
 func (s *Session) StopHosting() {
+	s.GameState.FinishRound()
 	s.GameState.StopGame()
-	s.EventGameDeleted()
+	s.stateLock.Lock()
 	s.GameState = nil
+	s.stateLock.Unlock()
 }
 
+// AddPlayer records the player joining the game. Like the other methods that change the game, it queues the event in
+// the same transaction as the change so subscribers only see changes that were committed.
 func (hs *HostSession) AddPlayer(id types.UserID) {
-	md := hs.ParentSession.DB.Model(&models.Game{
-		Model: gorm.Model{ID: uint(hs.GameID)},
+	err := hs.ParentSession.DB.Transaction(func(tx *gorm.DB) error {
+		md := tx.Model(&models.Game{
+			Model: gorm.Model{ID: uint(hs.GameID)},
+		})
+		if err := md.Association("Players").Append(&models.GamePlayers{UserID: uint(id)}); err != nil {
+			return err
+		}
+		hs.ParentSession.EventGamePlayerJoined(tx, id)
+		return nil
 	})
-	if err := md.Association("Players").Append(&models.GamePlayers{UserID: uint(id)}); err != nil {
+	if err != nil {
 		hs.ParentSession.LogEntry().WithError(err).Error("Failed to add player to game")
 	}
 
@@ -46,19 +63,39 @@ func (hs *HostSession) AddPlayer(id types.UserID) {
 }
 
 func (hs *HostSession) RemovePlayer(id types.UserID) {
-	md := hs.ParentSession.DB.Model(&models.GamePlayers{})
-	if err := md.Delete(&models.GamePlayers{}, "game_id = ? AND user_id = ?", hs.GameID, id).Error; err != nil {
+	err := hs.ParentSession.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.GamePlayers{}, "game_id = ? AND user_id = ?", hs.GameID, id).Error; err != nil {
+			return err
+		}
+		hs.ParentSession.EventGamePlayerLeft(tx, id)
+		return nil
+	})
+	if err != nil {
 		hs.ParentSession.LogEntry().WithError(err).Error("Failed to remove player from game")
 	}
 
 	hs.Lock.Lock()
 	defer hs.Lock.Unlock()
 	delete(hs.Players, id)
+	delete(hs.Teams, id)
 }
 
 func (hs *HostSession) JoinTeam(id types.UserID, team types.Team) {
-	query := hs.ParentSession.DB.Model(&models.GamePlayers{}).Where("user_id = ? and game_id = ?", uint(id), uint(hs.GameID))
-	query.Update("team", team)
+	err := hs.ParentSession.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.GamePlayers{}).Where("user_id = ? and game_id = ?", uint(id), uint(hs.GameID))
+		if err := query.Update("team", team).Error; err != nil {
+			return err
+		}
+		hs.ParentSession.EventTeamChange(tx, id, team)
+		return nil
+	})
+	if err != nil {
+		hs.ParentSession.LogEntry().WithError(err).Error("Failed to change player's team")
+	}
+
+	hs.Lock.Lock()
+	hs.Teams[id] = team
+	hs.Lock.Unlock()
 
 	switch team {
 	case types.TeamSpectator:
@@ -73,27 +110,54 @@ func (hs *HostSession) JoinTeam(id types.UserID, team types.Team) {
 }
 
 func (hs *HostSession) KickPlayer(id types.UserID) {
-	query := hs.ParentSession.DB.Model(&models.GamePlayers{}).Where("user_id = ? and game_id = ?", uint(id), uint(hs.GameID))
-	query.Update("was_kicked", true)
+	err := hs.ParentSession.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.GamePlayers{}).Where("user_id = ? and game_id = ?", uint(id), uint(hs.GameID))
+		if err := query.Update("was_kicked", true).Error; err != nil {
+			return err
+		}
+		hs.ParentSession.EventPlayerKicked(tx, id)
+		return nil
+	})
+	if err != nil {
+		hs.ParentSession.LogEntry().WithError(err).Error("Failed to mark player as kicked")
+	}
 	// Removing the player will happen when the host sends the player left message
 }
 
 func (hs *HostSession) StopGame() {
-	if err := hs.ParentSession.DB.Where("game_id = ?", hs.GameID).Delete(&models.GamePlayers{}).Error; err != nil {
-		hs.ParentSession.LogEntry().WithError(err).Error("Failed to remove players from game")
-	}
-
-	if err := hs.ParentSession.DB.Delete(&models.Game{}, uint(hs.GameID)).Error; err != nil {
+	err := hs.ParentSession.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("game_id = ?", hs.GameID).Delete(&models.GamePlayers{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Game{}, uint(hs.GameID)).Error; err != nil {
+			return err
+		}
+		hs.ParentSession.EventGameDeleted(tx)
+		return nil
+	})
+	if err != nil {
 		hs.ParentSession.LogEntry().WithError(err).Error("Failed to remove game")
 	}
 }
 
 func (hs *HostSession) NewRound(roundID byte) {
-	md := hs.ParentSession.DB.Model(&models.Game{
-		Model: gorm.Model{ID: uint(hs.GameID)},
+	err := hs.ParentSession.DB.Transaction(func(tx *gorm.DB) error {
+		md := tx.Model(&models.Game{
+			Model: gorm.Model{ID: uint(hs.GameID)},
+		})
+		if err := md.Update("current_round", roundID).Error; err != nil {
+			return err
+		}
+		hs.ParentSession.EventGameNewRound(tx, roundID)
+		return nil
 	})
-	md.Update("current_round", roundID)
+	if err != nil {
+		hs.ParentSession.LogEntry().WithError(err).Error("Failed to start new round")
+	}
 
+	hs.FinishRound()
+	hs.Lock.Lock()
 	hs.CurrentRound = roundID
 	hs.RoundStart = time.Now()
+	hs.Lock.Unlock()
 }
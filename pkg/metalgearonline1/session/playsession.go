@@ -0,0 +1,135 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"time"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+const (
+	// HeartbeatInterval is how often a lobby marks its open play sessions alive
+	HeartbeatInterval     = time.Minute
+	DefaultStaleAfter     = models.DefaultPlaySessionStaleAfter
+	DefaultDuplicateLogin = configurations.DuplicateLoginTakeover
+)
+
+var (
+	// DuplicateLogin is what happens when a user logs into a game lobby while they have a live session in one
+	DuplicateLogin = DefaultDuplicateLogin
+	// StaleAfter is how long since its last heartbeat a session still counts as live
+	StaleAfter = DefaultStaleAfter
+	// Lifetime is how long a session id can go unused before it expires
+	Lifetime = models.DefaultSessionLifetime
+)
+
+// ErrAlreadyLoggedIn is returned by Login when the user has a live session and duplicate logins are rejected
+var ErrAlreadyLoggedIn = errors.New("already logged in")
+
+// Configure sets the package level options from the gameserver config, zero values keep the defaults
+func Configure(cfg configurations.SessionsConfig) error {
+	switch cfg.DuplicateLogin {
+	case "":
+		DuplicateLogin = DefaultDuplicateLogin
+	case configurations.DuplicateLoginTakeover, configurations.DuplicateLoginReject, configurations.DuplicateLoginAllow:
+		DuplicateLogin = cfg.DuplicateLogin
+	default:
+		return fmt.Errorf("unknown duplicate login policy %q", cfg.DuplicateLogin)
+	}
+	StaleAfter = DefaultStaleAfter
+	if cfg.StaleSeconds > 0 {
+		StaleAfter = time.Duration(cfg.StaleSeconds) * time.Second
+	}
+	Lifetime = models.DefaultSessionLifetime
+	if cfg.LifetimeDays > 0 {
+		Lifetime = time.Duration(cfg.LifetimeDays) * 24 * time.Hour
+	}
+	return nil
+}
+
+// startPlaySession records when the player logged in, a session that logs in again as another user ends the first
+// user's play session
+func (s *Session) startPlaySession() {
+	if s.playSession != nil {
+		if s.playSession.UserID == s.User.ID {
+			return
+		}
+		s.EndPlaySession()
+	}
+	p, err := models.StartPlaySession(s.DB, s.User.ID, uint(s.LobbyID), s.ID, s.IP)
+	if err != nil {
+		s.LogEntry().WithError(err).Error("failed to start play session")
+		return
+	}
+	s.playSession = p
+}
+
+// EndPlaySession records when the player left, it should be called when the connection closes
+func (s *Session) EndPlaySession() {
+	if s.playSession == nil {
+		return
+	}
+	if err := s.playSession.End(s.DB, false); err != nil {
+		s.LogEntry().WithError(err).Error("failed to end play session")
+	}
+	s.playSession = nil
+}
+
+// discardPlaySession removes the play session of a login that was refused, so it isn't counted as time online
+func (s *Session) discardPlaySession() {
+	if s.playSession == nil {
+		return
+	}
+	if err := s.DB.Delete(s.playSession).Error; err != nil {
+		s.LogEntry().WithError(err).Error("failed to discard play session")
+	}
+	s.playSession = nil
+}
+
+// enforceSingleSession applies the duplicate login policy to the user's other live sessions in game lobbies. Only
+// sessions older than this one's play session are considered, so of two logins racing each other in different lobbies
+// the newer one always wins or is the one rejected.
+func (s *Session) enforceSingleSession() error {
+	if DuplicateLogin == configurations.DuplicateLoginAllow || s.playSession == nil {
+		return nil
+	}
+
+	var lobby models.Lobby
+	if err := s.DB.Where("id = ?", s.LobbyID).Limit(1).Find(&lobby).Error; err != nil {
+		return err
+	}
+	if lobby.Type != types.LobbyTypeGame {
+		return nil
+	}
+
+	others, err := models.LiveGamePlaySessions(s.DB, s.User.ID, s.playSession.ID, StaleAfter)
+	if err != nil || len(others) == 0 {
+		return err
+	}
+
+	if DuplicateLogin == configurations.DuplicateLoginReject {
+		s.LogEntry().WithFields(logrus.Fields{
+			"user_id":     s.User.ID,
+			"old_lobby":   others[0].LobbyID,
+			"old_session": others[0].SessionID,
+		}).Info("Rejected login, the user is already logged in")
+		return ErrAlreadyLoggedIn
+	}
+
+	for i := range others {
+		l := s.LogEntry().WithFields(logrus.Fields{
+			"user_id":     s.User.ID,
+			"old_lobby":   others[i].LobbyID,
+			"old_session": others[i].SessionID,
+		})
+		if err := others[i].TakeOver(s.DB, "session "+s.ID); err != nil {
+			l.WithError(err).Error("Failed to take over the user's old session")
+			continue
+		}
+		l.Info("Took over the user's old session")
+	}
+	return nil
+}
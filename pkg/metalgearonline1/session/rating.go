@@ -0,0 +1,105 @@
+package session
+
+import (
+	"github.com/sirupsen/logrus"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/rating"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+// RoundResult is what we need to remember about a player's stats until the round ends
+type RoundResult struct {
+	Team       types.Team
+	HasTeam    bool
+	Points     int32
+	TeamWins   uint32
+	HostRating uint32
+}
+
+// RecordResult stores the player's reported stats for the current round to be rated once the round ends
+func (hs *HostSession) RecordResult(id types.UserID, stats types.HostReportedStats) {
+	hs.Lock.Lock()
+	defer hs.Lock.Unlock()
+
+	result := hs.Results[id]
+	result.Team, result.HasTeam = hs.Teams[id]
+	result.Points += stats.Points
+	result.TeamWins += stats.TeamWins
+	result.HostRating = stats.VsRating
+	hs.Results[id] = result
+}
+
+// FinishRound calculates the server VS rating changes from the collected round results and applies them
+func (hs *HostSession) FinishRound() {
+	hs.Lock.Lock()
+	results := hs.Results
+	hs.Results = map[types.UserID]RoundResult{}
+	hs.Lock.Unlock()
+
+	if len(results) == 0 {
+		return
+	}
+
+	db := hs.ParentSession.DB
+	mode := hs.Rules[hs.CurrentRound].Mode
+	l := hs.ParentSession.LogEntry().WithField("round", hs.CurrentRound)
+
+	var ids []uint
+	for id := range results {
+		ids = append(ids, uint(id))
+	}
+
+	var users []models.User
+	if err := db.Select("id", "server_vs_rating").Find(&users, ids).Error; err != nil {
+		l.WithError(err).Error("Failed to fetch ratings for round")
+		return
+	}
+
+	var participants []rating.Participant
+	for _, u := range users {
+		result := results[types.UserID(u.ID)]
+		if mode != types.ModeDeathmatch && !result.HasTeam {
+			continue
+		}
+		participants = append(participants, rating.Participant{
+			UserID: u.ID,
+			Rating: u.ServerVsRating,
+			Team:   result.Team,
+			Points: result.Points,
+			Won:    result.TeamWins > 0,
+		})
+	}
+
+	useServerRating := models.GetSetting(db, models.SettingVsRatingSource, models.DefaultVsRatingSource) == models.VsRatingSourceServer
+	deltas := rating.Round(rating.KFactor, mode, participants)
+	for _, p := range participants {
+		newRating := rating.Apply(p.Rating, deltas[p.UserID])
+		updates := map[string]interface{}{
+			"server_vs_rating": newRating,
+		}
+		if useServerRating {
+			updates["vs_rating"] = newRating
+		}
+		if err := db.Model(&models.User{}).Where("id = ?", p.UserID).Updates(updates).Error; err != nil {
+			l.WithError(err).WithField("rated_user_id", p.UserID).Error("Failed to update server rating")
+			continue
+		}
+
+		hostRating := uint(results[types.UserID(p.UserID)].HostRating)
+		if diff := int(hostRating) - int(newRating); diff > int(rating.DiscrepancyThreshold) || -diff > int(rating.DiscrepancyThreshold) {
+			l.WithFields(logrus.Fields{
+				"rated_user_id": p.UserID,
+				"host_rating":   hostRating,
+				"server_rating": newRating,
+			}).Warn("Host reported rating differs from server rating")
+
+			db.Create(&models.RatingDiscrepancy{
+				UserID:       p.UserID,
+				HostID:       hs.ParentSession.User.ID,
+				GameID:       uint(hs.GameID),
+				HostRating:   hostRating,
+				ServerRating: newRating,
+			})
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package session
 
 import (
+	"errors"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"io"
 	"sync"
 	"time"
 	"tx55/pkg/metalgearonline1/models"
 	"tx55/pkg/metalgearonline1/types"
 )
 
+// HostSession is changed by the host's connection, anything that changes after hosting starts is changed under Lock so
+// it can be read from other goroutines
 type HostSession struct {
 	GameID       types.GameID
 	Rules        [15]types.GameRules
@@ -16,7 +20,11 @@ type HostSession struct {
 	RoundStart   time.Time
 	// Players tracks when they were last actually playing in the match
 	// by tracking the time of their last non-spectator team-selection.
-	Players       map[types.UserID]time.Time
+	Players map[types.UserID]time.Time
+	// Teams is the last team each player selected, players that never picked a team are not present
+	Teams map[types.UserID]types.Team
+	// Results collects the stats reported for the current round so ratings can be calculated when it ends
+	Results       map[types.UserID]RoundResult
 	CollectStats  bool
 	Lock          sync.Mutex
 	ParentSession *Session
@@ -35,6 +43,67 @@ type Session struct {
 	LobbyID   types.LobbyID
 	Log       logrus.FieldLogger
 	SharedIds []uint
+
+	// conn lets the session be disconnected from outside of the connection's own goroutines
+	conn io.Closer
+	// joinedLobby is set once the player has entered the game lobby, rather than just logged in
+	joinedLobby bool
+	// playSession is open from login until the connection closes
+	playSession *models.PlaySession
+	// stateLock guards changing User, GameState and ActiveConnection so other goroutines can take a Snapshot. The
+	// connection's own goroutine is the only one that changes them and can read them without it.
+	stateLock sync.RWMutex
+}
+
+// Snapshot is who a session is and what it is hosting at one point in time
+type Snapshot struct {
+	UserID      uint
+	DisplayName []byte
+	// Game is the hosted game, nil when not hosting. Anything on it that changes must be read under its Lock.
+	Game       *HostSession
+	GameID     types.GameID
+	Connection models.Connection
+}
+
+// Snapshot is safe to call from any goroutine, unlike reading User and GameState directly
+func (s *Session) Snapshot() Snapshot {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+	var out Snapshot
+	if s.IsLoggedIn() {
+		out.UserID = s.User.ID
+		out.DisplayName = append([]byte{}, s.User.DisplayName...)
+	}
+	if s.IsHost() {
+		out.Game = s.GameState
+		out.GameID = s.GameState.GameID
+	}
+	out.Connection = s.ActiveConnection
+	return out
+}
+
+func (s *Session) setUser(user *models.User) {
+	s.stateLock.Lock()
+	s.User = user
+	s.stateLock.Unlock()
+}
+
+func (s *Session) SetActiveConnection(conn models.Connection) {
+	s.stateLock.Lock()
+	s.ActiveConnection = conn
+	s.stateLock.Unlock()
+}
+
+func (s *Session) SetConnection(conn io.Closer) {
+	s.conn = conn
+}
+
+// Disconnect closes the connection, the usual disconnect handling then cleans up the session and any hosted game
+func (s *Session) Disconnect() error {
+	if s.conn == nil {
+		return errors.New("session has no connection")
+	}
+	return s.conn.Close()
 }
 
 func (s *Session) IsLoggedIn() bool {
@@ -54,13 +123,15 @@ func (s *Session) LogFields() logrus.Fields {
 		"id": s.ID,
 		"ip": s.IP,
 	}
-	if s.IsLoggedIn() && s.LobbyID > 0 {
+	// Sessions are logged from other goroutines too, like when a ban is enforced
+	snapshot := s.Snapshot()
+	if snapshot.UserID > 0 && s.LobbyID > 0 {
 		f["state"] = "in-lobby"
-		f["user_id"] = s.User.ID
+		f["user_id"] = snapshot.UserID
 
-		if s.IsHost() {
+		if snapshot.GameID > 0 {
 			f["state"] = "hosting"
-			f["game_id"] = s.GameState.GameID
+			f["game_id"] = snapshot.GameID
 		}
 
 	} else {
@@ -71,9 +142,16 @@ func (s *Session) LogFields() logrus.Fields {
 
 // --- State Changes ---
 
-// Login is also where any first-time setup should be done
-func (s *Session) Login(user *models.User) {
-	s.User = user
+// Login is also where any first-time setup should be done. It returns ErrAlreadyLoggedIn, leaving the session logged
+// out, when the user is logged in elsewhere and duplicate logins are rejected.
+func (s *Session) Login(user *models.User) error {
+	s.setUser(user)
+	s.startPlaySession()
+	if err := s.enforceSingleSession(); err != nil {
+		s.discardPlaySession()
+		s.setUser(nil)
+		return err
+	}
 
 	s.DB.Model(user).Updates(map[string]interface{}{
 		"updated_at": gorm.Expr("NOW()"),
@@ -91,4 +169,5 @@ func (s *Session) Login(user *models.User) {
 
 	// Fetch the list of shared accounts once on login instead of on whenever we need to expand blocklists
 	s.SharedIds = s.User.SharedAccounts(s.DB)
+	return nil
 }
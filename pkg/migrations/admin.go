@@ -8,6 +8,14 @@ import (
 
 func initAdminDB(db *gorm.DB) (err error) {
 	Logger.WithField("type", AdminDBMigrationType).Info("Initialization complete")
+	if err = rolePrivileges(db); err != nil {
+		Logger.WithError(err).WithField("type", AdminDBMigrationType).Error("Error initializing database")
+		return
+	}
+	if err = searchUsersPrivilege(db); err != nil {
+		Logger.WithError(err).WithField("type", AdminDBMigrationType).Error("Error initializing database")
+		return
+	}
 	if err = firstUserInit(db); err != nil {
 		Logger.WithError(err).WithField("type", AdminDBMigrationType).Error("Error initializing database")
 		return
@@ -56,3 +64,71 @@ func firstUserInit(db *gorm.DB) (err error) {
 	}
 	return
 }
+
+// legacyRoleColumns are the boolean columns roles used for privileges before they were stored as a set, each column is
+// named after the privilege it granted
+var legacyRoleColumns = []string{
+	"update_profiles",
+	"full_ips",
+	"search_by_ip",
+	"read_bans",
+	"update_bans",
+	"manage_users",
+	"manage_news",
+	"manage_policy",
+	"review_stats",
+	"manage_lobbies",
+	"read_reports",
+	"resolve_reports",
+}
+
+// rolePrivileges moves the legacy privilege columns into each role's privilege set and drops them
+func rolePrivileges(db *gorm.DB) (err error) {
+	for _, column := range legacyRoleColumns {
+		if !db.Migrator().HasColumn(&admin.Role{}, column) {
+			continue
+		}
+		Logger.WithField("column", column).Info("Moving role privilege column into privilege sets")
+
+		var roles []admin.Role
+		if err = db.Where(column+" = ?", true).Find(&roles).Error; err != nil {
+			return
+		}
+		for _, role := range roles {
+			if role.Privileges.Has(admin.Privilege(column)) {
+				continue
+			}
+			role.Privileges = append(role.Privileges, admin.Privilege(column))
+			if err = db.Model(&role).Update("privileges", role.Privileges).Error; err != nil {
+				return
+			}
+		}
+		if err = db.Migrator().DropColumn(&admin.Role{}, column); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// searchUsersPrivilege grants search_users to every role, searching users by name used to be open to every admin. It
+// only runs while no role has been granted it.
+func searchUsersPrivilege(db *gorm.DB) (err error) {
+	Logger.Info("Checking for roles without the search_users privilege")
+	var roles []admin.Role
+	if err = db.Where("all_privileges = ?", false).Find(&roles).Error; err != nil {
+		return
+	}
+	for _, role := range roles {
+		if role.Privileges.Has(admin.PrivSearchUsers) {
+			return
+		}
+	}
+	for _, role := range roles {
+		Logger.WithField("role", role.Name).Info("Granting search_users privilege")
+		role.Privileges = append(role.Privileges, admin.PrivSearchUsers)
+		if err = db.Model(&role).Update("privileges", role.Privileges).Error; err != nil {
+			return
+		}
+	}
+	return
+}
@@ -2,9 +2,12 @@ package migrations
 
 import (
 	"fmt"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	"os"
+	"time"
 	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/rating"
 	"tx55/pkg/metalgearonline1/types"
 )
 
@@ -27,6 +30,26 @@ func initGameDB(db *gorm.DB) (err error) {
 
 	}
 
+	if err = vsRatingColumns(db); err != nil {
+		return
+	}
+
+	if err = championAwardHistory(db); err != nil {
+		return
+	}
+
+	if err = canonicalUsernames(db); err != nil {
+		return
+	}
+
+	if err = displayNameSkeletons(db); err != nil {
+		return
+	}
+
+	if err = sessionExpiry(db); err != nil {
+		return
+	}
+
 	Logger.WithField("type", GameDBMigrationType).Info("Initialization complete")
 	return
 }
@@ -148,3 +171,134 @@ func lobbiesTable(db *gorm.DB) (err error) {
 	}
 	return
 }
+
+// settingVsRatingsSeeded marks vsRatingColumns as done, users can legitimately drop to a rating of 0 afterwards. The
+// first version of the seed matched on 0 and missed the NULLs AutoMigrate leaves in new columns, so it uses a new key
+// to run again where that one already did.
+const settingVsRatingsSeeded = "migration_vs_ratings_seeded_v2"
+
+// vsRatingColumns seeds the host/server rating columns from the existing rating for users that predate them, users
+// without a rating start from the default like new accounts do. It only runs once.
+func vsRatingColumns(db *gorm.DB) (err error) {
+	Logger.Info("Checking for unseeded server and host VS ratings")
+	if models.GetSetting(db, settingVsRatingsSeeded, "") != "" {
+		return
+	}
+	Logger.Info("Seeding server and host VS ratings")
+	seed := gorm.Expr("COALESCE(NULLIF(vs_rating, 0), ?)", rating.DefaultRating)
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.User{}).
+			Where("server_vs_rating IS NULL OR server_vs_rating = 0").
+			Where("host_vs_rating IS NULL OR host_vs_rating = 0").
+			Updates(map[string]interface{}{
+				"server_vs_rating": seed,
+				"host_vs_rating":   seed,
+			}).Error
+		if err != nil {
+			return err
+		}
+		return models.SetSetting(tx, settingVsRatingsSeeded, "1")
+	})
+}
+
+// championAwardHistory records the champion emblems handed out before award history was kept, they expire at the next
+// weekly rotation so it takes them away like it used to
+func championAwardHistory(db *gorm.DB) (err error) {
+	Logger.Info("Checking for champions without award history")
+	var history int64
+	if err = db.Model(&models.AwardHistory{}).Count(&history).Error; err != nil || history > 0 {
+		return
+	}
+
+	var champions []models.User
+	if err = db.Where("has_emblem = ? AND emblem_text = ?", true, []byte("Champion")).Find(&champions).Error; err != nil {
+		return
+	}
+	expiresAt := nextWeeklyRotation(time.Now())
+	for _, champion := range champions {
+		Logger.WithField("user_id", champion.ID).Info("Adding award history for champion")
+		if err = db.Create(&models.AwardHistory{
+			UserID:     champion.ID,
+			Award:      "champion",
+			EmblemText: champion.EmblemText,
+			ExpiresAt:  expiresAt,
+		}).Error; err != nil {
+			return
+		}
+	}
+	return
+}
+
+// nextWeeklyRotation is the Monday 00:00 UTC after now, when the weekly stats are cleared and awards rotate
+func nextWeeklyRotation(now time.Time) time.Time {
+	now = now.UTC()
+	days := (int(time.Monday) - int(now.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	return time.Date(now.Year(), now.Month(), now.Day()+days, 0, 0, 0, 0, time.UTC)
+}
+
+// canonicalUsernames fills username_canonical for users that predate it. Usernames used to be matched with LIKE, so
+// accounts that only differ by case can exist. The oldest keeps the name and the others get a canonical username that
+// can't be typed, so they can't log in until the clash is resolved by hand.
+func canonicalUsernames(db *gorm.DB) (err error) {
+	Logger.Info("Checking for users without a canonical username")
+	var users []models.User
+	return db.Unscoped().Select("id", "username").Where("username_canonical IS NULL").Order("id").
+		FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+			for _, user := range users {
+				canonical := models.CanonicalUsername(user.Username)
+				var taken int64
+				if err := db.Unscoped().Model(&models.User{}).Where("username_canonical = ?", canonical).Count(&taken).Error; err != nil {
+					return err
+				}
+				if taken > 0 {
+					Logger.WithFields(logrus.Fields{
+						"user_id":  user.ID,
+						"username": string(user.Username),
+					}).Warn("Username clashes with an older account, it can not log in until this is resolved")
+					canonical = append(canonical, []byte(fmt.Sprintf("\x00%d", user.ID))...)
+				}
+				if err := db.Unscoped().Model(&user).UpdateColumn("username_canonical", canonical).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// displayNameSkeletons fills display_name_skeleton for users that predate it, so lookalike display names are caught for
+// existing accounts too
+func displayNameSkeletons(db *gorm.DB) (err error) {
+	Logger.Info("Checking for users without a display name skeleton")
+	var users []models.User
+	return db.Unscoped().Select("id", "display_name").Where("display_name_skeleton IS NULL").Order("id").
+		FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+			for _, user := range users {
+				skeleton := models.DisplayNameSkeleton(user.DisplayName)
+				if err := db.Unscoped().Model(&user).UpdateColumn("display_name_skeleton", skeleton).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// sessionExpiry gives the sessions created before they expired the default lifetime from when they were created
+func sessionExpiry(db *gorm.DB) (err error) {
+	Logger.Info("Checking for sessions without an expiry")
+	var sessions []models.Session
+	return db.Select("id", "created_at").Where("expires_at IS NULL").
+		FindInBatches(&sessions, 500, func(tx *gorm.DB, batch int) error {
+			for _, session := range sessions {
+				if err := db.Model(&session).UpdateColumns(map[string]interface{}{
+					"last_used_at": session.CreatedAt,
+					"expires_at":   session.CreatedAt.Add(models.DefaultSessionLifetime),
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"testing"
+	"time"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/rating"
+)
+
+// legacyUser is the users table from before the host and server VS rating columns existed
+type legacyUser struct {
+	gorm.Model
+	Username          []byte `gorm:"uniqueIndex,size:16"`
+	UsernameCanonical []byte `gorm:"uniqueIndex;size:32"`
+	DisplayName       []byte `gorm:"uniqueIndex,size:16"`
+	VsRating          uint
+}
+
+func (legacyUser) TableName() string {
+	return "users"
+}
+
+func TestVsRatingColumnsExistingTable(t *testing.T) {
+	db, err := configurations.DatabaseConfig{Type: configurations.SQLite, DSN: t.TempDir() + "/game.db"}.Open(&gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&legacyUser{}); err != nil {
+		t.Fatal(err)
+	}
+	veteran := legacyUser{Username: []byte("veteran"), UsernameCanonical: []byte("veteran"), DisplayName: []byte("veteran"), VsRating: 1420}
+	unrated := legacyUser{Username: []byte("unrated"), UsernameCanonical: []byte("unrated"), DisplayName: []byte("unrated")}
+	if err = db.Create(&veteran).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Create(&unrated).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err = MigrateModels(GameDBMigrationType, db); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[uint]uint{veteran.ID: 1420, unrated.ID: rating.DefaultRating}
+	for id, want := range expected {
+		var user models.User
+		if err = db.First(&user, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if user.ServerVsRating != want || user.HostVsRating != want {
+			t.Errorf("Expected user %d to be seeded with %d, got server %d and host %d", id, want, user.ServerVsRating, user.HostVsRating)
+		}
+	}
+}
+
+func TestNextWeeklyRotation(t *testing.T) {
+	tests := map[string]string{
+		"2024-06-05T15:04:05Z":      "2024-06-10T00:00:00Z",
+		"2024-06-09T23:59:59Z":      "2024-06-10T00:00:00Z",
+		"2024-06-10T00:00:00Z":      "2024-06-17T00:00:00Z",
+		"2024-06-10T08:00:00Z":      "2024-06-17T00:00:00Z",
+		"2024-06-09T20:00:00-05:00": "2024-06-17T00:00:00Z",
+	}
+	for now, expected := range tests {
+		at, _ := time.Parse(time.RFC3339, now)
+		if next := nextWeeklyRotation(at).Format(time.RFC3339); next != expected {
+			t.Errorf("Expected the rotation after %s to be %s, got %s", now, expected, next)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.RegisterMiddleware(restapi.AuthLevelAdmin, Audit)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/audit", ListAuditLogs)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/audit/:page", ListAuditLogs)
+}
+
+// Target types recorded in the audit log
+const (
+	AuditTargetBan       = "ban"
+	AuditTargetGameUser  = "game_user"
+	AuditTargetAdminUser = "admin_user"
+	AuditTargetRole      = "role"
+	AuditTargetNews      = "news"
+	AuditTargetPolicy    = "policy"
+	AuditTargetSetting   = "setting"
+	AuditTargetStats     = "quarantined_stats"
+	AuditTargetLobby     = "lobby"
+	AuditTargetReport    = "report"
+	AuditTargetAPIToken  = "api_token"
+	AuditTargetLockout   = "lockout"
+)
+
+// AuditLog is a single admin request that changed something
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	ActorID   uint      `gorm:"index"`
+	Actor     string
+	// APITokenID is the token the change was made with, 0 for changes made in a browser session
+	APITokenID uint
+	// Privilege is the privilege that allowed the change
+	Privilege Privilege
+	// Action is the method and route, eg: POST /admin/bans/update
+	Action     string `gorm:"index;size:128"`
+	TargetType string `gorm:"size:32"`
+	TargetID   uint
+	// TargetUserID is the game user the change applies to, if any
+	TargetUserID uint `gorm:"index"`
+	// Before and After only contain the fields that changed
+	Before string `gorm:"type:text"`
+	After  string `gorm:"type:text"`
+	// Request is the request body with secrets redacted
+	Request string `gorm:"type:text"`
+	IP      string
+}
+
+type auditEntry struct {
+	privilege    Privilege
+	targetType   string
+	targetID     uint
+	targetUserID uint
+	before       any
+	after        any
+}
+
+func fetchAuditEntry(c *gin.Context) *auditEntry {
+	if e, exists := c.Get("audit_entry"); exists {
+		return e.(*auditEntry)
+	}
+	return nil
+}
+
+// auditPrivilege records the privilege the request was allowed by, only the first privilege checked is kept
+func auditPrivilege(c *gin.Context, p Privilege) {
+	if e := fetchAuditEntry(c); e != nil && e.privilege == PrivNone {
+		e.privilege = p
+	}
+}
+
+// auditTarget records what the request changed, targetUserID is the affected game user or 0
+func auditTarget(c *gin.Context, targetType string, targetID uint, targetUserID uint) {
+	if e := fetchAuditEntry(c); e != nil {
+		e.targetType = targetType
+		e.targetID = targetID
+		e.targetUserID = targetUserID
+	}
+}
+
+// auditChange records the state of the target before and after the change, either may be nil for creates and deletes
+func auditChange(c *gin.Context, before any, after any) {
+	if e := fetchAuditEntry(c); e != nil {
+		e.before = before
+		e.after = after
+	}
+}
+
+// Audit records every admin request that changes something. Handlers describe the change with auditTarget and
+// auditChange, requests that fail are not recorded as nothing was changed.
+func Audit(c *gin.Context) {
+	if c.Request.Method == "GET" {
+		c.Next()
+		return
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		body, _ = io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	entry := &auditEntry{}
+	c.Set("audit_entry", entry)
+	c.Next()
+
+	if c.Writer.Status() >= 400 {
+		return
+	}
+
+	before, after := auditDiff(entry.before, entry.after)
+	row := AuditLog{
+		ActorID:      FetchUserID(c),
+		Actor:        FetchUser(c).Username,
+		APITokenID:   apiTokenID(c),
+		Privilege:    entry.privilege,
+		Action:       c.Request.Method + " " + c.FullPath(),
+		TargetType:   entry.targetType,
+		TargetID:     entry.targetID,
+		TargetUserID: entry.targetUserID,
+		Before:       before,
+		After:        after,
+		Request:      redactJSON(body),
+		IP:           c.ClientIP(),
+	}
+	if err := c.MustGet("adminDB").(*gorm.DB).Create(&row).Error; err != nil {
+		c.MustGet("logger").(logrus.FieldLogger).WithError(err).WithFields(logrus.Fields{
+			"admin_id": row.ActorID,
+			"action":   row.Action,
+		}).Error("Failed to write audit log")
+	}
+}
+
+func apiTokenID(c *gin.Context) uint {
+	if token := fetchAPIToken(c); token != nil {
+		return token.ID
+	}
+	return 0
+}
+
+func toJSONObject(v any) (map[string]any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	var out map[string]any
+	if json.Unmarshal(data, &out) != nil {
+		return nil, false
+	}
+	redact(out)
+	return out, true
+}
+
+// auditDiff reduces before and after to the fields that differ. Values that aren't JSON objects are kept whole.
+func auditDiff(before any, after any) (string, string) {
+	b, bOk := toJSONObject(before)
+	a, aOk := toJSONObject(after)
+	if bOk && aOk {
+		for k := range b {
+			if v, found := a[k]; found && reflect.DeepEqual(v, b[k]) {
+				delete(a, k)
+				delete(b, k)
+			}
+		}
+	}
+
+	encode := func(v map[string]any, ok bool) string {
+		if !ok {
+			return ""
+		}
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return encode(b, bOk), encode(a, aOk)
+}
+
+// redact replaces anything that looks like a secret so it never reaches the audit log
+func redact(v any) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			key := strings.ToLower(k)
+			if strings.Contains(key, "password") || strings.Contains(key, "secret") || strings.Contains(key, "token") {
+				t[k] = "[redacted]"
+				continue
+			}
+			redact(val)
+		}
+	case []any:
+		for _, val := range t {
+			redact(val)
+		}
+	}
+}
+
+func redactJSON(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v any
+	if json.Unmarshal(body, &v) != nil {
+		// Not JSON, so it can't be redacted safely
+		return ""
+	}
+	redact(v)
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+type AuditLogJSON struct {
+	ID           uint            `json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	ActorID      uint            `json:"actor_id"`
+	Actor        string          `json:"actor"`
+	APITokenID   uint            `json:"api_token_id"`
+	Privilege    Privilege       `json:"privilege"`
+	Action       string          `json:"action"`
+	TargetType   string          `json:"target_type"`
+	TargetID     uint            `json:"target_id"`
+	TargetUserID uint            `json:"target_user_id"`
+	Before       json.RawMessage `json:"before" swaggertype:"object"`
+	After        json.RawMessage `json:"after" swaggertype:"object"`
+	Request      json.RawMessage `json:"request" swaggertype:"object"`
+	IP           string          `json:"ip"`
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
+
+func ToAuditLogJSON(row AuditLog) AuditLogJSON {
+	return AuditLogJSON{
+		ID:           row.ID,
+		CreatedAt:    row.CreatedAt,
+		ActorID:      row.ActorID,
+		Actor:        row.Actor,
+		APITokenID:   row.APITokenID,
+		Privilege:    row.Privilege,
+		Action:       row.Action,
+		TargetType:   row.TargetType,
+		TargetID:     row.TargetID,
+		TargetUserID: row.TargetUserID,
+		Before:       rawJSON(row.Before),
+		After:        rawJSON(row.After),
+		Request:      rawJSON(row.Request),
+		IP:           row.IP,
+	}
+}
+
+// ListAuditLogs godoc
+// @Summary      List Audit Log
+// @Description  Lists the changes made by admins, newest first. `before` and `after` only contain the fields that
+// @Description  changed. Viewing the audit log requires all privileges.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        page            path   int     false  "Page"
+// @Param        actor_id        query  int     false  "Only changes made by this admin user"
+// @Param        target_user_id  query  int     false  "Only changes to this game user"
+// @Param        target_type     query  string  false  "Only changes to this type of target"
+// @Param        target_id       query  int     false  "Only changes to this target, use with target_type"
+// @Param        action          query  string  false  "Only actions containing this text, eg: bans/update"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]AuditLogJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/audit/{page} [get]
+// @Security ApiKeyAuth
+func ListAuditLogs(c *gin.Context) {
+	if !CheckPrivilege(c, PrivAll) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+	adminDB := c.MustGet("adminDB").(*gorm.DB)
+
+	q := adminDB.Order("id desc")
+	for _, column := range []string{"actor_id", "target_user_id", "target_type", "target_id"} {
+		if v := c.Query(column); v != "" {
+			q = q.Where(column+" = ?", v)
+		}
+	}
+	if action := c.Query("action"); action != "" {
+		q = q.Where("action LIKE ?", "%"+action+"%")
+	}
+
+	var rows []AuditLog
+	if err := q.Limit(limit).Offset((page - 1) * limit).Find(&rows).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting audit log")
+		restapi.Error(c, 500, "Error getting audit log")
+		return
+	}
+
+	out := make([]AuditLogJSON, len(rows))
+	for i, row := range rows {
+		out[i] = ToAuditLogJSON(row)
+	}
+	restapi.Success(c, out)
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"net/http"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
 	"tx55/pkg/restapi"
 )
 
@@ -15,19 +18,31 @@ func init() {
 }
 
 type ArgsLogin struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// TOTPCode or RecoveryCode is the second step for users with two-factor authentication. They can be sent with the
+	// username and password, or on their own after a login that returned totp_required.
+	TOTPCode     string `json:"totp_code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type LoginTOTPRequiredJSON struct {
+	TOTPRequired bool `json:"totp_required"`
 }
 
 // Login godoc
 // @Summary      Admin Login
-// @Description  Login to an administrative session
+// @Description  Login to an administrative session. Users with two-factor authentication get `totp_required` back
+// @Description  instead of their profile, and finish logging in by sending `totp_code` or `recovery_code` within 5
+// @Description  minutes.
 // @Tags         AdminLogin
 // @Accept       json
 // @Produce      json
 // @Param        body     body  ArgsLogin  true  "Account credentials"
 // @Success      200  {object}  restapi.ResponseJSON{data=User}
+// @Success      202  {object}  restapi.ResponseJSON{data=LoginTOTPRequiredJSON}
 // @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      429  {object}  restapi.ResponseJSON{data=string}
 // @Failure      500  {object}  restapi.ResponseJSON{data=string}
 // @Router       /admin/login [post]
 // @Security ApiKeyAuth
@@ -35,6 +50,7 @@ func Login(c *gin.Context) {
 	var args ArgsLogin
 	var user User
 	adminDB := c.MustGet("adminDB").(*gorm.DB)
+	session := sessions.Default(c)
 
 	err := c.BindJSON(&args)
 	if err != nil {
@@ -42,18 +58,58 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	if err := adminDB.Model(&user).Joins("Role").First(&user, "username = ?", args.Username).Error; err != nil {
-		logrus.WithError(err).Error("failed to fetch admin user")
-		restapi.Error(c, 500, "database error")
+	if args.Username != "" || args.Password != "" {
+		if !restapi.CheckLoginThrottle(c, models.LoginScopeAdmin, args.Username) {
+			return
+		}
+		if err := adminDB.Model(&user).Joins("Role").Limit(1).Find(&user, "username = ?", args.Username).Error; err != nil {
+			logrus.WithError(err).Error("failed to fetch admin user")
+			restapi.Error(c, 500, "database error")
+			return
+		}
+
+		if user.ID == 0 || !user.CheckPassword([]byte(args.Password)) {
+			restapi.RecordLoginResult(c, models.LoginScopeAdmin, args.Username, false)
+			restapi.Error(c, 400, "invalid credentials")
+			return
+		}
+	} else if pendingID := pendingTOTPLogin(session); pendingID != 0 {
+		if err := adminDB.Model(&user).Joins("Role").First(&user, pendingID).Error; err != nil {
+			restapi.Error(c, 400, "invalid credentials")
+			return
+		}
+		if !restapi.CheckLoginThrottle(c, models.LoginScopeAdmin, user.Username) {
+			return
+		}
+	} else {
+		restapi.Error(c, 400, "username and password are required")
 		return
 	}
 
-	if user.ID == 0 || !user.CheckPassword([]byte(args.Password)) {
-		restapi.Error(c, 400, "invalid credentials")
-		return
+	if user.TOTPEnabled {
+		if args.TOTPCode == "" && args.RecoveryCode == "" {
+			session.Clear()
+			session.Set("admin_totp_pending_id", user.ID)
+			session.Set("admin_totp_pending_at", time.Now().Unix())
+			_ = session.Save()
+			c.JSON(http.StatusAccepted, restapi.ResponseJSON{Success: true, Data: LoginTOTPRequiredJSON{TOTPRequired: true}})
+			return
+		}
+
+		ok, err := checkSecondFactor(adminDB, &user, args.TOTPCode, args.RecoveryCode)
+		if err != nil {
+			logrus.WithError(err).WithField("admin_id", user.ID).Error("failed to check two-factor code")
+			restapi.Error(c, 500, "database error")
+			return
+		}
+		if !ok {
+			restapi.RecordLoginResult(c, models.LoginScopeAdmin, user.Username, false)
+			restapi.Error(c, 400, "invalid two-factor code")
+			return
+		}
 	}
+	restapi.RecordLoginResult(c, models.LoginScopeAdmin, user.Username, true)
 
-	session := sessions.Default(c)
 	session.Clear()
 	session.Set("admin_id", user.ID)
 	_ = session.Save()
@@ -68,7 +124,7 @@ type ArgsChangePassword struct {
 
 // ChangePassword godoc
 // @Summary      Change Password
-// @Description  Change the password for the currently logged in administrative user
+// @Description  Change the password for the currently logged in administrative user, api tokens can't use it
 // @Tags         AdminLogin
 // @Accept       json
 // @Produce      json
@@ -105,13 +161,14 @@ func ChangePassword(c *gin.Context) {
 		restapi.Error(c, 500, "Database Error")
 		return
 	}
+	auditTarget(c, AuditTargetAdminUser, adminUser.ID, 0)
 
 	restapi.Success(c, nil)
 }
 
 // WhoAmI godoc
 // @Summary      Profile of Current Admin User
-// @Description  Get the profile and role of the current administrative user
+// @Description  Get the profile and role of the current administrative user, api tokens can't use it
 // @Tags         AdminLogin
 // @Produce      json
 // @Success      200  {object}  restapi.ResponseJSON{date=User}
@@ -120,6 +177,10 @@ func ChangePassword(c *gin.Context) {
 // @Router       /admin/whoami [post]
 // @Security ApiKeyAuth
 func WhoAmI(c *gin.Context) {
+	if !CheckPrivilege(c, PrivNone) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
 	a := FetchUser(c)
 	restapi.Success(c, a)
 }
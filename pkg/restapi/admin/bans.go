@@ -5,17 +5,27 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"net"
 	"strings"
 	"time"
+	schema "tx55/pkg/events"
 	"tx55/pkg/metalgearonline1/models"
 	"tx55/pkg/restapi"
+	"tx55/pkg/restapi/events"
 )
 
 func init() {
 	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/bans/list", ListBans)
 	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/bans/update", UpdateBans)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/bans/enforcements", ListBanEnforcements)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/bans/enforcements/:page", ListBanEnforcements)
 }
 
+var (
+	PrivReadBans   = RegisterPrivilege("read_bans", "View bans and ban evasion flags")
+	PrivUpdateBans = RegisterPrivilege("update_bans", "Create and update bans")
+)
+
 type BanJSON struct {
 	ID        uint             `json:"id"`
 	User      restapi.UserJSON `json:"user"`
@@ -24,6 +34,9 @@ type BanJSON struct {
 	BanType   string           `json:"ban_type"`
 	Reason    string           `json:"reason"`
 	ExpiresAt time.Time        `json:"expires_at"`
+	IPRange   string           `json:"ip_range,omitempty"`
+	LocalAddr string           `json:"local_addr,omitempty"`
+	LocalPort uint16           `json:"local_port,omitempty"`
 }
 
 // ListBans godoc
@@ -60,24 +73,70 @@ func ListBans(c *gin.Context) {
 			UpdatedBy: ban.UpdatedBy,
 			Reason:    ban.Reason,
 			ExpiresAt: ban.ExpiresAt,
+			IPRange:   ban.IPRange,
+			LocalAddr: ban.LocalAddr,
+			LocalPort: ban.LocalPort,
 		}
 		out = append(out, b)
 	}
 	restapi.Success(c, out)
 }
 
+// createBan creates a new ban and queues its enforcement so anyone it applies to is disconnected
+func createBan(tx *gorm.DB, ban *models.Ban) error {
+	if err := tx.Create(ban).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.ServerCommand{
+		Command:   models.CommandEnforceBan,
+		BanID:     ban.ID,
+		CreatedBy: ban.CreatedBy,
+	}).Error
+}
+
+// publishBanIssued tells the event subscribers about a new ban
+func publishBanIssued(c *gin.Context, ban models.Ban) {
+	events.Publish(c, schema.BanIssued{
+		User:      schema.User{UserID: ban.UserID},
+		BanID:     ban.ID,
+		Type:      ban.Type.String(),
+		ExpiresAt: ban.ExpiresAt,
+	})
+}
+
+// auditBan is the part of a ban recorded in the audit log
+func auditBan(ban models.Ban) map[string]any {
+	return map[string]any{
+		"user_id":    ban.UserID,
+		"ban_type":   ban.Type.String(),
+		"reason":     ban.Reason,
+		"expires_at": ban.ExpiresAt,
+		"ip_range":   ban.IPRange,
+		"local_addr": ban.LocalAddr,
+		"local_port": ban.LocalPort,
+	}
+}
+
 type ArgsUpdateBan struct {
-	BanID     uint      `json:"ban_id"`
-	BanType   string    `json:"ban_type" binding:"required" enums:"IP,User"`
-	UserID    uint      `json:"user_id" binding:"required"`
+	BanID   uint   `json:"ban_id"`
+	BanType string `json:"ban_type" binding:"required" enums:"IP,User,Range,Fingerprint"`
+	// UserID is required for IP and User bans, range and fingerprint bans can optionally record who they were for
+	UserID    uint      `json:"user_id"`
 	Reason    string    `json:"reason" binding:"required"`
 	ExpiresAt time.Time `json:"expires_at" binding:"required"`
+	// IPRange is required for Range bans, eg: 10.0.0.0/8 or 10.0.0.1-10.0.0.50
+	IPRange string `json:"ip_range"`
+	// LocalAddr is required for Fingerprint bans, a LocalPort of 0 matches any port
+	LocalAddr string `json:"local_addr"`
+	LocalPort uint16 `json:"local_port"`
 }
 
 // UpdateBans godoc
 // @Summary      Create/Update Ban
 // @Description  Can be used to create a new ban or update an existing one.
 // @Description  If `ban_id` is set to 0, a new ban will be created.
+// @Description  Range bans apply to every connection from `ip_range` and Fingerprint bans to every client reporting
+// @Description  `local_addr` (and `local_port` if it is not 0), whichever account is used.
 // @Tags         AdminLogin
 // @Accept       json
 // @Produce      json
@@ -111,36 +170,58 @@ func UpdateBans(c *gin.Context) {
 		updatedBan.Type = models.IPBan
 	case models.UserBan.String():
 		updatedBan.Type = models.UserBan
+	case models.RangeBan.String():
+		updatedBan.Type = models.RangeBan
+		if _, _, err := models.ParseIPRange(args.IPRange); err != nil {
+			restapi.Error(c, 400, "Invalid IP range: "+err.Error())
+			return
+		}
+		updatedBan.IPRange = args.IPRange
+	case models.FingerprintBan.String():
+		updatedBan.Type = models.FingerprintBan
+		if net.ParseIP(args.LocalAddr).To4() == nil {
+			restapi.Error(c, 400, "Invalid local address")
+			return
+		}
+		updatedBan.LocalAddr = args.LocalAddr
+		updatedBan.LocalPort = args.LocalPort
 	default:
 		restapi.Error(c, 400, "Invalid ban type")
+		return
+	}
+
+	if args.UserID == 0 && (updatedBan.Type == models.IPBan || updatedBan.Type == models.UserBan) {
+		restapi.Error(c, 400, "A user is required for this ban type")
+		return
 	}
 
+	var before any
 	if args.BanID <= 0 {
 		updatedBan.ID = 0
 		updatedBan.CreatedBy = adminUser.Username
 	} else {
 		updatedBan.ID = args.BanID
 		updatedBan.UpdatedBy = adminUser.Username
+
+		var original models.Ban
+		if err := db.First(&original, args.BanID).Error; err == nil {
+			before = auditBan(original)
+		}
 	}
-	if tx := db.Save(&updatedBan); tx.Error != nil {
-		l := c.MustGet("logger").(*logrus.Logger)
-		l.WithError(tx.Error).WithFields(logrus.Fields{
-			"ban_id":   args.BanID,
-			"ban_type": args.BanType,
-			"user_id":  args.UserID,
-			"admin_id": adminUser.ID,
-		}).Error("Error updating ban")
-		restapi.Error(c, 500, "Error updating ban")
-	} else {
-		updates := map[string]interface{}{}
-		var reason string
+	// The enforcement is queued with the ban so the gameservers always disconnect anyone already connected that the
+	// ban applies to
+	err := db.Transaction(func(tx *gorm.DB) error {
 		if args.BanID <= 0 {
-			reason = fmt.Sprintf("%s", args.Reason)
-		} else {
-			reason = fmt.Sprintf("\nUpdate: %s", args.Reason)
+			updatedBan.Reason = args.Reason
+			return createBan(tx, &updatedBan)
 		}
 
-		switch strings.ToLower(db.Dialector.Name()) {
+		if err := tx.Save(&updatedBan).Error; err != nil {
+			return err
+		}
+		reason := fmt.Sprintf("\nUpdate: %s", args.Reason)
+		updates := map[string]interface{}{}
+		switch strings.ToLower(tx.Dialector.Name()) {
 		case "sqlite3":
 			fallthrough
 		case "sqlite":
@@ -152,8 +233,96 @@ func UpdateBans(c *gin.Context) {
 		case "mysql":
 			updates["reason"] = gorm.Expr("CONCAT(reason, ?)", reason)
 		}
+		if err := tx.Model(&updatedBan).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ServerCommand{
+			Command:   models.CommandEnforceBan,
+			BanID:     updatedBan.ID,
+			CreatedBy: adminUser.Username,
+		}).Error
+	})
+	if err != nil {
+		l := c.MustGet("logger").(*logrus.Logger)
+		l.WithError(err).WithFields(logrus.Fields{
+			"ban_id":   args.BanID,
+			"ban_type": args.BanType,
+			"user_id":  args.UserID,
+			"admin_id": adminUser.ID,
+		}).Error("Error updating ban")
+		restapi.Error(c, 500, "Error updating ban")
+		return
+	}
 
-		db.Model(&updatedBan).Updates(updates)
-		restapi.Success(c, nil)
+	db.First(&updatedBan, updatedBan.ID)
+	auditTarget(c, AuditTargetBan, updatedBan.ID, updatedBan.UserID)
+	auditChange(c, before, auditBan(updatedBan))
+	if args.BanID <= 0 {
+		publishBanIssued(c, updatedBan)
 	}
+	restapi.Success(c, nil)
+}
+
+type BanEnforcementJSON struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	BanID     uint      `json:"ban_id"`
+	UserID    uint      `json:"user_id"`
+	LobbyID   uint32    `json:"lobby_id"`
+	IP        string    `json:"ip"`
+	GameID    uint      `json:"game_id"`
+}
+
+// ListBanEnforcements godoc
+// @Summary      List Ban Enforcements
+// @Description  Lists the connected sessions that were disconnected by the gameservers after a ban was created or
+// @Description  updated, newest first. `game_id` is set when the session was hosting a game that was closed. IPs are
+// @Description  masked without the full_ips privilege.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        page    path   int  false  "Page"
+// @Param        ban_id  query  int  false  "Only enforcements of this ban"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]BanEnforcementJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/bans/enforcements/{page} [get]
+// @Security ApiKeyAuth
+func ListBanEnforcements(c *gin.Context) {
+	if !CheckPrivilege(c, PrivReadBans) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+	db := c.MustGet("db").(*gorm.DB)
+
+	q := db.Order("created_at desc")
+	if banID := c.Query("ban_id"); banID != "" {
+		q = q.Where("ban_id = ?", banID)
+	}
+
+	var rows []models.BanEnforcement
+	if err := q.Limit(limit).Offset((page - 1) * limit).Find(&rows).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting ban enforcements")
+		restapi.Error(c, 500, "Error getting ban enforcements")
+		return
+	}
+
+	fullIPs := CheckPrivilege(c, PrivFullIPs)
+	out := make([]BanEnforcementJSON, len(rows))
+	for i, row := range rows {
+		if !fullIPs {
+			row.IP = maskAddr(row.IP)
+		}
+		out[i] = BanEnforcementJSON{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			BanID:     row.BanID,
+			UserID:    row.UserID,
+			LobbyID:   row.LobbyID,
+			IP:        row.IP,
+			GameID:    row.GameID,
+		}
+	}
+	restapi.Success(c, out)
 }
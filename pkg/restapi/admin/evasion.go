@@ -0,0 +1,191 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/bans/evasion", ListEvasionFlags)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/bans/evasion/:page", ListEvasionFlags)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/bans/evasion/:id/resolve", ResolveEvasionFlag)
+}
+
+type EvasionFlagJSON struct {
+	ID            uint             `json:"id"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	User          restapi.UserJSON `json:"user"`
+	Score         int              `json:"score"`
+	Reasons       []string         `json:"reasons"`
+	BannedUserIDs string           `json:"banned_user_ids"`
+	Status        string           `json:"status" enums:"pending,dismissed,banned"`
+	ReviewedBy    string           `json:"reviewed_by"`
+	ReviewedAt    time.Time        `json:"reviewed_at"`
+}
+
+func ToEvasionFlagJSON(flag models.EvasionFlag) EvasionFlagJSON {
+	return EvasionFlagJSON{
+		ID:            flag.ID,
+		CreatedAt:     flag.CreatedAt,
+		UpdatedAt:     flag.UpdatedAt,
+		User:          *restapi.ToUserJSON(&flag.User),
+		Score:         flag.Score,
+		Reasons:       strings.Split(flag.Reasons, "\n"),
+		BannedUserIDs: flag.BannedUserIDs,
+		Status:        flag.Status.String(),
+		ReviewedBy:    flag.ReviewedBy,
+		ReviewedAt:    flag.ReviewedAt,
+	}
+}
+
+// ListEvasionFlags godoc
+// @Summary      List Ban Evasion Flags
+// @Description  Lists new accounts that overlap with banned users or network bans, highest score first. Accounts
+// @Description  are scored when they report a connection that hasn't been seen before.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        page    path   int     false  "Page"
+// @Param        status  query  string  false  "pending (default), dismissed, banned or all"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]EvasionFlagJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/bans/evasion/{page} [get]
+// @Security ApiKeyAuth
+func ListEvasionFlags(c *gin.Context) {
+	if !CheckPrivilege(c, PrivReadBans) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+	db := c.MustGet("db").(*gorm.DB)
+
+	q := db.Joins("User").Order("evasion_flags.score desc, evasion_flags.updated_at desc")
+	switch c.DefaultQuery("status", "pending") {
+	case "pending":
+		q = q.Where("evasion_flags.status = ?", models.EvasionPending)
+	case "dismissed":
+		q = q.Where("evasion_flags.status = ?", models.EvasionDismissed)
+	case "banned":
+		q = q.Where("evasion_flags.status = ?", models.EvasionBanned)
+	case "all":
+	default:
+		restapi.Error(c, 400, "Invalid status")
+		return
+	}
+
+	var rows []models.EvasionFlag
+	if err := q.Limit(limit).Offset((page - 1) * limit).Find(&rows).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting evasion flags")
+		restapi.Error(c, 500, "Error getting evasion flags")
+		return
+	}
+
+	out := make([]EvasionFlagJSON, len(rows))
+	for i, row := range rows {
+		out[i] = ToEvasionFlagJSON(row)
+	}
+	restapi.Success(c, out)
+}
+
+type ArgsResolveEvasion struct {
+	// Ban creates a User ban for the flagged account, otherwise the flag is dismissed
+	Ban bool `json:"ban"`
+	// Reason and ExpiresAt are required when banning
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ResolveEvasionFlag godoc
+// @Summary      Resolve Ban Evasion Flag
+// @Description  Dismiss a flag, or ban the flagged account. A dismissed flag is reopened if the account's score
+// @Description  goes up later.
+// @Tags         AdminLogin
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                 true  "Flag ID"
+// @Param        body  body  ArgsResolveEvasion  true  "Resolution"
+// @Success      200  {object}  restapi.ResponseJSON{data=EvasionFlagJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/bans/evasion/{id}/resolve [post]
+// @Security ApiKeyAuth
+func ResolveEvasionFlag(c *gin.Context) {
+	if !CheckPrivilege(c, PrivUpdateBans) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	adminUser := FetchUser(c)
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	var args ArgsResolveEvasion
+	if err := c.ShouldBindJSON(&args); err != nil {
+		restapi.Error(c, 400, "Invalid arguments")
+		return
+	}
+	if args.Ban && (args.Reason == "" || args.ExpiresAt.Before(time.Now())) {
+		restapi.Error(c, 400, "A reason and future expiry are required to ban")
+		return
+	}
+
+	var flag models.EvasionFlag
+	if err := db.Joins("User").First(&flag, restapi.ParamAsUint(c, "id", 0)).Error; err != nil {
+		restapi.Error(c, 404, "Evasion flag not found")
+		return
+	}
+	if flag.Status != models.EvasionPending {
+		restapi.Error(c, 400, "Evasion flag has already been resolved")
+		return
+	}
+	before := map[string]any{"status": flag.Status.String()}
+
+	flag.Status = models.EvasionDismissed
+	flag.ReviewedBy = adminUser.Username
+	flag.ReviewedAt = time.Now()
+
+	var ban models.Ban
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if args.Ban {
+			flag.Status = models.EvasionBanned
+			ban = models.Ban{
+				UserID:    flag.UserID,
+				Type:      models.UserBan,
+				Reason:    args.Reason,
+				ExpiresAt: args.ExpiresAt,
+				CreatedBy: adminUser.Username,
+			}
+			if err := createBan(tx, &ban); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&flag).Updates(map[string]interface{}{
+			"status":      flag.Status,
+			"reviewed_by": flag.ReviewedBy,
+			"reviewed_at": flag.ReviewedAt,
+		}).Error
+	})
+	if err != nil {
+		l.WithError(err).WithFields(logrus.Fields{
+			"flag_id":  flag.ID,
+			"admin_id": adminUser.ID,
+		}).Error("Failed to resolve evasion flag")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	auditTarget(c, AuditTargetGameUser, flag.UserID, flag.UserID)
+	auditChange(c, before, map[string]any{"status": flag.Status.String()})
+	if ban.ID != 0 {
+		publishBanIssued(c, ban)
+	}
+	restapi.Success(c, ToEvasionFlagJSON(flag))
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"net"
+	"strings"
+	"tx55/pkg/restapi"
+	"tx55/pkg/restapi/events"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/events/stats", GetEventStreamStats)
+}
+
+var PrivReadEventStream = RegisterPrivilege("read_event_stream", "View the clients of the event stream and their send queues")
+
+// GetEventStreamStats godoc
+// @Summary      Event Stream Stats
+// @Description  Lists the clients connected to the event stream with their filters and send queue depths, along with
+// @Description  how many events were published, dropped for slow clients and how many slow clients were disconnected
+// @Description  since the REST API started. Addresses are masked without the full_ips privilege.
+// @Tags         AdminLogin
+// @Produce      json
+// @Success      200  {object}  restapi.ResponseJSON{data=events.Stats}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/events/stats [get]
+// @Security ApiKeyAuth
+func GetEventStreamStats(c *gin.Context) {
+	if !CheckPrivilege(c, PrivReadEventStream) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	s, _ := c.MustGet("events").(*events.Service)
+	if s == nil {
+		restapi.Error(c, 404, "the events service is disabled")
+		return
+	}
+
+	stats := s.Stats()
+	if !CheckPrivilege(c, PrivFullIPs) {
+		for i := range stats.Clients {
+			stats.Clients[i].RemoteAddr = maskAddr(stats.Clients[i].RemoteAddr)
+		}
+	}
+	restapi.Success(c, stats)
+}
+
+// maskAddr drops the port and hides the last part of an IPv4 address
+func maskAddr(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if strings.Contains(addr, ".") {
+		addr = addr[:strings.LastIndex(addr, ".")+1] + "xxx"
+	}
+	return addr
+}
@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/user/:userid/game_sessions/revoke", RevokeUserGameSessions)
+}
+
+var PrivRevokeSessions = RegisterPrivilege("revoke_sessions", "Revoke the game sessions of game users")
+
+type ResponseRevokedJSON struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// RevokeUserGameSessions godoc
+// @Summary      Revoke Game Sessions
+// @Description  Revokes every session the game was given for the user, the game has to log in with the password
+// @Description  again. A game that is already connected stays connected until it disconnects.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        user_id  path  int  true  "User ID"
+// @Success      200  {object}  restapi.ResponseJSON{data=ResponseRevokedJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/user/{user_id}/game_sessions/revoke [post]
+// @Security ApiKeyAuth
+func RevokeUserGameSessions(c *gin.Context) {
+	if !CheckPrivilege(c, PrivRevokeSessions) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+
+	uid := restapi.ParamAsUint(c, "userid", 0)
+	if uid == 0 {
+		restapi.Error(c, 400, "invalid userid")
+		return
+	}
+
+	db := c.MustGet("db").(*gorm.DB)
+	var user models.User
+	if err := db.First(&user, uid).Error; err != nil {
+		restapi.Error(c, 404, "User not found")
+		return
+	}
+
+	revoked, err := models.RevokeUserSessions(db, user.ID)
+	if err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("target_user", user.ID).Error("Failed to revoke game sessions")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	auditTarget(c, AuditTargetGameUser, user.ID, user.ID)
+	auditChange(c, map[string]any{"game_sessions": revoked}, map[string]any{"game_sessions": 0})
+	restapi.Success(c, ResponseRevokedJSON{Revoked: revoked})
+}
@@ -0,0 +1,205 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/url"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/control"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/lobbies/:lobby_id/sessions", ListLobbySessions)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/lobbies/:lobby_id/sessions/:session_id/kick", KickLobbySession)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/lobbies/:lobby_id/games/:game_id", GetLobbyGame)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/lobbies/:lobby_id/log", GetLobbyLogSettings)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/lobbies/:lobby_id/log", UpdateLobbyLogSettings)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/lobbies/:lobby_id/shutdown", ShutdownLobby)
+}
+
+var PrivManageLobbies = RegisterPrivilege("manage_lobbies", "Inspect and control running lobbies")
+
+// proxyControl forwards the request to the control api of the lobby's gameserver and passes the response through as-is
+func proxyControl(c *gin.Context, method string, path string, body io.Reader) {
+	if status, data, ok := callControl(c, method, path, body); ok {
+		c.Data(status, "application/json", data)
+	}
+}
+
+// proxyControlMasked forwards the request like proxyControl, but when the caller can't see full IPs a successful
+// response is decoded so mask can hide the addresses in it before it's sent on
+func proxyControlMasked[T any](c *gin.Context, method string, path string, mask func(*T)) {
+	status, data, ok := callControl(c, method, path, nil)
+	if !ok {
+		return
+	}
+	if status != 200 || CheckPrivilege(c, PrivFullIPs) {
+		c.Data(status, "application/json", data)
+		return
+	}
+
+	var res struct {
+		Success bool `json:"success"`
+		Data    T    `json:"data"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("path", path).Error("Error decoding gameserver control api response")
+		restapi.Error(c, 502, "Invalid response from gameserver")
+		return
+	}
+	mask(&res.Data)
+	c.JSON(status, control.ResponseJSON{Success: res.Success, Data: res.Data})
+}
+
+// callControl sends the request to the control api of the lobby's gameserver. It writes the error response and returns
+// false if the caller can't manage lobbies or the gameserver can't be reached.
+func callControl(c *gin.Context, method string, path string, body io.Reader) (int, []byte, bool) {
+	if !CheckPrivilege(c, PrivManageLobbies) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return 0, nil, false
+	}
+
+	lobbyID := uint(restapi.ParamAsInt(c, "lobby_id", 0))
+	var gameserver *configurations.GameserverControl
+	for _, g := range c.MustGet("gameservers").([]configurations.GameserverControl) {
+		if g.LobbyID == lobbyID {
+			gameserver = &g
+			break
+		}
+	}
+	if gameserver == nil {
+		restapi.Error(c, 404, "lobby has no control api configured")
+		return 0, nil, false
+	}
+
+	auditTarget(c, AuditTargetLobby, lobbyID, 0)
+	status, data, err := control.NewClient(gameserver.Address, gameserver.Token).Do(method, path, body)
+	if err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithFields(logrus.Fields{
+			"lobby_id": lobbyID,
+			"path":     path,
+		}).Error("Error contacting gameserver control api")
+		restapi.Error(c, 502, "Error contacting gameserver")
+		return 0, nil, false
+	}
+	return status, data, true
+}
+
+// ListLobbySessions godoc
+// @Summary      List Lobby Sessions
+// @Description  Lists every connection to the lobby's gameserver, including ones that have not logged in yet. IPs are
+// @Description  masked without the full_ips privilege.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        lobby_id  path  int  true  "Lobby ID"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]control.SessionJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      502  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/lobbies/{lobby_id}/sessions [get]
+// @Security ApiKeyAuth
+func ListLobbySessions(c *gin.Context) {
+	proxyControlMasked(c, "GET", "/sessions", func(sessions *[]control.SessionJSON) {
+		for i := range *sessions {
+			(*sessions)[i].IP = maskAddr((*sessions)[i].IP)
+		}
+	})
+}
+
+// KickLobbySession godoc
+// @Summary      Kick Lobby Session
+// @Description  Disconnects the session from the gameserver, any game it was hosting is closed
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        lobby_id    path  int     true  "Lobby ID"
+// @Param        session_id  path  string  true  "Session ID"
+// @Success      200  {object}  restapi.ResponseJSON
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      502  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/lobbies/{lobby_id}/sessions/{session_id}/kick [post]
+// @Security ApiKeyAuth
+func KickLobbySession(c *gin.Context) {
+	proxyControl(c, "POST", fmt.Sprintf("/sessions/%s/kick", url.PathEscape(c.Param("session_id"))), nil)
+}
+
+// GetLobbyGame godoc
+// @Summary      Get Live Game
+// @Description  Shows the current round and the players of a game hosted on the lobby
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        lobby_id  path  int  true  "Lobby ID"
+// @Param        game_id   path  int  true  "Game ID"
+// @Success      200  {object}  restapi.ResponseJSON{data=control.GameJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      502  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/lobbies/{lobby_id}/games/{game_id} [get]
+// @Security ApiKeyAuth
+func GetLobbyGame(c *gin.Context) {
+	proxyControlMasked(c, "GET", fmt.Sprintf("/games/%d", restapi.ParamAsInt(c, "game_id", 0)), func(game *control.GameJSON) {
+		game.Host.IP = maskAddr(game.Host.IP)
+	})
+}
+
+// GetLobbyLogSettings godoc
+// @Summary      Get Lobby Log Settings
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        lobby_id  path  int  true  "Lobby ID"
+// @Success      200  {object}  restapi.ResponseJSON{data=control.LogSettingsJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      502  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/lobbies/{lobby_id}/log [get]
+// @Security ApiKeyAuth
+func GetLobbyLogSettings(c *gin.Context) {
+	proxyControl(c, "GET", "/log", nil)
+}
+
+// UpdateLobbyLogSettings godoc
+// @Summary      Update Lobby Log Settings
+// @Description  Changes the log level and packet tracing of the running gameserver, the config file is unchanged
+// @Description  so a restart goes back to the configured settings.
+// @Tags         AdminLogin
+// @Accept       json
+// @Produce      json
+// @Param        lobby_id  path  int                      true  "Lobby ID"
+// @Param        body      body  control.LogSettingsJSON  true  "Log settings"
+// @Success      200  {object}  restapi.ResponseJSON{data=control.LogSettingsJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      502  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/lobbies/{lobby_id}/log [post]
+// @Security ApiKeyAuth
+func UpdateLobbyLogSettings(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		restapi.Error(c, 400, "Invalid arguments")
+		return
+	}
+	proxyControl(c, "POST", "/log", bytes.NewReader(body))
+}
+
+// ShutdownLobby godoc
+// @Summary      Shutdown Lobby
+// @Description  Gracefully shuts down the gameserver. Every session is disconnected so hosted games are closed
+// @Description  properly, the gameserver has to be started again by whatever supervises it.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        lobby_id  path  int  true  "Lobby ID"
+// @Success      200  {object}  restapi.ResponseJSON
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      502  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/lobbies/{lobby_id}/shutdown [post]
+// @Security ApiKeyAuth
+func ShutdownLobby(c *gin.Context) {
+	proxyControl(c, "POST", "/shutdown", nil)
+}
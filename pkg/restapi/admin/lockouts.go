@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/lockouts", ListLockouts)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/lockouts/:page", ListLockouts)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/lockouts/:id/clear", ClearLockout)
+}
+
+var PrivManageLockouts = RegisterPrivilege("manage_lockouts", "View and lift login lockouts")
+
+type LockoutJSON struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Scope     string    `json:"scope" enums:"game,admin"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	Failures  int64     `json:"failures"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Active    bool      `json:"active"`
+	ClearedBy string    `json:"cleared_by"`
+}
+
+func ToLockoutJSON(lockout models.LoginLockout, fullIPs bool) LockoutJSON {
+	ip := lockout.IP
+	if !fullIPs && strings.Contains(ip, ".") {
+		ip = ip[:strings.LastIndex(ip, ".")+1] + "xxx"
+	}
+	return LockoutJSON{
+		ID:        lockout.ID,
+		CreatedAt: lockout.CreatedAt,
+		Scope:     string(lockout.Scope),
+		Username:  lockout.Username,
+		IP:        ip,
+		Failures:  lockout.Failures,
+		ExpiresAt: lockout.ExpiresAt,
+		Active:    lockout.Active(),
+		ClearedBy: lockout.ClearedBy,
+	}
+}
+
+// ListLockouts godoc
+// @Summary      List Login Lockouts
+// @Description  Lists usernames and addresses locked out after too many failed logins, newest first. Addresses are
+// @Description  masked without the full_ips privilege.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        page      path   int     false  "Page"
+// @Param        scope     query  string  false  "game or admin, both by default"
+// @Param        username  query  string  false  "Only lockouts of this username"
+// @Param        all       query  bool    false  "Include expired and lifted lockouts"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]LockoutJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/lockouts/{page} [get]
+// @Security ApiKeyAuth
+func ListLockouts(c *gin.Context) {
+	if !CheckPrivilege(c, PrivManageLockouts) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	fullIPs := CheckPrivilege(c, PrivFullIPs)
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	scopes := []models.LoginScope{models.LoginScopeGame, models.LoginScopeAdmin}
+	if scope := c.Query("scope"); scope != "" {
+		scopes = []models.LoginScope{models.LoginScope(scope)}
+	}
+
+	// Admin lockouts are kept in the admin database, so each scope is read up to the end of the page and the page is
+	// cut from them together
+	var rows []models.LoginLockout
+	for _, scope := range scopes {
+		q := restapi.LoginThrottleDB(c, scope).Where("scope = ?", scope).Order("created_at desc, id desc")
+		if username := c.Query("username"); username != "" {
+			q = q.Where("username = ?", strings.ToLower(username))
+		}
+		if c.Query("all") != "true" {
+			q = q.Where("expires_at > ?", time.Now())
+		}
+
+		var scoped []models.LoginLockout
+		if err := q.Limit(page * limit).Find(&scoped).Error; err != nil {
+			c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("scope", scope).Error("Error getting lockouts")
+			restapi.Error(c, 500, "Error getting lockouts")
+			return
+		}
+		rows = append(rows, scoped...)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].CreatedAt.After(rows[j].CreatedAt)
+	})
+	if start := (page - 1) * limit; start < len(rows) {
+		rows = rows[start:]
+	} else {
+		rows = nil
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	out := make([]LockoutJSON, len(rows))
+	for i, row := range rows {
+		out[i] = ToLockoutJSON(row, fullIPs)
+	}
+	restapi.Success(c, out)
+}
+
+// ClearLockout godoc
+// @Summary      Lift Login Lockout
+// @Description  Ends a lockout early, the failed logins that caused it no longer count
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        id     path   int     true   "Lockout ID"
+// @Param        scope  query  string  false  "game (the default) or admin, the scope of the lockout"
+// @Success      200  {object}  restapi.ResponseJSON{data=LockoutJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/lockouts/{id}/clear [post]
+// @Security ApiKeyAuth
+func ClearLockout(c *gin.Context) {
+	if !CheckPrivilege(c, PrivManageLockouts) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	// Lockout ids are only unique within a scope, as the scopes are kept in different databases
+	scope := models.LoginScope(c.DefaultQuery("scope", string(models.LoginScopeGame)))
+	db := restapi.LoginThrottleDB(c, scope)
+
+	var lockout models.LoginLockout
+	if err := db.Where("scope = ?", scope).First(&lockout, restapi.ParamAsUint(c, "id", 0)).Error; err != nil {
+		restapi.Error(c, 404, "Lockout not found")
+		return
+	}
+	if !lockout.Active() {
+		restapi.Error(c, 400, "Lockout has already ended")
+		return
+	}
+
+	lockout.ExpiresAt = time.Now()
+	lockout.ClearedBy = FetchUser(c).Username
+	if err := db.Model(&lockout).Updates(map[string]interface{}{
+		"expires_at": lockout.ExpiresAt,
+		"cleared_by": lockout.ClearedBy,
+	}).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("lockout_id", lockout.ID).Error("Failed to clear lockout")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	auditTarget(c, AuditTargetLockout, lockout.ID, 0)
+	auditChange(c, map[string]any{"active": true}, map[string]any{"active": false})
+	restapi.Success(c, ToLockoutJSON(lockout, CheckPrivilege(c, PrivFullIPs)))
+}
@@ -11,8 +11,11 @@ func init() {
 	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/users/list", GetUsersAndRoles)
 	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/users/update", ManageUsers)
 	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/roles/update", ManageRoles)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/privileges/list", ListPrivileges)
 }
 
+var PrivManageUsers = RegisterPrivilege("manage_users", "Manage admin users, roles and api tokens")
+
 type ArgsManageUsers struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
@@ -74,6 +77,9 @@ func ManageUsers(c *gin.Context) {
 			restapi.Error(c, 400, tx.Error.Error())
 			return
 		}
+		adminDB.Model(&user).Joins("Role").First(&user)
+		auditTarget(c, AuditTargetAdminUser, user.ID, 0)
+		auditChange(c, nil, user)
 		restapi.Success(c, user)
 	} else {
 		user.ID = args.UserID
@@ -82,12 +88,18 @@ func ManageUsers(c *gin.Context) {
 			restapi.Error(c, 400, "cannot modify users with all privileges")
 			return
 		}
+		before := user
+		auditTarget(c, AuditTargetAdminUser, user.ID, 0)
 
 		if args.Delete {
 			if tx := adminDB.Delete(&user); tx.Error != nil {
 				restapi.Error(c, 400, tx.Error.Error())
 				return
 			}
+			if tx := adminDB.Where("user_id = ?", user.ID).Delete(&APIToken{}); tx.Error != nil {
+				l.WithError(tx.Error).Error("failed to delete api tokens of admin user")
+			}
+			auditChange(c, before, nil)
 		} else {
 			var updates User;
 			if args.Username != "" {
@@ -104,6 +116,8 @@ func ManageUsers(c *gin.Context) {
 				restapi.Error(c, 400, tx.Error.Error())
 				return
 			}
+			adminDB.Model(&user).Joins("Role").First(&user)
+			auditChange(c, before, user)
 		}
 		restapi.Success(c, user)
 	}
@@ -148,6 +162,23 @@ func GetUsersAndRoles(c *gin.Context) {
 	restapi.Success(c, UserRolesJSON{Users: users, Roles: roles})
 }
 
+// ListPrivileges godoc
+// @Summary      List Privileges
+// @Description  List every privilege that can be granted to a role or api token
+// @Tags         AdminLogin
+// @Produce      json
+// @Success      200  {object}  restapi.ResponseJSON{data=[]PrivilegeJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/privileges/list [get]
+// @Security ApiKeyAuth
+func ListPrivileges(c *gin.Context) {
+	if !CheckPrivilege(c, PrivManageUsers) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	restapi.Success(c, RegisteredPrivileges())
+}
+
 type ArgsManageRoles struct {
 	Role   Role `json:"role"`
 	Delete bool `json:"delete"`
@@ -181,17 +212,22 @@ func ManageRoles(c *gin.Context) {
 		return
 	}
 
-	changeRequiresAllPrivs := false
-	if args.Role.AllPrivileges {
-		changeRequiresAllPrivs = true
-	} else if args.Role.ID != 0 {
+	if err := args.Role.Privileges.Validate(); err != nil {
+		restapi.Error(c, 400, err.Error())
+		return
+	}
+
+	changeRequiresAllPrivs := args.Role.AllPrivileges
+	var before any
+	if args.Role.ID != 0 {
 		var original Role
 		if tx := adminDB.First(&original, args.Role.ID); tx.Error != nil {
 			l.WithError(tx.Error).Error("failed to get role")
 			restapi.Error(c, 400, "database error")
 			return
 		}
-		changeRequiresAllPrivs = original.AllPrivileges
+		changeRequiresAllPrivs = changeRequiresAllPrivs || original.AllPrivileges
+		before = original
 	}
 
 	if changeRequiresAllPrivs && !CheckPrivilege(c, PrivAll) {
@@ -228,6 +264,12 @@ func ManageRoles(c *gin.Context) {
 		}
 	}
 
+	auditTarget(c, AuditTargetRole, args.Role.ID, 0)
+	if args.Delete {
+		auditChange(c, before, nil)
+	} else {
+		auditChange(c, before, args.Role)
+	}
 	restapi.Success(c, nil)
 	return
 
@@ -4,9 +4,12 @@ import (
 	"errors"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"tx55/pkg/metalgearonline1/models"
 )
 
-var AllModels = []interface{}{&User{}, &Role{}}
+// AllModels also has the login throttle, the admin scope's failed logins and lockouts are kept in the admin database
+var AllModels = []interface{}{&User{}, &Role{}, &AuditLog{}, &APIToken{}, &RecoveryCode{},
+	&models.LoginFailure{}, &models.LoginLockout{}}
 
 type User struct {
 	ID       uint   `json:"id" gorm:"primaryKey"`
@@ -14,20 +17,21 @@ type User struct {
 	Password string `json:"-"`
 	RoleID   uint   `json:"role_id"`
 	Role     Role   `json:"role" gorm:"foreignKey:RoleID"`
+	// TOTPSecret is the base32 secret of the user's authenticator, it's only checked once TOTPEnabled is set
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPLastStep is the time step of the last accepted code, so a code can't be used twice
+	TOTPLastStep int64 `json:"-"`
 }
 
 type Role struct {
-	ID             uint   `json:"id" gorm:"primaryKey"`
-	Name           string `json:"name" gorm:"uniqueIndex"`
-	AllPrivileges  bool   `json:"all_privileges"`
-	UpdateProfiles bool   `json:"update_profiles"`
-	FullIPs        bool   `json:"full_ips"`
-	SearchByIP     bool   `json:"search_by_ip"`
-	ReadBans       bool   `json:"read_bans"`
-	UpdateBans     bool   `json:"update_bans"`
-	ManageUsers    bool   `json:"manage_users"`
-	ManageNews     bool   `json:"manage_news"`
-	ManagePolicy   bool   `json:"manage_policy"`
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	Name          string `json:"name" gorm:"uniqueIndex"`
+	AllPrivileges bool   `json:"all_privileges"`
+	// RequireTOTP stops members from doing anything until they enable two-factor authentication
+	RequireTOTP bool `json:"require_totp"`
+	// Privileges are the registered privileges granted by the role, they're ignored when AllPrivileges is set
+	Privileges PrivilegeSet `json:"privileges" gorm:"type:text"`
 }
 
 func (u *User) CheckPassword(password []byte) bool {
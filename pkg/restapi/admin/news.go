@@ -4,8 +4,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	schema "tx55/pkg/events"
 	"tx55/pkg/metalgearonline1/models"
 	"tx55/pkg/restapi"
+	"tx55/pkg/restapi/events"
 )
 
 func init() {
@@ -14,11 +16,20 @@ func init() {
 	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/policy/update", updatePolicy)
 }
 
+var (
+	PrivManageNews   = RegisterPrivilege("manage_news", "Create and edit news posts")
+	PrivManagePolicy = RegisterPrivilege("manage_policy", "Edit the policy shown in game")
+)
+
 type ArgsUpdateNews struct {
 	Topic string `json:"topic"`
 	Body  string `json:"body"`
 }
 
+func auditNews(entry models.News) ArgsUpdateNews {
+	return ArgsUpdateNews{Topic: entry.Topic, Body: entry.Body}
+}
+
 func createNews(c *gin.Context) {
 	if !CheckPrivilege(c, PrivManageNews) {
 		restapi.Error(c, 403, "Insufficient privileges")
@@ -41,6 +52,9 @@ func createNews(c *gin.Context) {
 		l.WithError(err).Error("Error creating news")
 		restapi.Error(c, 500, "Error creating news")
 	} else {
+		auditTarget(c, AuditTargetNews, entry.ID, 0)
+		auditChange(c, nil, auditNews(entry))
+		events.Publish(c, schema.NewsPublished{NewsID: entry.ID, Topic: entry.Topic})
 		restapi.Success(c, restapi.NewsJSON{
 			ID:        entry.ID,
 			CreatedAt: entry.CreatedAt,
@@ -64,12 +78,20 @@ func updateNews(c *gin.Context) {
 		return
 	}
 
+	var original models.News
+	if err := db.First(&original, id).Error; err != nil {
+		restapi.Error(c, 404, "News not found")
+		return
+	}
+	auditTarget(c, AuditTargetNews, id, 0)
+
 	if args.Topic == "" && args.Body == "" {
 		//Deleting
 		if err := db.Delete(&models.News{}, id).Error; err != nil {
 			l.WithError(err).Error("Error deleting news")
 			restapi.Error(c, 500, "Error deleting news")
 		} else {
+			auditChange(c, auditNews(original), nil)
 			restapi.Success(c, nil)
 		}
 	} else {
@@ -81,6 +103,7 @@ func updateNews(c *gin.Context) {
 			l.WithError(err).Error("Error updating news")
 			restapi.Error(c, 500, "Error updating news")
 		} else {
+			auditChange(c, auditNews(original), args)
 			restapi.Success(c, nil)
 		}
 	}
@@ -91,6 +114,10 @@ type ArgsUpdatePolicy struct {
 }
 
 func updatePolicy(c *gin.Context) {
+	if !CheckPrivilege(c, PrivManagePolicy) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
 	db := c.MustGet("db").(*gorm.DB)
 	l := c.MustGet("logger").(*logrus.Logger)
 
@@ -101,6 +128,7 @@ func updatePolicy(c *gin.Context) {
 	}
 
 	var entry models.News
+	var before ArgsUpdatePolicy
 	if err := db.Find(&entry, "topic = 'policy'").Error; err == gorm.ErrRecordNotFound {
 		entry.Topic = "policy"
 		entry.Body = args.Body
@@ -109,6 +137,7 @@ func updatePolicy(c *gin.Context) {
 		restapi.Error(c, 500, "Error getting policy")
 		return
 	} else {
+		before.Body = entry.Body
 		entry.Body = args.Body
 	}
 	if err := db.Save(&entry).Error; err != nil {
@@ -116,5 +145,7 @@ func updatePolicy(c *gin.Context) {
 		restapi.Error(c, 500, "Error saving policy")
 		return
 	}
+	auditTarget(c, AuditTargetPolicy, entry.ID, 0)
+	auditChange(c, before, args)
 	restapi.Success(c, nil)
 }
@@ -0,0 +1,157 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/user/:userid/sessions", ListUserPlaySessions)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/user/:userid/sessions/:page", ListUserPlaySessions)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/sessions/concurrent", ListConcurrentPlaySessions)
+}
+
+type AdminPlaySessionJSON struct {
+	restapi.PlaySessionJSON
+	ID          uint   `json:"id"`
+	UserID      uint   `json:"user_id"`
+	SessionID   string `json:"session_id"`
+	IP          string `json:"ip"`
+	Interrupted bool   `json:"interrupted"`
+	TakenOver   bool   `json:"taken_over"`
+}
+
+type ConcurrentPlaySessionsJSON struct {
+	User     *restapi.UserJSON      `json:"user"`
+	Sessions []AdminPlaySessionJSON `json:"sessions"`
+}
+
+func ToAdminPlaySessionJSON(p models.PlaySession, fullIPs bool) AdminPlaySessionJSON {
+	ip := p.IP
+	if !fullIPs {
+		ip = maskAddr(ip)
+	}
+	return AdminPlaySessionJSON{
+		PlaySessionJSON: restapi.ToPlaySessionJSON(p),
+		ID:              p.ID,
+		UserID:          p.UserID,
+		SessionID:       p.SessionID,
+		IP:              ip,
+		Interrupted:     p.Interrupted,
+		TakenOver:       p.TakenOver,
+	}
+}
+
+// ListUserPlaySessions godoc
+// @Summary      List Play Sessions
+// @Description  Lists when a user logged into the lobbies and from where, newest first. Addresses are masked without
+// @Description  the full_ips privilege.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        user_id  path  int  true   "User ID"
+// @Param        page     path  int  false  "Page"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]AdminPlaySessionJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/user/{user_id}/sessions/{page} [get]
+// @Security ApiKeyAuth
+func ListUserPlaySessions(c *gin.Context) {
+	if !CheckPrivilege(c, PrivSearchByIP) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	fullIPs := CheckPrivilege(c, PrivFullIPs)
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+
+	uid := restapi.ParamAsUint(c, "userid", 0)
+	if uid == 0 {
+		restapi.Error(c, 400, "invalid userid")
+		return
+	}
+
+	db := c.MustGet("db").(*gorm.DB)
+	var rows []models.PlaySession
+	if err := db.Where("user_id = ?", uid).Order("started_at desc").Limit(limit).Offset((page - 1) * limit).Find(&rows).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("target_user", uid).Error("Error getting play sessions")
+		restapi.Error(c, 500, "Error getting play sessions")
+		return
+	}
+
+	out := make([]AdminPlaySessionJSON, len(rows))
+	for i, row := range rows {
+		out[i] = ToAdminPlaySessionJSON(row, fullIPs)
+	}
+	restapi.Success(c, out)
+}
+
+// ListConcurrentPlaySessions godoc
+// @Summary      List Concurrent Play Sessions
+// @Description  Lists the users logged in more than once at the same time, across every lobby, with their open
+// @Description  sessions. Set min to 1 to list every user online. Addresses are masked without the full_ips privilege.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        min  query  int  false  "Minimum open sessions per user, 2 by default"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]ConcurrentPlaySessionsJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/sessions/concurrent [get]
+// @Security ApiKeyAuth
+func ListConcurrentPlaySessions(c *gin.Context) {
+	if !CheckPrivilege(c, PrivSearchByIP) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	fullIPs := CheckPrivilege(c, PrivFullIPs)
+	l := c.MustGet("logger").(*logrus.Logger)
+	db := c.MustGet("db").(*gorm.DB)
+
+	min := 2
+	if v := c.Query("min"); v != "" {
+		var err error
+		if min, err = strconv.Atoi(v); err != nil || min < 1 {
+			restapi.Error(c, 400, "invalid min")
+			return
+		}
+	}
+
+	// Open sessions the lobby stopped marking alive aren't online anymore
+	live := time.Now().Add(-models.DefaultPlaySessionStaleAfter)
+	var userIDs []uint
+	if err := db.Model(&models.PlaySession{}).Where("ended_at IS NULL AND heartbeat_at > ?", live).Group("user_id").
+		Having("COUNT(*) >= ?", min).Pluck("user_id", &userIDs).Error; err != nil {
+		l.WithError(err).Error("Error getting concurrent play sessions")
+		restapi.Error(c, 500, "Error getting concurrent play sessions")
+		return
+	}
+
+	out := make([]ConcurrentPlaySessionsJSON, 0, len(userIDs))
+	if len(userIDs) == 0 {
+		restapi.Success(c, out)
+		return
+	}
+
+	var rows []models.PlaySession
+	if err := db.Preload("User").Where("ended_at IS NULL AND heartbeat_at > ? AND user_id IN ?", live, userIDs).Order("user_id, started_at").Find(&rows).Error; err != nil {
+		l.WithError(err).Error("Error getting concurrent play sessions")
+		restapi.Error(c, 500, "Error getting concurrent play sessions")
+		return
+	}
+	var lastUser uint
+	for _, row := range rows {
+		if len(out) == 0 || lastUser != row.UserID {
+			lastUser = row.UserID
+			out = append(out, ConcurrentPlaySessionsJSON{User: restapi.ToUserJSON(&row.User)})
+		}
+		last := &out[len(out)-1]
+		last.Sessions = append(last.Sessions, ToAdminPlaySessionJSON(row, fullIPs))
+	}
+	restapi.Success(c, out)
+}
@@ -1,47 +1,122 @@
 package admin
 
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type Privilege string
 
+// PrivNone and PrivAll are built in, every other privilege is registered with RegisterPrivilege next to the endpoints
+// that check it
 const (
-	PrivNone           Privilege = ""
-	PrivAll            Privilege = "all_privileges"
-	PrivUpdateProfiles Privilege = "update_profiles"
-	PrivFullIPs        Privilege = "full_ips"
-	PrivSearchByIP     Privilege = "search_by_ip"
-	PrivReadBans       Privilege = "read_bans"
-	PrivUpdateBans     Privilege = "update_bans"
-	PrivManageUsers    Privilege = "manage_users"
-	PrivManageNews     Privilege = "manage_news"
-	PrivManagePolicy   Privilege = "manage_policy"
+	PrivNone Privilege = ""
+	PrivAll  Privilege = "all_privileges"
 )
 
-func (u *User) HasPrivilege(p Privilege) bool {
-	if u.Role.AllPrivileges {
-		return true
+type PrivilegeJSON struct {
+	Name        Privilege `json:"name"`
+	Description string    `json:"description"`
+}
+
+var privileges = map[Privilege]string{}
+
+// RegisterPrivilege adds a privilege that roles and api tokens can be granted, it panics if the name is reused so two
+// features can't accidentally share a privilege
+func RegisterPrivilege(name string, description string) Privilege {
+	p := Privilege(name)
+	if _, exists := privileges[p]; exists || p == PrivNone || p == PrivAll || strings.Contains(name, ",") {
+		panic(fmt.Sprintf("invalid or duplicate privilege %q", name))
+	}
+	privileges[p] = description
+	return p
+}
+
+// IsRegistered reports whether p can be granted
+func (p Privilege) IsRegistered() bool {
+	_, exists := privileges[p]
+	return exists
+}
+
+// RegisteredPrivileges returns every privilege that can be granted, sorted by name
+func RegisteredPrivileges() []PrivilegeJSON {
+	out := make([]PrivilegeJSON, 0, len(privileges))
+	for p, description := range privileges {
+		out = append(out, PrivilegeJSON{Name: p, Description: description})
 	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
 
-	switch p {
-	case PrivNone:
+// PrivilegeSet is stored as a comma separated list of privilege names
+type PrivilegeSet []Privilege
+
+func (s PrivilegeSet) Has(p Privilege) bool {
+	if p == PrivNone {
 		return true
-	case PrivAll:
-		return u.Role.AllPrivileges
-	case PrivUpdateProfiles:
-		return u.Role.UpdateProfiles
-	case PrivReadBans:
-		return u.Role.ReadBans
-	case PrivUpdateBans:
-		return u.Role.UpdateBans
-	case PrivFullIPs:
-		return u.Role.FullIPs
-	case PrivSearchByIP:
-		return u.Role.SearchByIP
-	case PrivManageUsers:
-		return u.Role.ManageUsers
-	case PrivManageNews:
-		return u.Role.ManageNews
-	case PrivManagePolicy:
-		return u.Role.ManagePolicy
 	}
-
+	for _, granted := range s {
+		if granted == p {
+			return true
+		}
+	}
 	return false
 }
+
+// Validate returns an error naming the first privilege that hasn't been registered
+func (s PrivilegeSet) Validate() error {
+	for _, p := range s {
+		if !p.IsRegistered() {
+			return fmt.Errorf("unknown privilege %q", p)
+		}
+	}
+	return nil
+}
+
+func (s PrivilegeSet) Value() (driver.Value, error) {
+	seen := map[Privilege]bool{PrivNone: true}
+	names := make([]string, 0, len(s))
+	for _, p := range s {
+		if !seen[p] {
+			seen[p] = true
+			names = append(names, string(p))
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ","), nil
+}
+
+func (s *PrivilegeSet) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a PrivilegeSet", value)
+	}
+
+	*s = PrivilegeSet{}
+	for _, name := range strings.Split(raw, ",") {
+		if name != "" {
+			*s = append(*s, Privilege(name))
+		}
+	}
+	return nil
+}
+
+func (u *User) HasPrivilege(p Privilege) bool {
+	if u.Role.AllPrivileges {
+		return true
+	}
+	if p == PrivAll {
+		return false
+	}
+	return u.Role.Privileges.Has(p)
+}
@@ -0,0 +1,211 @@
+package admin
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/achievements"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/stats/quarantine", ListQuarantinedStats)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/stats/quarantine/:page", ListQuarantinedStats)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/stats/quarantine/:id/resolve", ResolveQuarantinedStats)
+}
+
+var PrivReviewStats = RegisterPrivilege("review_stats", "Review quarantined stats and rating settings")
+
+var errAlreadyResolved = errors.New("already resolved")
+
+type QuarantinedStatsJSON struct {
+	ID         uint                    `json:"id"`
+	CreatedAt  time.Time               `json:"created_at"`
+	User       *restapi.UserJSON       `json:"user"`
+	Host       *restapi.UserJSON       `json:"host"`
+	GameID     uint                    `json:"game_id"`
+	Mode       types.GameModeString    `json:"mode"`
+	Map        types.GameMapString     `json:"map"`
+	Stats      types.HostReportedStats `json:"stats"`
+	Reasons    string                  `json:"reasons"`
+	Status     string                  `json:"status"`
+	ReviewedBy string                  `json:"reviewed_by"`
+	ReviewedAt time.Time               `json:"reviewed_at"`
+}
+
+func ToQuarantinedStatsJSON(q models.QuarantinedStats) QuarantinedStatsJSON {
+	stats, _ := q.HostReportedStats()
+	return QuarantinedStatsJSON{
+		ID:         q.ID,
+		CreatedAt:  q.CreatedAt,
+		User:       restapi.ToUserJSON(&q.User),
+		Host:       restapi.ToUserJSON(&q.Host),
+		GameID:     q.GameID,
+		Mode:       q.Mode.String(),
+		Map:        q.Map.String(),
+		Stats:      stats,
+		Reasons:    q.Reasons,
+		Status:     q.Status.String(),
+		ReviewedBy: q.ReviewedBy,
+		ReviewedAt: q.ReviewedAt,
+	}
+}
+
+// ListQuarantinedStats godoc
+// @Summary      List Quarantined Stats
+// @Description  Lists host-reported stats that were held back by the anomaly rules. Defaults to pending entries.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        page    path   int     false  "Page"
+// @Param        status  query  string  false  "pending, approved, rejected or all"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]QuarantinedStatsJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/stats/quarantine/{page} [get]
+// @Security ApiKeyAuth
+func ListQuarantinedStats(c *gin.Context) {
+	if !CheckPrivilege(c, PrivReviewStats) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+	db := c.MustGet("db").(*gorm.DB)
+
+	q := db.Joins("User").Joins("Host").Order("quarantined_stats.created_at desc")
+	switch c.DefaultQuery("status", "pending") {
+	case models.QuarantinePending.String():
+		q = q.Where("status = ?", models.QuarantinePending)
+	case models.QuarantineApproved.String():
+		q = q.Where("status = ?", models.QuarantineApproved)
+	case models.QuarantineRejected.String():
+		q = q.Where("status = ?", models.QuarantineRejected)
+	case "all":
+	default:
+		restapi.Error(c, 400, "invalid status")
+		return
+	}
+
+	var entries []models.QuarantinedStats
+	if err := q.Limit(limit).Offset((page - 1) * limit).Find(&entries).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting quarantined stats")
+		restapi.Error(c, 500, "Error getting quarantined stats")
+		return
+	}
+
+	out := make([]QuarantinedStatsJSON, len(entries))
+	for i, entry := range entries {
+		out[i] = ToQuarantinedStatsJSON(entry)
+	}
+	restapi.Success(c, out)
+}
+
+type ArgsResolveQuarantine struct {
+	// Approve applies the stats to the player, otherwise they are discarded
+	Approve bool `json:"approve"`
+}
+
+// ResolveQuarantinedStats godoc
+// @Summary      Resolve Quarantined Stats
+// @Description  Approve (apply to the player) or reject (discard) a pending quarantined stats entry
+// @Tags         AdminLogin
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                     true  "Quarantine ID"
+// @Param        body  body  ArgsResolveQuarantine  true  "Resolution"
+// @Success      200  {object}  restapi.ResponseJSON{data=QuarantinedStatsJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/stats/quarantine/{id}/resolve [post]
+// @Security ApiKeyAuth
+func ResolveQuarantinedStats(c *gin.Context) {
+	if !CheckPrivilege(c, PrivReviewStats) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	adminUser := FetchUser(c)
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	var args ArgsResolveQuarantine
+	if err := c.ShouldBindJSON(&args); err != nil {
+		restapi.Error(c, 400, "Invalid arguments")
+		return
+	}
+
+	id := restapi.ParamAsUint(c, "id", 0)
+	var entry models.QuarantinedStats
+	if err := db.Joins("User").Joins("Host").First(&entry, id).Error; err != nil {
+		restapi.Error(c, 404, "Quarantine entry not found")
+		return
+	}
+
+	if entry.Status != models.QuarantinePending {
+		restapi.Error(c, 400, "Quarantine entry has already been resolved")
+		return
+	}
+
+	stats, err := entry.HostReportedStats()
+	if err != nil {
+		l.WithError(err).WithField("quarantine_id", entry.ID).Error("Failed to decode quarantined stats")
+		restapi.Error(c, 500, "Failed to decode quarantined stats")
+		return
+	}
+
+	entry.Status = models.QuarantineRejected
+	if args.Approve {
+		entry.Status = models.QuarantineApproved
+	}
+	entry.ReviewedBy = adminUser.Username
+	entry.ReviewedAt = time.Now()
+
+	// Only resolve it if it's still pending, so two admins can't apply the same stats twice. The stats are applied in
+	// the same transaction, so an entry is never left approved without its stats.
+	updates := map[string]interface{}{
+		"status":      entry.Status,
+		"reviewed_by": entry.ReviewedBy,
+		"reviewed_at": entry.ReviewedAt,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.QuarantinedStats{}).Where("id = ? AND status = ?", entry.ID, models.QuarantinePending).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		} else if res.RowsAffected != 1 {
+			return errAlreadyResolved
+		}
+		if !args.Approve {
+			return nil
+		}
+		rules := types.GameRules{Mode: entry.Mode, Map: entry.Map}
+		_, err := models.ApplyHostReportedStats(tx, entry.UserID, rules, stats)
+		return err
+	})
+	if errors.Is(err, errAlreadyResolved) {
+		restapi.Error(c, 400, "Quarantine entry has already been resolved")
+		return
+	} else if err != nil {
+		l.WithError(err).WithFields(logrus.Fields{
+			"quarantine_id": entry.ID,
+			"admin_id":      adminUser.ID,
+		}).Error("Failed to resolve quarantined stats")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	if args.Approve {
+		if _, err := achievements.Evaluate(db, entry.UserID); err != nil {
+			l.WithError(err).WithField("quarantine_id", entry.ID).Error("Failed to evaluate achievements")
+		}
+	}
+
+	auditTarget(c, AuditTargetStats, entry.ID, entry.UserID)
+	auditChange(c, map[string]any{"status": models.QuarantinePending.String()}, map[string]any{"status": entry.Status.String()})
+	restapi.Success(c, ToQuarantinedStatsJSON(entry))
+}
@@ -0,0 +1,162 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/settings/vs_rating", GetVsRatingSource)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/settings/vs_rating", UpdateVsRatingSource)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/stats/rating_discrepancies", ListRatingDiscrepancies)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/stats/rating_discrepancies/:page", ListRatingDiscrepancies)
+}
+
+type VsRatingSourceJSON struct {
+	Source string `json:"source" binding:"required" enums:"server,host"`
+}
+
+// GetVsRatingSource godoc
+// @Summary      Get VS Rating Source
+// @Description  Returns whether the server computed or host reported VS rating is authoritative
+// @Tags         AdminLogin
+// @Produce      json
+// @Success      200  {object}  restapi.ResponseJSON{data=VsRatingSourceJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/settings/vs_rating [get]
+// @Security ApiKeyAuth
+func GetVsRatingSource(c *gin.Context) {
+	if !CheckPrivilege(c, PrivReviewStats) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	db := c.MustGet("db").(*gorm.DB)
+	restapi.Success(c, VsRatingSourceJSON{
+		Source: models.GetSetting(db, models.SettingVsRatingSource, models.DefaultVsRatingSource),
+	})
+}
+
+// UpdateVsRatingSource godoc
+// @Summary      Update VS Rating Source
+// @Description  Choose whether the server computed or host reported VS rating is authoritative. Every user's
+// @Description  current rating is replaced with the rating from the chosen source.
+// @Tags         AdminLogin
+// @Accept       json
+// @Produce      json
+// @Param        body  body  VsRatingSourceJSON  true  "Rating source"
+// @Success      200  {object}  restapi.ResponseJSON{data=VsRatingSourceJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/settings/vs_rating [post]
+// @Security ApiKeyAuth
+func UpdateVsRatingSource(c *gin.Context) {
+	if !CheckPrivilege(c, PrivAll) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	var args VsRatingSourceJSON
+	if err := c.ShouldBindJSON(&args); err != nil {
+		restapi.Error(c, 400, "Invalid arguments")
+		return
+	}
+
+	var column string
+	switch args.Source {
+	case models.VsRatingSourceServer:
+		column = "server_vs_rating"
+	case models.VsRatingSourceHost:
+		column = "host_vs_rating"
+	default:
+		restapi.Error(c, 400, "Invalid rating source")
+		return
+	}
+
+	before := VsRatingSourceJSON{
+		Source: models.GetSetting(db, models.SettingVsRatingSource, models.DefaultVsRatingSource),
+	}
+	if err := models.SetSetting(db, models.SettingVsRatingSource, args.Source); err != nil {
+		l.WithError(err).Error("Failed to save vs rating source")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	if err := db.Exec("UPDATE users SET vs_rating = " + column).Error; err != nil {
+		l.WithError(err).Error("Failed to copy vs ratings from new source")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	auditTarget(c, AuditTargetSetting, 0, 0)
+	auditChange(c, before, args)
+	restapi.Success(c, args)
+}
+
+type RatingDiscrepancyJSON struct {
+	ID           uint              `json:"id"`
+	CreatedAt    time.Time         `json:"created_at"`
+	User         *restapi.UserJSON `json:"user"`
+	Host         *restapi.UserJSON `json:"host"`
+	GameID       uint              `json:"game_id"`
+	HostRating   uint              `json:"host_rating"`
+	ServerRating uint              `json:"server_rating"`
+}
+
+// ListRatingDiscrepancies godoc
+// @Summary      List VS Rating Discrepancies
+// @Description  Lists rounds where the host reported VS rating was far from the server computed rating
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        page     path   int  false  "Page"
+// @Param        user_id  query  int  false  "Only discrepancies for this user"
+// @Param        host_id  query  int  false  "Only discrepancies reported by this host"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]RatingDiscrepancyJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/stats/rating_discrepancies/{page} [get]
+// @Security ApiKeyAuth
+func ListRatingDiscrepancies(c *gin.Context) {
+	if !CheckPrivilege(c, PrivReviewStats) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+	db := c.MustGet("db").(*gorm.DB)
+
+	q := db.Joins("User").Joins("Host").Order("rating_discrepancies.created_at desc")
+	if userID := c.Query("user_id"); userID != "" {
+		q = q.Where("rating_discrepancies.user_id = ?", userID)
+	}
+	if hostID := c.Query("host_id"); hostID != "" {
+		q = q.Where("rating_discrepancies.host_id = ?", hostID)
+	}
+
+	var rows []models.RatingDiscrepancy
+	if err := q.Limit(limit).Offset((page - 1) * limit).Find(&rows).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting rating discrepancies")
+		restapi.Error(c, 500, "Error getting rating discrepancies")
+		return
+	}
+
+	out := make([]RatingDiscrepancyJSON, len(rows))
+	for i, row := range rows {
+		out[i] = RatingDiscrepancyJSON{
+			ID:           row.ID,
+			CreatedAt:    row.CreatedAt,
+			User:         restapi.ToUserJSON(&row.User),
+			Host:         restapi.ToUserJSON(&row.Host),
+			GameID:       row.GameID,
+			HostRating:   row.HostRating,
+			ServerRating: row.ServerRating,
+		}
+	}
+	restapi.Success(c, out)
+}
@@ -0,0 +1,248 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/reports", ListReports)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/reports/:page", ListReports)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/reports/:id/resolve", ResolveReport)
+}
+
+var (
+	PrivReadReports    = RegisterPrivilege("read_reports", "View player reports")
+	PrivResolveReports = RegisterPrivilege("resolve_reports", "Resolve player reports")
+)
+
+type ReportJSON struct {
+	ID         uint             `json:"id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Reporter   restapi.UserJSON `json:"reporter"`
+	Target     restapi.UserJSON `json:"target"`
+	GameID     uint             `json:"game_id"`
+	Category   string           `json:"category"`
+	Body       string           `json:"body"`
+	Status     string           `json:"status" enums:"open,actioned,dismissed"`
+	BanID      uint             `json:"ban_id"`
+	Resolution string           `json:"resolution"`
+	ResolvedBy string           `json:"resolved_by"`
+	ResolvedAt time.Time        `json:"resolved_at"`
+}
+
+func ToReportJSON(report models.PlayerReport) ReportJSON {
+	return ReportJSON{
+		ID:         report.ID,
+		CreatedAt:  report.CreatedAt,
+		Reporter:   *restapi.ToUserJSON(&report.Reporter),
+		Target:     *restapi.ToUserJSON(&report.Target),
+		GameID:     report.GameID,
+		Category:   string(report.Category),
+		Body:       report.Body,
+		Status:     report.Status.String(),
+		BanID:      report.BanID,
+		Resolution: report.Resolution,
+		ResolvedBy: report.ResolvedBy,
+		ResolvedAt: report.ResolvedAt,
+	}
+}
+
+// ListReports godoc
+// @Summary      List Player Reports
+// @Description  Lists the moderation queue, oldest first so reports are handled in the order they came in
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        page       path   int     false  "Page"
+// @Param        status     query  string  false  "open (default), actioned, dismissed or all"
+// @Param        target_id  query  int     false  "Only reports about this user"
+// @Param        category   query  string  false  "Only reports in this category"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]ReportJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/reports/{page} [get]
+// @Security ApiKeyAuth
+func ListReports(c *gin.Context) {
+	if !CheckPrivilege(c, PrivReadReports) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+	db := c.MustGet("db").(*gorm.DB)
+
+	q := db.Joins("Reporter").Joins("Target").Order("player_reports.created_at")
+	switch c.DefaultQuery("status", "open") {
+	case "open":
+		q = q.Where("player_reports.status = ?", models.ReportOpen)
+	case "actioned":
+		q = q.Where("player_reports.status = ?", models.ReportActioned)
+	case "dismissed":
+		q = q.Where("player_reports.status = ?", models.ReportDismissed)
+	case "all":
+	default:
+		restapi.Error(c, 400, "Invalid status")
+		return
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		q = q.Where("player_reports.target_id = ?", targetID)
+	}
+	if category := c.Query("category"); category != "" {
+		q = q.Where("player_reports.category = ?", category)
+	}
+
+	var rows []models.PlayerReport
+	if err := q.Limit(limit).Offset((page - 1) * limit).Find(&rows).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting reports")
+		restapi.Error(c, 500, "Error getting reports")
+		return
+	}
+
+	out := make([]ReportJSON, len(rows))
+	for i, row := range rows {
+		out[i] = ToReportJSON(row)
+	}
+	restapi.Success(c, out)
+}
+
+type ArgsReportBan struct {
+	BanType   string    `json:"ban_type" binding:"required" enums:"IP,User"`
+	Reason    string    `json:"reason" binding:"required"`
+	ExpiresAt time.Time `json:"expires_at" binding:"required"`
+}
+
+type ArgsResolveReport struct {
+	Status     string `json:"status" binding:"required" enums:"actioned,dismissed"`
+	Resolution string `json:"resolution"`
+	// BanID links the report to an existing ban
+	BanID uint `json:"ban_id"`
+	// Ban creates a new ban of the reported user and links it to the report, it requires the update_bans privilege
+	Ban *ArgsReportBan `json:"ban"`
+}
+
+// ResolveReport godoc
+// @Summary      Resolve Player Report
+// @Description  Marks an open report as actioned or dismissed. Actioned reports can be linked to the ban they
+// @Description  resulted in, either an existing one with `ban_id` or a new one created with `ban`.
+// @Tags         AdminLogin
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                true  "Report ID"
+// @Param        body  body  ArgsResolveReport  true  "Resolution"
+// @Success      200  {object}  restapi.ResponseJSON{data=ReportJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/reports/{id}/resolve [post]
+// @Security ApiKeyAuth
+func ResolveReport(c *gin.Context) {
+	if !CheckPrivilege(c, PrivResolveReports) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	adminUser := FetchUser(c)
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	var args ArgsResolveReport
+	if err := c.ShouldBindJSON(&args); err != nil {
+		restapi.Error(c, 400, "Invalid arguments")
+		return
+	}
+
+	var report models.PlayerReport
+	if err := db.Joins("Reporter").Joins("Target").First(&report, restapi.ParamAsUint(c, "id", 0)).Error; err != nil {
+		restapi.Error(c, 404, "Report not found")
+		return
+	}
+	if report.Status != models.ReportOpen {
+		restapi.Error(c, 400, "Report has already been resolved")
+		return
+	}
+	before := map[string]any{"status": report.Status.String()}
+
+	switch args.Status {
+	case models.ReportActioned.String():
+		report.Status = models.ReportActioned
+	case models.ReportDismissed.String():
+		report.Status = models.ReportDismissed
+		if args.BanID != 0 || args.Ban != nil {
+			restapi.Error(c, 400, "Dismissed reports can't be linked to a ban")
+			return
+		}
+	default:
+		restapi.Error(c, 400, "Invalid status")
+		return
+	}
+	if args.BanID != 0 && args.Ban != nil {
+		restapi.Error(c, 400, "Provide either ban_id or ban, not both")
+		return
+	}
+
+	var ban models.Ban
+	if args.BanID != 0 {
+		if err := db.First(&ban, args.BanID).Error; err != nil {
+			restapi.Error(c, 404, "Ban not found")
+			return
+		}
+	} else if args.Ban != nil {
+		if !CheckPrivilege(c, PrivUpdateBans) {
+			restapi.Error(c, 403, "insufficient privileges")
+			return
+		}
+		switch args.Ban.BanType {
+		case models.IPBan.String():
+			ban.Type = models.IPBan
+		case models.UserBan.String():
+			ban.Type = models.UserBan
+		default:
+			restapi.Error(c, 400, "Invalid ban type")
+			return
+		}
+		ban.UserID = report.TargetID
+		ban.Reason = args.Ban.Reason
+		ban.ExpiresAt = args.Ban.ExpiresAt
+		ban.CreatedBy = adminUser.Username
+	}
+
+	report.Resolution = args.Resolution
+	report.ResolvedBy = adminUser.Username
+	report.ResolvedAt = time.Now()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if args.Ban != nil {
+			if err := createBan(tx, &ban); err != nil {
+				return err
+			}
+		}
+		report.BanID = ban.ID
+		return tx.Model(&report).Updates(map[string]interface{}{
+			"status":      report.Status,
+			"ban_id":      report.BanID,
+			"resolution":  report.Resolution,
+			"resolved_by": report.ResolvedBy,
+			"resolved_at": report.ResolvedAt,
+		}).Error
+	})
+	if err != nil {
+		l.WithError(err).WithFields(logrus.Fields{
+			"report_id": report.ID,
+			"admin_id":  adminUser.ID,
+		}).Error("Failed to resolve report")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	auditTarget(c, AuditTargetReport, report.ID, report.TargetID)
+	auditChange(c, before, map[string]any{"status": report.Status.String(), "ban_id": report.BanID})
+	if ban.ID != 0 {
+		publishBanIssued(c, ban)
+	}
+	restapi.Success(c, ToReportJSON(report))
+}
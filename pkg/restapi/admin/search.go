@@ -17,6 +17,12 @@ func init() {
 	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/ip/:ip/:page", SearchIP)
 }
 
+var (
+	PrivSearchUsers = RegisterPrivilege("search_users", "Search for game users by name")
+	PrivSearchByIP  = RegisterPrivilege("search_by_ip", "Search for game users by IP address")
+	PrivFullIPs     = RegisterPrivilege("full_ips", "See full, unmasked IP addresses")
+)
+
 // SearchPlayer godoc
 // @Summary      Search User by Display Name and Username
 // @Description  Find users by portions of their display name or username. The Display Name in this result will be in the form of `Username (Display Name)`.
@@ -26,8 +32,14 @@ func init() {
 // @Param        page  path  string  false  "Page"
 // @Success      200  {object}  restapi.ResponseJSON{data=[]restapi.UserJSON{}}
 // @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
 // @Router       /admin/search/{name}/{page} [get]
+// @Security ApiKeyAuth
 func SearchPlayer(c *gin.Context) {
+	if !CheckPrivilege(c, PrivSearchUsers) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
 	var limit = 50
 	l := c.MustGet("logger").(*logrus.Logger)
 	db := c.MustGet("db").(*gorm.DB)
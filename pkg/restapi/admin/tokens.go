@@ -0,0 +1,292 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.RegisterAdminAuthenticator(AuthenticateAPIToken)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/tokens/list", ListAPITokens)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/tokens/create", CreateAPIToken)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/tokens/:id/revoke", RevokeAPIToken)
+}
+
+const (
+	// APITokenPrefix makes tokens easy to recognise if they leak into logs or repositories
+	APITokenPrefix = "mgo_"
+	// MaxAPITokenLifetime is the furthest in the future a token can expire
+	MaxAPITokenLifetime = 365 * 24 * time.Hour
+)
+
+// APIToken lets a script or bot make admin requests without a browser session. A token can only use the privileges it
+// was scoped to, and only while its owner still holds them.
+type APIToken struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UserID    uint `gorm:"index"`
+	User      User
+	Name      string
+	// Hash is the hex sha256 of the token, the token itself is only returned when it's created
+	Hash       string       `gorm:"uniqueIndex;size:64"`
+	Privileges PrivilegeSet `gorm:"type:text"`
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return APITokenPrefix + hex.EncodeToString(buf), nil
+}
+
+// fetchAPIToken returns the token the request authenticated with, or nil for session requests
+func fetchAPIToken(c *gin.Context) *APIToken {
+	if t, exists := c.Get("api_token"); exists {
+		return t.(*APIToken)
+	}
+	return nil
+}
+
+// AuthenticateAPIToken authenticates requests with an `Authorization: Bearer <token>` header
+func AuthenticateAPIToken(c *gin.Context) bool {
+	raw, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+	adminDB := c.MustGet("adminDB").(*gorm.DB)
+
+	var token APIToken
+	if err := adminDB.Joins("User").Limit(1).Find(&token, "api_tokens.hash = ?", hashAPIToken(raw)).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting api token")
+		restapi.Error(c, 500, "database error")
+		return false
+	}
+	if token.ID == 0 || token.User.ID == 0 || token.ExpiresAt.Before(time.Now()) {
+		restapi.Error(c, 401, "invalid or expired api token")
+		return false
+	}
+
+	token.LastUsedAt = time.Now()
+	adminDB.Model(&token).UpdateColumn("last_used_at", token.LastUsedAt)
+	c.Set("admin_id", token.UserID)
+	c.Set("api_token", &token)
+	return true
+}
+
+type APITokenJSON struct {
+	ID         uint         `json:"id"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UserID     uint         `json:"user_id"`
+	Username   string       `json:"username"`
+	Name       string       `json:"name"`
+	Privileges PrivilegeSet `json:"privileges"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt time.Time    `json:"last_used_at"`
+}
+
+func ToAPITokenJSON(token APIToken) APITokenJSON {
+	return APITokenJSON{
+		ID:         token.ID,
+		CreatedAt:  token.CreatedAt,
+		UserID:     token.UserID,
+		Username:   token.User.Username,
+		Name:       token.Name,
+		Privileges: token.Privileges,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+// ListAPITokens godoc
+// @Summary      List API Tokens
+// @Description  Lists the current user's api tokens. Listing another user's tokens requires the manage_users
+// @Description  privilege. Tokens can't be listed by requests authenticated with a token.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        user_id  query  int  false  "List this admin user's tokens instead"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]APITokenJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/tokens/list [get]
+// @Security ApiKeyAuth
+func ListAPITokens(c *gin.Context) {
+	if fetchAPIToken(c) != nil {
+		restapi.Error(c, 403, "api tokens can't list api tokens")
+		return
+	}
+	userID := FetchUserID(c)
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 0)
+		if err != nil {
+			restapi.Error(c, 400, "invalid user_id")
+			return
+		}
+		userID = uint(id)
+	}
+	if userID != FetchUserID(c) && !CheckPrivilege(c, PrivManageUsers) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	adminDB := c.MustGet("adminDB").(*gorm.DB)
+
+	var tokens []APIToken
+	if err := adminDB.Joins("User").Where("api_tokens.user_id = ?", userID).Order("api_tokens.id").Find(&tokens).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting api tokens")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+
+	out := make([]APITokenJSON, len(tokens))
+	for i, token := range tokens {
+		out[i] = ToAPITokenJSON(token)
+	}
+	restapi.Success(c, out)
+}
+
+type ArgsCreateAPIToken struct {
+	Name string `json:"name" binding:"required,max=64"`
+	// Privileges must all be held by the current user, all_privileges can't be given to a token
+	Privileges PrivilegeSet `json:"privileges" binding:"required"`
+	ExpiresAt  time.Time    `json:"expires_at" binding:"required"`
+}
+
+type APITokenCreatedJSON struct {
+	APITokenJSON
+	// Token is only ever returned here, it can't be recovered later
+	Token string `json:"token"`
+}
+
+// CreateAPIToken godoc
+// @Summary      Create API Token
+// @Description  Creates an api token for the current user. Send it as `Authorization: Bearer <token>` to make admin
+// @Description  requests without a session. Tokens can't be created by requests authenticated with a token.
+// @Tags         AdminLogin
+// @Accept       json
+// @Produce      json
+// @Param        body  body  ArgsCreateAPIToken  true  "Token scope"
+// @Success      200  {object}  restapi.ResponseJSON{data=APITokenCreatedJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/tokens/create [post]
+// @Security ApiKeyAuth
+func CreateAPIToken(c *gin.Context) {
+	if fetchAPIToken(c) != nil {
+		restapi.Error(c, 403, "api tokens can't create api tokens")
+		return
+	}
+	user := FetchUser(c)
+	adminDB := c.MustGet("adminDB").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	var args ArgsCreateAPIToken
+	if err := c.ShouldBindJSON(&args); err != nil {
+		restapi.Error(c, 400, err.Error())
+		return
+	}
+	if len(args.Privileges) == 0 {
+		restapi.Error(c, 400, "a token needs at least one privilege")
+		return
+	}
+	if err := args.Privileges.Validate(); err != nil {
+		restapi.Error(c, 400, err.Error())
+		return
+	}
+	for _, p := range args.Privileges {
+		if !user.HasPrivilege(p) {
+			restapi.Error(c, 403, "you can't grant a privilege you don't have: "+string(p))
+			return
+		}
+	}
+	if args.ExpiresAt.Before(time.Now()) || args.ExpiresAt.After(time.Now().Add(MaxAPITokenLifetime)) {
+		restapi.Error(c, 400, "expires_at must be in the future and within a year")
+		return
+	}
+
+	raw, err := generateAPIToken()
+	if err != nil {
+		l.WithError(err).Error("Failed to generate api token")
+		restapi.Error(c, 500, "failed to generate token")
+		return
+	}
+	token := APIToken{
+		UserID:     user.ID,
+		User:       *user,
+		Name:       args.Name,
+		Hash:       hashAPIToken(raw),
+		Privileges: args.Privileges,
+		ExpiresAt:  args.ExpiresAt,
+	}
+	if err := adminDB.Omit("User").Create(&token).Error; err != nil {
+		l.WithError(err).WithField("admin_id", user.ID).Error("Failed to create api token")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+
+	auditTarget(c, AuditTargetAPIToken, token.ID, 0)
+	auditChange(c, nil, ToAPITokenJSON(token))
+	restapi.Success(c, APITokenCreatedJSON{APITokenJSON: ToAPITokenJSON(token), Token: raw})
+}
+
+// RevokeAPIToken godoc
+// @Summary      Revoke API Token
+// @Description  Deletes an api token so it can't be used again. Revoking another user's token requires the
+// @Description  manage_users privilege. Tokens can't be revoked by requests authenticated with a token.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        id  path  int  true  "Token ID"
+// @Success      200  {object}  restapi.ResponseJSON{}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/tokens/{id}/revoke [post]
+// @Security ApiKeyAuth
+func RevokeAPIToken(c *gin.Context) {
+	if fetchAPIToken(c) != nil {
+		restapi.Error(c, 403, "api tokens can't revoke api tokens")
+		return
+	}
+	adminDB := c.MustGet("adminDB").(*gorm.DB)
+
+	var token APIToken
+	if err := adminDB.Joins("User").Limit(1).Find(&token, "api_tokens.id = ?", restapi.ParamAsUint(c, "id", 0)).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting api token")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+	if token.ID == 0 {
+		restapi.Error(c, 404, "token not found")
+		return
+	}
+	if token.UserID != FetchUserID(c) && !CheckPrivilege(c, PrivManageUsers) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+
+	if err := adminDB.Delete(&token).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("token_id", token.ID).Error("Failed to revoke api token")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+
+	auditTarget(c, AuditTargetAPIToken, token.ID, 0)
+	auditChange(c, ToAPITokenJSON(token), nil)
+	restapi.Success(c, nil)
+}
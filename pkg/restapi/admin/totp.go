@@ -0,0 +1,514 @@
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/url"
+	"strings"
+	"time"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.RegisterMiddleware(restapi.AuthLevelAdmin, RequireTOTPEnrolment)
+	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/totp", GetTOTPStatus)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/totp/enroll", EnrollTOTP)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/totp/confirm", ConfirmTOTP)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/totp/recovery_codes", RegenerateRecoveryCodes)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/totp/disable", DisableTOTP)
+	restapi.Register(restapi.AuthLevelAdmin, "POST", "/admin/users/:id/reset_totp", ResetTOTP)
+}
+
+const (
+	TOTPIssuer = "MGO1 Admin"
+	TOTPDigits = 6
+	// TOTPPeriod is the number of seconds each code is valid for
+	TOTPPeriod = 30
+	// TOTPLoginTimeout is how long a user has to send their code after their password was accepted
+	TOTPLoginTimeout = 5 * time.Minute
+	// RecoveryCodeCount is the number of single use recovery codes handed out when 2FA is enabled
+	RecoveryCodeCount = 10
+)
+
+// totpEnrolmentPaths can be used by users whose role requires 2FA before they have enrolled
+var totpEnrolmentPaths = []string{"/admin/totp", "/admin/totp/enroll", "/admin/totp/confirm", "/admin/whoami"}
+
+// RecoveryCode is a single use code that can stand in for a TOTP code when the user has lost their authenticator
+type RecoveryCode struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"index"`
+	// Hash is the hex sha256 of the code
+	Hash string `gorm:"size:64"`
+}
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation from RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%1000000)
+}
+
+// verifyTOTP returns the time step the code is valid for, one step of clock drift is allowed either way
+func verifyTOTP(secret string, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != TOTPDigits {
+		return 0, false
+	}
+	step := now.Unix() / TOTPPeriod
+	for _, s := range []int64{step - 1, step, step + 1} {
+		if hmac.Equal([]byte(totpCode(key, s)), []byte(code)) {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func generateTOTPSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// totpURL is the otpauth:// url authenticator apps expect in the enrolment QR code
+func totpURL(username string, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", TOTPIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(TOTPDigits))
+	v.Set("period", fmt.Sprint(TOTPPeriod))
+	return "otpauth://totp/" + url.PathEscape(TOTPIssuer+":"+username) + "?" + v.Encode()
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// replaceRecoveryCodes invalidates the user's recovery codes and returns a new set
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	rows := make([]RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(buf)
+		codes[i] = code[:5] + "-" + code[5:]
+		rows[i] = RecoveryCode{UserID: userID, Hash: hashRecoveryCode(code)}
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkSecondFactor accepts a TOTP code that hasn't been used before, or consumes a recovery code
+func checkSecondFactor(adminDB *gorm.DB, user *User, totp string, recovery string) (bool, error) {
+	if totp != "" {
+		step, ok := verifyTOTP(user.TOTPSecret, totp, time.Now())
+		if !ok || step <= user.TOTPLastStep {
+			return false, nil
+		}
+		user.TOTPLastStep = step
+		return true, adminDB.Model(user).UpdateColumn("totp_last_step", step).Error
+	}
+
+	tx := adminDB.Where("user_id = ? AND hash = ?", user.ID, hashRecoveryCode(recovery)).Delete(&RecoveryCode{})
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	if tx.RowsAffected > 0 {
+		logrus.WithField("admin_id", user.ID).Warn("Admin logged in with a recovery code")
+	}
+	return tx.RowsAffected > 0, nil
+}
+
+// pendingTOTPLogin returns the user waiting to send their TOTP code, or 0 if there's no login in progress
+func pendingTOTPLogin(session sessions.Session) uint {
+	id, _ := session.Get("admin_totp_pending_id").(uint)
+	at, _ := session.Get("admin_totp_pending_at").(int64)
+	if id == 0 || time.Since(time.Unix(at, 0)) > TOTPLoginTimeout {
+		return 0
+	}
+	return id
+}
+
+// RequireTOTPEnrolment stops users whose role requires 2FA from doing anything but enrolling until they have
+func RequireTOTPEnrolment(c *gin.Context) {
+	user := FetchUser(c)
+	if user.Role.RequireTOTP && !user.TOTPEnabled {
+		for _, path := range totpEnrolmentPaths {
+			if strings.HasSuffix(c.FullPath(), path) {
+				c.Next()
+				return
+			}
+		}
+		restapi.Error(c, 403, "your role requires two-factor authentication, enroll before continuing")
+		return
+	}
+	c.Next()
+}
+
+// requireSession rejects requests made with an api token, 2FA can only be managed from a browser session
+func requireSession(c *gin.Context) bool {
+	if fetchAPIToken(c) != nil {
+		restapi.Error(c, 403, "two-factor authentication can't be managed with an api token")
+		return false
+	}
+	return true
+}
+
+type TOTPStatusJSON struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// GetTOTPStatus godoc
+// @Summary      Two-Factor Status
+// @Description  Whether the current user has two-factor authentication enabled, and whether their role requires it
+// @Tags         AdminLogin
+// @Produce      json
+// @Success      200  {object}  restapi.ResponseJSON{data=TOTPStatusJSON}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/totp [get]
+// @Security ApiKeyAuth
+func GetTOTPStatus(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	user := FetchUser(c)
+	status := TOTPStatusJSON{
+		Enabled:  user.TOTPEnabled,
+		Required: user.Role.RequireTOTP,
+	}
+	c.MustGet("adminDB").(*gorm.DB).Model(&RecoveryCode{}).Where("user_id = ?", user.ID).Count(&status.RecoveryCodesRemaining)
+	restapi.Success(c, status)
+}
+
+type TOTPEnrolmentJSON struct {
+	Secret string `json:"secret"`
+	// URL is the otpauth:// url to show as a QR code
+	URL string `json:"url"`
+}
+
+// EnrollTOTP godoc
+// @Summary      Start Two-Factor Enrolment
+// @Description  Generates a new TOTP secret for the current user. Show `url` as a QR code (or `secret` for manual
+// @Description  entry) and send a code from the authenticator to /admin/totp/confirm to enable it.
+// @Tags         AdminLogin
+// @Produce      json
+// @Success      200  {object}  restapi.ResponseJSON{data=TOTPEnrolmentJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/totp/enroll [post]
+// @Security ApiKeyAuth
+func EnrollTOTP(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	user := FetchUser(c)
+	if user.TOTPEnabled {
+		restapi.Error(c, 400, "two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Failed to generate totp secret")
+		restapi.Error(c, 500, "failed to generate secret")
+		return
+	}
+	if err := c.MustGet("adminDB").(*gorm.DB).Model(user).UpdateColumn("totp_secret", secret).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("admin_id", user.ID).Error("Failed to save totp secret")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+
+	auditTarget(c, AuditTargetAdminUser, user.ID, 0)
+	restapi.Success(c, TOTPEnrolmentJSON{Secret: secret, URL: totpURL(user.Username, secret)})
+}
+
+type ArgsTOTPCode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RecoveryCodesJSON struct {
+	// Codes are only shown once, each can be used in place of a TOTP code one time
+	Codes []string `json:"codes"`
+}
+
+// ConfirmTOTP godoc
+// @Summary      Confirm Two-Factor Enrolment
+// @Description  Enables two-factor authentication once a code from the authenticator is accepted, and returns the
+// @Description  user's recovery codes
+// @Tags         AdminLogin
+// @Accept       json
+// @Produce      json
+// @Param        body  body  ArgsTOTPCode  true  "Code from the authenticator"
+// @Success      200  {object}  restapi.ResponseJSON{data=RecoveryCodesJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/totp/confirm [post]
+// @Security ApiKeyAuth
+func ConfirmTOTP(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	user := FetchUser(c)
+	adminDB := c.MustGet("adminDB").(*gorm.DB)
+
+	var args ArgsTOTPCode
+	if err := c.ShouldBindJSON(&args); err != nil {
+		restapi.Error(c, 400, err.Error())
+		return
+	}
+	if user.TOTPEnabled {
+		restapi.Error(c, 400, "two-factor authentication is already enabled")
+		return
+	}
+	if user.TOTPSecret == "" {
+		restapi.Error(c, 400, "start enrolment first")
+		return
+	}
+	step, ok := verifyTOTP(user.TOTPSecret, args.Code, time.Now())
+	if !ok {
+		restapi.Error(c, 400, "invalid code")
+		return
+	}
+
+	var codes []string
+	err := adminDB.Transaction(func(tx *gorm.DB) (err error) {
+		if codes, err = replaceRecoveryCodes(tx, user.ID); err != nil {
+			return
+		}
+		return tx.Model(user).UpdateColumns(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error
+	})
+	if err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("admin_id", user.ID).Error("Failed to enable totp")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+
+	auditTarget(c, AuditTargetAdminUser, user.ID, 0)
+	auditChange(c, map[string]any{"totp_enabled": false}, map[string]any{"totp_enabled": true})
+	restapi.Success(c, RecoveryCodesJSON{Codes: codes})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary      Regenerate Recovery Codes
+// @Description  Replaces the current user's recovery codes, the old ones stop working
+// @Tags         AdminLogin
+// @Accept       json
+// @Produce      json
+// @Param        body  body  ArgsTOTPCode  true  "Code from the authenticator"
+// @Success      200  {object}  restapi.ResponseJSON{data=RecoveryCodesJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/totp/recovery_codes [post]
+// @Security ApiKeyAuth
+func RegenerateRecoveryCodes(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	user := FetchUser(c)
+	adminDB := c.MustGet("adminDB").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	var args ArgsTOTPCode
+	if err := c.ShouldBindJSON(&args); err != nil {
+		restapi.Error(c, 400, err.Error())
+		return
+	}
+	if !user.TOTPEnabled {
+		restapi.Error(c, 400, "two-factor authentication is not enabled")
+		return
+	}
+	ok, err := checkSecondFactor(adminDB, user, args.Code, "")
+	if err != nil {
+		l.WithError(err).WithField("admin_id", user.ID).Error("Failed to check totp code")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+	if !ok {
+		restapi.Error(c, 400, "invalid code")
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(adminDB, user.ID)
+	if err != nil {
+		l.WithError(err).WithField("admin_id", user.ID).Error("Failed to replace recovery codes")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+	auditTarget(c, AuditTargetAdminUser, user.ID, 0)
+	restapi.Success(c, RecoveryCodesJSON{Codes: codes})
+}
+
+type ArgsDisableTOTP struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// clearTOTP turns off 2FA for the user and removes their secret and recovery codes
+func clearTOTP(adminDB *gorm.DB, user *User) error {
+	return adminDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).UpdateColumns(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error
+	})
+}
+
+// DisableTOTP godoc
+// @Summary      Disable Two-Factor Authentication
+// @Description  Turns off two-factor authentication for the current user, unless their role requires it
+// @Tags         AdminLogin
+// @Accept       json
+// @Produce      json
+// @Param        body  body  ArgsDisableTOTP  true  "Password and code from the authenticator"
+// @Success      200  {object}  restapi.ResponseJSON{}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/totp/disable [post]
+// @Security ApiKeyAuth
+func DisableTOTP(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+	user := FetchUser(c)
+	adminDB := c.MustGet("adminDB").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	var args ArgsDisableTOTP
+	if err := c.ShouldBindJSON(&args); err != nil {
+		restapi.Error(c, 400, err.Error())
+		return
+	}
+	if !user.TOTPEnabled {
+		restapi.Error(c, 400, "two-factor authentication is not enabled")
+		return
+	}
+	if user.Role.RequireTOTP {
+		restapi.Error(c, 403, "your role requires two-factor authentication")
+		return
+	}
+	if !user.CheckPassword([]byte(args.Password)) {
+		restapi.Error(c, 400, "invalid password")
+		return
+	}
+	ok, err := checkSecondFactor(adminDB, user, args.Code, "")
+	if err != nil {
+		l.WithError(err).WithField("admin_id", user.ID).Error("Failed to check totp code")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+	if !ok {
+		restapi.Error(c, 400, "invalid code")
+		return
+	}
+
+	if err := clearTOTP(adminDB, user); err != nil {
+		l.WithError(err).WithField("admin_id", user.ID).Error("Failed to disable totp")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+	auditTarget(c, AuditTargetAdminUser, user.ID, 0)
+	auditChange(c, map[string]any{"totp_enabled": true}, map[string]any{"totp_enabled": false})
+	restapi.Success(c, nil)
+}
+
+// ResetTOTP godoc
+// @Summary      Reset Two-Factor Authentication
+// @Description  Turns off two-factor authentication for another admin who has lost their authenticator and recovery
+// @Description  codes. If their role requires it they'll be asked to enroll again when they next log in.
+// @Tags         AdminLogin
+// @Produce      json
+// @Param        id  path  int  true  "Admin User ID"
+// @Success      200  {object}  restapi.ResponseJSON{}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      403  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /admin/users/{id}/reset_totp [post]
+// @Security ApiKeyAuth
+func ResetTOTP(c *gin.Context) {
+	if !CheckPrivilege(c, PrivManageUsers) {
+		restapi.Error(c, 403, "insufficient privileges")
+		return
+	}
+	if !requireSession(c) {
+		return
+	}
+	adminDB := c.MustGet("adminDB").(*gorm.DB)
+
+	var user User
+	if err := adminDB.Joins("Role").Limit(1).Find(&user, "users.id = ?", restapi.ParamAsUint(c, "id", 0)).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("failed to get admin user")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+	if user.ID == 0 {
+		restapi.Error(c, 404, "user not found")
+		return
+	}
+	if user.ID == FetchUserID(c) {
+		restapi.Error(c, 400, "use /admin/totp/disable to turn off your own two-factor authentication")
+		return
+	}
+	if user.HasPrivilege(PrivAll) && !CheckPrivilege(c, PrivAll) {
+		restapi.Error(c, 403, "cannot modify users with all privileges")
+		return
+	}
+
+	before := user.TOTPEnabled
+	if err := clearTOTP(adminDB, &user); err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("admin_id", user.ID).Error("Failed to reset totp")
+		restapi.Error(c, 500, "database error")
+		return
+	}
+	auditTarget(c, AuditTargetAdminUser, user.ID, 0)
+	auditChange(c, map[string]any{"totp_enabled": before}, map[string]any{"totp_enabled": false})
+	restapi.Success(c, nil)
+}
@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyTOTP(t *testing.T) {
+	// The SHA1 test vectors from RFC 6238, truncated to 6 digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		step, ok := verifyTOTP(secret, c.code, time.Unix(c.unix, 0))
+		if !ok {
+			t.Errorf("Expected %s to be valid at %d", c.code, c.unix)
+			continue
+		}
+		if step != c.unix/TOTPPeriod {
+			t.Errorf("Expected %s to be valid for step %d, got %d", c.code, c.unix/TOTPPeriod, step)
+		}
+	}
+
+	if _, ok := verifyTOTP(secret, "287082", time.Unix(59+3*TOTPPeriod, 0)); ok {
+		t.Error("Expected a code to expire after the allowed drift")
+	}
+	if _, ok := verifyTOTP(secret, "28708", time.Unix(59, 0)); ok {
+		t.Error("Expected a short code to be rejected")
+	}
+	if _, ok := verifyTOTP("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("Expected an invalid secret to be rejected")
+	}
+}
+
+func TestRecoveryCodeNormalization(t *testing.T) {
+	if hashRecoveryCode("ab12c-3d4e5") != hashRecoveryCode(" AB12C3D4E5 ") {
+		t.Error("Expected recovery codes to ignore case, dashes and whitespace")
+	}
+}
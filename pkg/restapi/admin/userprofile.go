@@ -10,6 +10,7 @@ import (
 	"tx55/pkg/metalgearonline1/models"
 	"tx55/pkg/restapi"
 	"tx55/pkg/restapi/iso8859"
+	"tx55/pkg/restapi/validation"
 )
 
 func init() {
@@ -20,6 +21,8 @@ func init() {
 	restapi.Register(restapi.AuthLevelAdmin, "GET", "/admin/user/:userid/shared_accounts", SharedAccounts)
 }
 
+var PrivUpdateProfiles = RegisterPrivilege("update_profiles", "Edit game user profiles and emblems")
+
 type ArgsUpdateProfile struct {
 	DisplayName string `json:"display_name"`
 	Password    string `json:"password"`
@@ -56,30 +59,26 @@ func UpdateProfile(c *gin.Context) {
 
 	db := c.MustGet("db").(*gorm.DB)
 	user.ID = restapi.ParamAsUint(c, "userid", 0)
-	if args.Password != "" {
-		// If the password is being changed the User object needs to be filled in (username) for hash generation
-		if db.Model(&user).First(&user).Error != nil {
-			restapi.Error(c, 400, "invalid user id")
-			return
-		}
+	// The User object also needs to be filled in (username) for hash generation if the password is being changed
+	if db.Model(&user).First(&user).Error != nil {
+		restapi.Error(c, 400, "invalid user id")
+		return
 	}
+	before := restapi.ToUserJSON(&user)
 
+	// Admins can pick reserved names and names that look like another player's, but they still have to work in-game
 	if args.DisplayName != "" {
-		user.DisplayName, err = iso8859.EncodeAsBytes(args.DisplayName)
+		user.DisplayName, err = validation.EncodeName("display name", args.DisplayName)
 		if err != nil {
-			restapi.Error(c, 400, "display name contains invalid characters")
+			restapi.Error(c, 400, err.Error())
 			return
 		}
 	}
 
 	if args.Password != "" {
-		if len(args.Password) < 3 {
-			restapi.Error(c, 400, "password too short (minimum 3 characters)")
-			return
-		}
-		user.Password, err = iso8859.Encode(args.Password)
+		user.Password, err = validation.EncodePassword(args.Password)
 		if err != nil {
-			restapi.Error(c, 400, "password contains invalid characters")
+			restapi.Error(c, 400, err.Error())
 			return
 		}
 	}
@@ -94,7 +93,10 @@ func UpdateProfile(c *gin.Context) {
 	}
 
 	db.Model(&user).First(&user)
-	restapi.Success(c, restapi.ToUserJSON(&user))
+	after := restapi.ToUserJSON(&user)
+	auditTarget(c, AuditTargetGameUser, user.ID, user.ID)
+	auditChange(c, before, after)
+	restapi.Success(c, after)
 }
 
 type ArgsUpdateEmblem struct {
@@ -140,6 +142,10 @@ func UpdateEmblem(c *gin.Context) {
 	}
 
 	db := c.MustGet("db").(*gorm.DB)
+	var original models.User
+	db.First(&original, userID)
+	originalText, _ := iso8859.DecodeBytes(original.EmblemText)
+
 	if tx := db.Model(&models.User{
 		Model: gorm.Model{ID: userID},
 	}).Updates(map[string]interface{}{
@@ -148,9 +154,14 @@ func UpdateEmblem(c *gin.Context) {
 	}); tx.Error != nil {
 		c.MustGet("logger").(logrus.FieldLogger).WithError(tx.Error).WithFields(logrus.Fields{
 			"target_user": userID,
-			"admin_id":    c.MustGet("admin_id"),
+			"admin_id":    FetchUserID(c),
 		}).Error("failed to update game user emblem")
 	}
+	auditTarget(c, AuditTargetGameUser, userID, userID)
+	auditChange(c, ArgsUpdateEmblem{
+		HasEmblem:  original.HasEmblem,
+		EmblemText: originalText,
+	}, args)
 	restapi.Success(c, nil)
 }
 
@@ -6,10 +6,18 @@ import (
 	"gorm.io/gorm"
 )
 
-// CheckPrivilege should be the first function calls by any handler that requires a particular privilege
+// CheckPrivilege should be the first function calls by any handler that requires a particular privilege. Requests made
+// with an api token also need the privilege in the token's scope, so tokens can't use endpoints that only check PrivNone.
 func CheckPrivilege(c *gin.Context, p Privilege) bool {
 	user := FetchUser(c)
-	return user.HasPrivilege(p)
+	if !user.HasPrivilege(p) {
+		return false
+	}
+	if token := fetchAPIToken(c); token != nil && (p == PrivNone || !token.Privileges.Has(p)) {
+		return false
+	}
+	auditPrivilege(c, p)
+	return true
 }
 
 // FetchUser will grab the user+role from the database once and cache it in the request context, returning the cached
@@ -29,6 +37,10 @@ func FetchUser(c *gin.Context) *User {
 }
 
 func FetchUserID(c *gin.Context) uint {
+	// Set by authenticators for requests without a session
+	if id, exists := c.Get("admin_id"); exists {
+		return id.(uint)
+	}
 	session := sessions.Default(c)
 	return session.Get("admin_id").(uint)
 }
@@ -1,10 +1,15 @@
 package restapi
 
 import (
+	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"math"
+	"time"
 	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi/iso8859"
 )
 
 func init() {
@@ -26,6 +31,7 @@ type ArgsLogin struct {
 // @Param 	     body  body  restapi.ArgsLogin  true  "Body"
 // @Success      200  {object}  restapi.ResponseJSON{data=restapi.UserJSON{}{}}
 // @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      429  {object}  restapi.ResponseJSON{data=string}
 // @Router       /login [post]
 func Login(c *gin.Context) {
 	var args ArgsLogin
@@ -38,12 +44,21 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	db.Model(&user).First(&user, "username LIKE ?", args.Username)
+	if !CheckLoginThrottle(c, models.LoginScopeGame, args.Username) {
+		return
+	}
+
+	// Usernames are stored as ISO-8859-1, anything that can't be encoded can't match
+	if username, err := iso8859.EncodeAsBytes(args.Username); err == nil {
+		db.Model(&user).Limit(1).Find(&user, "username_canonical = ?", models.CanonicalUsername(username))
+	}
 
 	if user.ID == 0 || !user.CheckRawPassword([]byte(args.Password)) {
+		RecordLoginResult(c, models.LoginScopeGame, args.Username, false)
 		Error(c, 400, "invalid credentials")
 		return
 	}
+	RecordLoginResult(c, models.LoginScopeGame, args.Username, true)
 
 	session := sessions.Default(c)
 	session.Clear()
@@ -67,3 +82,49 @@ func Logout(c *gin.Context) {
 	_ = session.Save()
 	Success(c, nil)
 }
+
+// LoginThrottleDB is where the scope's failed logins and lockouts are kept, admin logins are kept with the rest of the
+// admin data
+func LoginThrottleDB(c *gin.Context, scope models.LoginScope) *gorm.DB {
+	if scope == models.LoginScopeAdmin {
+		return c.MustGet("adminDB").(*gorm.DB)
+	}
+	return c.MustGet("db").(*gorm.DB)
+}
+
+// CheckLoginThrottle must be called before checking a password, it responds with a 429 and returns false when the
+// attempt isn't allowed
+func CheckLoginThrottle(c *gin.Context, scope models.LoginScope, username string) bool {
+	check, err := models.CheckLogin(LoginThrottleDB(c, scope), scope, username, c.ClientIP())
+	if err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Failed to check login throttle")
+		Error(c, 500, "database error")
+		return false
+	}
+	if check.Allowed {
+		return true
+	}
+
+	wait := math.Ceil(time.Until(check.RetryAt).Seconds())
+	c.Header("Retry-After", fmt.Sprint(wait))
+	if check.Locked {
+		Error(c, 429, "too many failed logins, try again later")
+	} else {
+		Error(c, 429, fmt.Sprintf("too many failed logins, try again in %.0fs", wait))
+	}
+	return false
+}
+
+// RecordLoginResult counts a failed attempt towards the login throttle, or resets the username's delays on success
+func RecordLoginResult(c *gin.Context, scope models.LoginScope, username string, success bool) {
+	db := LoginThrottleDB(c, scope)
+	var err error
+	if success {
+		err = models.RecordLoginSuccess(db, scope, username)
+	} else {
+		err = models.RecordLoginFailure(db, scope, username, c.ClientIP())
+	}
+	if err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).WithField("scope", scope).Error("Failed to record login attempt")
+	}
+}
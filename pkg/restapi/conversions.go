@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"strconv"
 	"time"
+	"tx55/pkg/metalgearonline1/achievements"
 	"tx55/pkg/metalgearonline1/models"
 	"tx55/pkg/metalgearonline1/types"
 )
@@ -33,6 +34,60 @@ func ToUserJSON(user *models.User) *UserJSON {
 	}
 }
 
+func ToPlaySessionJSON(p models.PlaySession) PlaySessionJSON {
+	return PlaySessionJSON{
+		LobbyID:   p.LobbyID,
+		StartedAt: p.StartedAt,
+		EndedAt:   p.EndedAt,
+		Seconds:   int64(p.Duration(models.DefaultPlaySessionStaleAfter).Seconds()),
+		Online:    p.Online(models.DefaultPlaySessionStaleAfter),
+	}
+}
+
+func ToSeasonJSON(season models.Season) SeasonJSON {
+	return SeasonJSON{
+		ID:        season.ID,
+		Name:      season.Name,
+		Kind:      season.Kind.String(),
+		StartedAt: season.StartedAt,
+		EndedAt:   season.EndedAt,
+	}
+}
+
+func ToAwardJSON(award models.AwardHistory) AwardJSON {
+	return AwardJSON{
+		Award:      award.Award,
+		EmblemText: types.BytesToString(award.EmblemText),
+		AwardedAt:  award.CreatedAt,
+		ExpiresAt:  award.ExpiresAt,
+		Expired:    award.Expired,
+	}
+}
+
+func ToAchievementJSON(a achievements.Achievement) AchievementJSON {
+	return AchievementJSON{
+		Key:         a.Key,
+		Name:        a.Name,
+		Description: a.Description,
+		Stat:        a.Stat,
+		Mode:        a.Mode,
+		ModeString:  a.Mode.String(),
+		Threshold:   a.Threshold,
+	}
+}
+
+func ToAchievementProgressJSON(p achievements.Progress) AchievementProgressJSON {
+	out := AchievementProgressJSON{
+		AchievementJSON: ToAchievementJSON(p.Achievement),
+		Value:           p.Value,
+		Unlocked:        p.Unlocked,
+	}
+	if p.Unlocked {
+		out.UnlockedAt = &p.UnlockedAt
+	}
+	return out
+}
+
 func ToPlayerStatsJSON(stats models.PlayerStats) PlayerStatsJSON {
 	return PlayerStatsJSON{
 		UserID:       stats.UserID,
@@ -43,6 +98,7 @@ func ToPlayerStatsJSON(stats models.PlayerStats) PlayerStatsJSON {
 		ModeString:   stats.Mode.String(),
 		Map:          stats.Map,
 		MapString:    stats.Map.String(),
+		SeasonID:     stats.SeasonID,
 
 		Rank: stats.Rank,
 
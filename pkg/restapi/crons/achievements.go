@@ -0,0 +1,31 @@
+package crons
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/achievements"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+// EvaluateAchievements checks everyone who played in the last day for achievements. The gameserver unlocks them as
+// stats come in, this picks up anything it missed along with newly added achievements.
+func EvaluateAchievements(db *gorm.DB) {
+	var users []uint
+	q := db.Model(&models.PlayerStats{}).Distinct("user_id").Where("period = ? AND updated_at > ?", types.PeriodAllTime, time.Now().AddDate(0, 0, -1))
+	if err := q.Pluck("user_id", &users).Error; err != nil {
+		l.WithError(err).Error("failed to find users to evaluate achievements for")
+		return
+	}
+
+	unlockCount := 0
+	for _, userID := range users {
+		unlocked, err := achievements.Evaluate(db, userID)
+		if err != nil {
+			l.WithError(err).WithField("user_id", userID).Error("failed to evaluate achievements")
+			continue
+		}
+		unlockCount += len(unlocked)
+	}
+	l.WithField("users", len(users)).WithField("unlocked", unlockCount).Info("evaluated achievements")
+}
@@ -0,0 +1,266 @@
+package crons
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+	"tx55/pkg/restapi/iso8859"
+)
+
+const (
+	CriteriaTopRank            = "top_rank"
+	CriteriaMostHeadShots      = "most_headshots"
+	CriteriaMostKerotansPlaced = "most_kerotans_placed"
+	CriteriaVsRatingLeader     = "vs_rating_leader"
+)
+
+const defaultAwardDays = 7
+
+// awardExpiryGrace lets awards that expire at the same time as the weekly rotation expire in that rotation instead of
+// an hour later
+const awardExpiryGrace = time.Minute
+
+// DefaultAwards is used when no awards are configured and matches the original weekly champion emblem
+var DefaultAwards = []configurations.AwardConfig{
+	{Name: "champion", EmblemText: "Champion", Criteria: CriteriaTopRank},
+}
+
+// awardStatColumns are the weekly player_stats columns summed up to judge each criteria
+var awardStatColumns = map[string]string{
+	CriteriaTopRank:            "points",
+	CriteriaMostHeadShots:      "head_shots",
+	CriteriaMostKerotansPlaced: "kerotans_placed",
+}
+
+// ValidateAwards checks the award configuration so mistakes are found at startup and not when the weekly cron runs
+func ValidateAwards(awards []configurations.AwardConfig) error {
+	names := map[string]bool{}
+	for _, award := range awards {
+		if award.Name == "" {
+			return errors.New("award is missing a name")
+		}
+		if names[award.Name] {
+			return fmt.Errorf("award %q is defined more than once", award.Name)
+		}
+		names[award.Name] = true
+
+		emblem, err := iso8859.EncodeAsBytes(award.EmblemText)
+		if err != nil || len(emblem) == 0 || len(emblem) > 16 {
+			return fmt.Errorf("award %q must have an emblem text of 1 to 16 ISO-8859-1 characters", award.Name)
+		}
+		if _, found := awardStatColumns[award.Criteria]; !found && award.Criteria != CriteriaVsRatingLeader {
+			return fmt.Errorf("award %q has unknown criteria %q", award.Name, award.Criteria)
+		}
+		if award.Mode != "" {
+			if award.Criteria == CriteriaVsRatingLeader {
+				return fmt.Errorf("award %q can't limit the VS rating leader to a mode", award.Name)
+			}
+			if mode := types.GameModeString(award.Mode).GameMode(); mode == types.ModeInvalid || mode == types.ModeOverall {
+				return fmt.Errorf("award %q has unknown mode %q", award.Name, award.Mode)
+			}
+		}
+		if award.Count < 0 || award.Days < 0 {
+			return fmt.Errorf("award %q can't have a negative count or days", award.Name)
+		}
+	}
+	return nil
+}
+
+// RotateAwards expires finished awards and hands out each award to its new winners. It must run before the weekly
+// stats are cleared.
+func RotateAwards(db *gorm.DB, awards []configurations.AwardConfig) {
+	if len(awards) == 0 {
+		awards = DefaultAwards
+	}
+
+	ExpireAwards(db)
+
+	for _, award := range awards {
+		var exclude []uint
+		if !award.AllowRepeat {
+			var err error
+			if exclude, err = previousWinners(db, award.Name); err != nil {
+				l.WithError(err).WithField("award", award.Name).Error("failed to find previous award winners")
+				continue
+			}
+		}
+		winners, err := findAwardWinners(db, award, exclude)
+		if err != nil {
+			l.WithError(err).WithField("award", award.Name).Error("failed to find award winners")
+			continue
+		}
+		if len(winners) == 0 {
+			l.WithField("award", award.Name).Info("no winners for award")
+			continue
+		}
+		for _, userID := range winners {
+			if err = grantAward(db, award, userID); err != nil {
+				l.WithError(err).WithField("award", award.Name).WithField("user_id", userID).Error("failed to grant award")
+			}
+		}
+	}
+}
+
+// ExpireAwards puts back the previous emblem of every user whose award has run out. If the user's emblem has since
+// been replaced, by another award or an admin, it is left alone.
+func ExpireAwards(db *gorm.DB) {
+	// Newest first, so when a user holds several awards each one restores the emblem of the award before it
+	var expired []models.AwardHistory
+	if err := db.Where("expired = ? AND expires_at <= ?", false, time.Now().Add(awardExpiryGrace)).Order("id desc").Find(&expired).Error; err != nil {
+		l.WithError(err).Error("failed to find expired awards")
+		return
+	}
+
+	for _, grant := range expired {
+		if err := expireAward(db, grant); err != nil {
+			l.WithError(err).WithField("award_history_id", grant.ID).Error("failed to expire award")
+		}
+	}
+}
+
+func expireAward(db *gorm.DB, grant models.AwardHistory) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Another run may have already expired it
+		res := tx.Model(&models.AwardHistory{}).Where("id = ? AND expired = ?", grant.ID, false).Update("expired", true)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		var user models.User
+		if err := tx.First(&user, grant.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		if user.HasEmblem && bytes.Equal(user.EmblemText, grant.EmblemText) {
+			return tx.Model(&user).Updates(map[string]interface{}{
+				"has_emblem":  grant.PreviousHasEmblem,
+				"emblem_text": grant.PreviousEmblemText,
+			}).Error
+		}
+
+		// A newer award is covering this one, it should restore what this award replaced instead
+		return tx.Model(&models.AwardHistory{}).
+			Where("user_id = ? AND expired = ? AND id > ? AND previous_has_emblem = ? AND previous_emblem_text = ?", user.ID, false, grant.ID, true, grant.EmblemText).
+			Updates(map[string]interface{}{
+				"previous_has_emblem":  grant.PreviousHasEmblem,
+				"previous_emblem_text": grant.PreviousEmblemText,
+			}).Error
+	})
+}
+
+// previousWinners is everyone given the award in its last rotation, whether it has expired yet or not
+func previousWinners(db *gorm.DB, name string) (winners []uint, err error) {
+	var last models.AwardHistory
+	if err = db.Where("award = ?", name).Order("created_at desc").Limit(1).Find(&last).Error; err != nil || last.ID == 0 {
+		return
+	}
+	err = db.Model(&models.AwardHistory{}).
+		Where("award = ? AND created_at > ?", name, last.CreatedAt.Add(-time.Hour)).
+		Pluck("user_id", &winners).Error
+	return
+}
+
+func findAwardWinners(db *gorm.DB, award configurations.AwardConfig, exclude []uint) (winners []uint, err error) {
+	count := award.Count
+	if count == 0 {
+		count = 1
+	}
+
+	if award.Criteria == CriteriaVsRatingLeader {
+		q := db.Model(&models.User{}).Where("vs_rating > 0").Order("vs_rating desc").Limit(count)
+		if len(exclude) > 0 {
+			q = q.Where("id NOT IN ?", exclude)
+		}
+		err = q.Pluck("id", &winners).Error
+		return
+	}
+
+	column, found := awardStatColumns[award.Criteria]
+	if !found {
+		err = fmt.Errorf("unknown criteria %q", award.Criteria)
+		return
+	}
+
+	q := db.Model(&models.PlayerStats{}).
+		Where("period = ?", types.PeriodWeekly).
+		Group("user_id").
+		Having("SUM(play_time) > 0 AND SUM(" + column + ") > 0").
+		Order("SUM(" + column + ") DESC").
+		Limit(count)
+	if award.Mode != "" {
+		q = q.Where("mode = ?", types.GameModeString(award.Mode).GameMode())
+	}
+	if len(exclude) > 0 {
+		q = q.Where("user_id NOT IN ?", exclude)
+	}
+	err = q.Pluck("user_id", &winners).Error
+	return
+}
+
+func grantAward(db *gorm.DB, award configurations.AwardConfig, userID uint) error {
+	emblem, err := iso8859.EncodeAsBytes(award.EmblemText)
+	if err != nil {
+		return err
+	}
+	days := award.Days
+	if days == 0 {
+		days = defaultAwardDays
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		grant := models.AwardHistory{
+			UserID:             user.ID,
+			Award:              award.Name,
+			EmblemText:         emblem,
+			PreviousHasEmblem:  user.HasEmblem,
+			PreviousEmblemText: user.EmblemText,
+			ExpiresAt:          time.Now().AddDate(0, 0, days),
+		}
+
+		// Winning an award that is still held replaces it, keeping the emblem from before the first win if it's
+		// still being shown
+		var held models.AwardHistory
+		if err := tx.Where("user_id = ? AND award = ? AND expired = ?", user.ID, award.Name, false).Limit(1).Find(&held).Error; err != nil {
+			return err
+		}
+		if held.ID != 0 {
+			if err := tx.Model(&held).Update("expired", true).Error; err != nil {
+				return err
+			}
+			if user.HasEmblem && bytes.Equal(user.EmblemText, held.EmblemText) {
+				grant.PreviousHasEmblem = held.PreviousHasEmblem
+				grant.PreviousEmblemText = held.PreviousEmblemText
+			}
+		}
+
+		if err := tx.Create(&grant).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"has_emblem":  true,
+			"emblem_text": emblem,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.Notification{
+			UserID: user.ID,
+			Title:  "Award: " + award.EmblemText,
+			Body:   fmt.Sprintf("Congratulations! You have earned the %s emblem, it is yours until %s.", award.EmblemText, grant.ExpiresAt.Format("January 2")),
+		}).Error
+	})
+}
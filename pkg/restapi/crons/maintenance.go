@@ -2,13 +2,29 @@ package crons
 
 import (
 	"gorm.io/gorm"
+	"tx55/pkg/metalgearonline1/models"
 )
 
-func ClearOldSessions(db *gorm.DB) {
-	db.Exec(`DELETE FROM sessions WHERE created_at < DATE_SUB(NOW(), INTERVAL 14 DAY) 
-                 AND id NOT IN (
-                     SELECT id FROM (
-                         SELECT id, user_id FROM sessions GROUP BY user_id HAVING MAX(created_at)
-                     ) AS newest_sessions
-                 )`)
+func ClearExpiredSessions(db *gorm.DB) {
+	if err := models.ClearExpiredSessions(db); err != nil {
+		l.WithError(err).Error("failed to clear expired sessions")
+	}
+}
+
+func ClearOldLoginFailures(db *gorm.DB) {
+	if err := models.ClearOldLoginFailures(db); err != nil {
+		l.WithError(err).Error("failed to clear old login failures")
+	}
+}
+
+func ClearOldStreamEvents(db *gorm.DB, days int) {
+	if err := models.ClearOldStreamEvents(db, days); err != nil {
+		l.WithError(err).Error("failed to clear old stream events")
+	}
+}
+
+func ClearOldPopulationSamples(db *gorm.DB, days int) {
+	if err := models.ClearOldPopulationSamples(db, days); err != nil {
+		l.WithError(err).Error("failed to clear old population samples")
+	}
 }
@@ -0,0 +1,19 @@
+package crons
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+)
+
+const (
+	DefaultPopulationSampleMinutes = 5
+	DefaultPopulationRetentionDays = 365
+)
+
+func SamplePopulation(db *gorm.DB) {
+	// Truncated so the samples of a run share a timestamp that lines up with the hourly buckets
+	if err := models.SamplePopulation(db, time.Now().UTC().Truncate(time.Minute)); err != nil {
+		l.WithError(err).Error("failed to sample population")
+	}
+}
@@ -3,16 +3,25 @@ package crons
 import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"tx55/pkg/configurations"
 	"tx55/pkg/metalgearonline1/models"
 	"tx55/pkg/metalgearonline1/types"
 )
 
 var l = logrus.WithField("pkg", "crons")
 
-func ClearWeeklyStats(db *gorm.DB) {
-	// Before we clear weekly, we need to update ranks and then award the champion
+func ClearWeeklyStats(db *gorm.DB, awards []configurations.AwardConfig) {
+	// Before we clear weekly, we need to update ranks and then hand out the awards
 	UpdateRankings(db)
-	AwardChampion(db)
+	RotateAwards(db, awards)
+
+	// Keep a copy of the week in the season archives, the week is not cleared if that fails so nothing is lost
+	season, err := ArchiveWeeklyStats(db)
+	if err != nil {
+		l.WithError(err).Error("failed to archive weekly stats, not clearing them")
+		return
+	}
+	l.WithField("season_id", season.ID).Info("archived weekly stats")
 
 	updates := map[string]interface{}{
 		"kills":                0,
@@ -49,47 +58,24 @@ func ClearWeeklyStats(db *gorm.DB) {
 	}
 }
 
-func AwardChampion(db *gorm.DB) {
-	emblemText := "Champion"
-
-	// Find and clear the old chamption
-	var oldChampion, newChampion models.User
-	if err := db.Model(&models.User{}).Where("emblem_text = ?", emblemText).First(&oldChampion).Error; err != nil {
-		l.WithError(err).Error("failed to find oldChampion")
-	} else {
-		db.Model(oldChampion).Updates(map[string]interface{}{
-			"has_emblem":  false,
-			"emblem_text": "",
-		})
-	}
-
-	// Now find the new champion, but don't give it to the same user who had it last week
-	if err := db.Model(&models.User{}).Order("weekly_rank desc").Where("id != ? AND NOT has_emblem", oldChampion.ID).First(&newChampion).Error; err != nil {
-		l.WithError(err).Error("failed to find a new champion")
-		return
-	}
-	db.Model(&newChampion).Updates(map[string]interface{}{
-		"has_emblem":  true,
-		"emblem_text": emblemText,
-	})
-}
-
 //goland:noinspection Annotator,Annotator,Annotator,Annotator,Annotator,Annotator,Annotator,Annotator
 func UpdateRankings(db *gorm.DB) {
 	// The innerQuery is the key query. It queries for every user and generates their rank for each period/mode
 	// The selector takes that query down to a single result that is good for the update query
 
+	// Archived season stats(period 2) keep the rank they had when archived so are left out of every query.
+
 	// Update the player_stats rank entries. These are stored with each period/mode/map entry. But as ranks in-game are
 	// only shown on a per period/mode basis that is all we update to reflect
-	innerQuery := "SELECT user_id, mode, period, rank() OVER (PARTITION BY mode, period ORDER BY SUM(points) DESC) AS `rank` FROM player_stats GROUP BY user_id, mode, period"
+	innerQuery := "SELECT user_id, mode, period, rank() OVER (PARTITION BY mode, period ORDER BY SUM(points) DESC) AS `rank` FROM player_stats WHERE period != 2 GROUP BY user_id, mode, period"
 	selectorQuery := "SELECT `rank` from (" + innerQuery + ") as t WHERE t.user_id=player_stats.user_id AND t.mode=player_stats.mode AND t.period=player_stats.period"
-	updateQuery := "UPDATE player_stats SET `rank` = (" + selectorQuery + ")"
+	updateQuery := "UPDATE player_stats SET `rank` = (" + selectorQuery + ") WHERE period != 2"
 	if tx := db.Exec(updateQuery); tx.Error != nil {
 		l.WithError(tx.Error).Error("failed to update rankings")
 	}
 
 	// Update the Overall period(0) ranks in the users table
-	innerQuery = "SELECT user_id, period, rank() OVER (PARTITION BY period ORDER BY SUM(points) DESC) AS `rank` FROM player_stats GROUP BY user_id, period"
+	innerQuery = "SELECT user_id, period, rank() OVER (PARTITION BY period ORDER BY SUM(points) DESC) AS `rank` FROM player_stats WHERE period != 2 GROUP BY user_id, period"
 	selectorQuery = "SELECT `rank` from (" + innerQuery + ") as t WHERE t.user_id=users.id AND t.period=0"
 	updateQuery = "UPDATE users SET overall_rank = (" + selectorQuery + ")"
 	if tx := db.Exec(updateQuery); tx.Error != nil {
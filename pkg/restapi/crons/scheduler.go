@@ -1,20 +1,79 @@
 package crons
 
 import (
+	"fmt"
 	"github.com/go-co-op/gocron"
 	"gorm.io/gorm"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi/events"
 )
 
-func Schedule(s *gocron.Scheduler, db *gorm.DB) error {
+func Schedule(s *gocron.Scheduler, db *gorm.DB, adminDB *gorm.DB, config configurations.RestAPI) error {
+	if err := ValidateAwards(config.Awards); err != nil {
+		return err
+	}
+
 	if _, err := s.Every(1).Hour().Do(UpdateRankings, db); err != nil {
 		return err
 	}
-	if _, err := s.Every(1).Day().Monday().At("00:00").Do(ClearWeeklyStats, db); err != nil {
+	if _, err := s.Every(1).Hour().Do(ExpireAwards, db); err != nil {
+		return err
+	}
+	if _, err := s.Every(1).Day().Monday().At("00:00").Do(ClearWeeklyStats, db, config.Awards); err != nil {
+		return err
+	}
+	if _, err := s.Every(1).Day().At("00:00").Do(ClearExpiredSessions, db); err != nil {
+		return err
+	}
+	if _, err := s.Every(1).Hour().Do(ClearOldLoginFailures, db); err != nil {
+		return err
+	}
+	// Admin logins are throttled in the admin database
+	if _, err := s.Every(1).Hour().Do(ClearOldLoginFailures, adminDB); err != nil {
 		return err
 	}
-	if _, err := s.Every(1).Day().At("00:00").Do(ClearOldSessions, db); err != nil {
+	if _, err := s.Every(1).Day().At("01:00").Do(EvaluateAchievements, db); err != nil {
 		return err
 	}
+	if config.Events.Enabled && config.Events.HistoryRetentionDays >= 0 {
+		days := config.Events.HistoryRetentionDays
+		if days == 0 {
+			days = events.DefaultHistoryRetentionDays
+		}
+		if _, err := s.Every(1).Day().At("02:00").Do(ClearOldStreamEvents, db, days); err != nil {
+			return err
+		}
+	}
+	if config.Population.SampleMinutes >= 0 {
+		minutes := config.Population.SampleMinutes
+		if minutes == 0 {
+			minutes = DefaultPopulationSampleMinutes
+		}
+		if _, err := s.Every(minutes).Minutes().Do(SamplePopulation, db); err != nil {
+			return err
+		}
+	}
+	if config.Population.RetentionDays >= 0 {
+		days := config.Population.RetentionDays
+		if days == 0 {
+			days = DefaultPopulationRetentionDays
+		}
+		if _, err := s.Every(1).Day().At("02:30").Do(ClearOldPopulationSamples, db, days); err != nil {
+			return err
+		}
+	}
+
+	if config.Seasons.Length != "" {
+		kind := models.SeasonKindFromString(config.Seasons.Length)
+		if kind != models.SeasonMonthly && kind != models.SeasonQuarterly {
+			return fmt.Errorf("invalid season length %q", config.Seasons.Length)
+		}
+		// Runs after the weekly clear so a week ending on the first of the month is included
+		if _, err := s.Every(1).Month(1).At("00:30").Do(ArchiveLongSeason, db, kind); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
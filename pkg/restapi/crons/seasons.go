@@ -0,0 +1,183 @@
+package crons
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+)
+
+// ArchiveWeeklyStats snapshots the current weekly stats, ranks included, into a new weekly season. It should be run
+// after the rankings are updated and before the weekly stats are cleared.
+func ArchiveWeeklyStats(db *gorm.DB) (season models.Season, err error) {
+	now := time.Now()
+	season = models.Season{
+		Name:      fmt.Sprintf("Week of %s", now.AddDate(0, 0, -7).Format("2006-01-02")),
+		Kind:      models.SeasonWeekly,
+		StartedAt: previousSeasonEnd(db, models.SeasonWeekly, now.AddDate(0, 0, -7)),
+		EndedAt:   now,
+	}
+
+	var weekly []models.PlayerStats
+	if err = db.Where("period = ? AND play_time > 0", types.PeriodWeekly).Find(&weekly).Error; err != nil {
+		return
+	}
+
+	archive := make([]models.PlayerStats, len(weekly))
+	for i, stats := range weekly {
+		archive[i] = models.PlayerStats{
+			UserID: stats.UserID,
+			Mode:   stats.Mode,
+			Map:    stats.Map,
+			Period: types.PeriodArchive,
+			Rank:   stats.Rank,
+		}
+		archive[i].FromHostReportedStats(stats.ToHostReportedStats())
+	}
+
+	err = saveSeason(db, &season, archive)
+	return
+}
+
+// ArchiveLongSeason rolls the weekly seasons that ended since the last season of this kind into a single season.
+// Monthly seasons are archived every time it runs, quarterly ones only on the first month of the quarter.
+func ArchiveLongSeason(db *gorm.DB, kind models.SeasonKind) {
+	now := time.Now()
+
+	var name string
+	switch kind {
+	case models.SeasonMonthly:
+		name = now.AddDate(0, -1, 0).Format("January 2006")
+	case models.SeasonQuarterly:
+		if now.Month()%3 != 1 {
+			return
+		}
+		last := now.AddDate(0, -1, 0)
+		name = fmt.Sprintf("Q%d %d", (last.Month()-1)/3+1, last.Year())
+	default:
+		l.WithField("kind", kind).Error("invalid season kind for long season")
+		return
+	}
+
+	season := models.Season{
+		Name:      name,
+		Kind:      kind,
+		StartedAt: previousSeasonEnd(db, kind, time.Time{}),
+		EndedAt:   now,
+	}
+
+	var weeks []uint
+	q := db.Model(&models.Season{}).Where("kind = ? AND ended_at > ? AND ended_at <= ?", models.SeasonWeekly, season.StartedAt, season.EndedAt)
+	if err := q.Pluck("id", &weeks).Error; err != nil {
+		l.WithError(err).WithField("kind", kind.String()).Error("failed to find weekly seasons")
+		return
+	}
+
+	if len(weeks) == 0 {
+		l.WithField("kind", kind.String()).Info("no weekly seasons to archive")
+		return
+	}
+
+	var weekly []models.PlayerStats
+	if err := db.Where("period = ? AND season_id IN ?", types.PeriodArchive, weeks).Find(&weekly).Error; err != nil {
+		l.WithError(err).WithField("kind", kind.String()).Error("failed to fetch weekly archives")
+		return
+	}
+
+	type key struct {
+		UserID uint
+		Mode   types.GameMode
+		Map    types.GameMap
+	}
+	combined := map[key]*models.PlayerStats{}
+	var archive []*models.PlayerStats
+	for _, stats := range weekly {
+		k := key{stats.UserID, stats.Mode, stats.Map}
+		entry, found := combined[k]
+		if !found {
+			entry = &models.PlayerStats{
+				UserID: stats.UserID,
+				Mode:   stats.Mode,
+				Map:    stats.Map,
+				Period: types.PeriodArchive,
+			}
+			combined[k] = entry
+			archive = append(archive, entry)
+		}
+		entry.AddStats(stats.ToHostReportedStats())
+	}
+
+	rows := make([]models.PlayerStats, len(archive))
+	for i, entry := range archive {
+		rows[i] = *entry
+	}
+	RankByPoints(rows)
+
+	if err := saveSeason(db, &season, rows); err != nil {
+		l.WithError(err).WithField("kind", kind.String()).Error("failed to archive season")
+	}
+}
+
+// RankByPoints sets the Rank of each entry based on the user's total points in that mode, matching how the
+// rankings cron ranks the live stats. Ties share a rank.
+func RankByPoints(rows []models.PlayerStats) {
+	type userMode struct {
+		UserID uint
+		Mode   types.GameMode
+	}
+	totals := map[userMode]int32{}
+	for _, row := range rows {
+		totals[userMode{row.UserID, row.Mode}] += row.Points
+	}
+
+	byMode := map[types.GameMode][]userMode{}
+	for um := range totals {
+		byMode[um.Mode] = append(byMode[um.Mode], um)
+	}
+
+	ranks := map[userMode]uint32{}
+	for _, users := range byMode {
+		sort.Slice(users, func(i, j int) bool {
+			if totals[users[i]] == totals[users[j]] {
+				return users[i].UserID < users[j].UserID
+			}
+			return totals[users[i]] > totals[users[j]]
+		})
+		for i, um := range users {
+			if i > 0 && totals[um] == totals[users[i-1]] {
+				ranks[um] = ranks[users[i-1]]
+			} else {
+				ranks[um] = uint32(i + 1)
+			}
+		}
+	}
+
+	for i := range rows {
+		rows[i].Rank = ranks[userMode{rows[i].UserID, rows[i].Mode}]
+	}
+}
+
+func previousSeasonEnd(db *gorm.DB, kind models.SeasonKind, fallback time.Time) time.Time {
+	var previous models.Season
+	if err := db.Where("kind = ?", kind).Order("ended_at desc").Limit(1).Find(&previous).Error; err != nil || previous.ID == 0 {
+		return fallback
+	}
+	return previous.EndedAt
+}
+
+func saveSeason(db *gorm.DB, season *models.Season, archive []models.PlayerStats) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(season).Error; err != nil {
+			return err
+		}
+		if len(archive) == 0 {
+			return nil
+		}
+		for i := range archive {
+			archive[i].SeasonID = season.ID
+		}
+		return tx.CreateInBatches(archive, 100).Error
+	})
+}
@@ -0,0 +1,69 @@
+package crons
+
+import (
+	"gorm.io/gorm"
+	"testing"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+	"tx55/pkg/migrations"
+)
+
+func TestRankByPoints(t *testing.T) {
+	rows := []models.PlayerStats{
+		{UserID: 1, Mode: types.ModeCapture, Map: types.MapGhostFactory, Points: 5},
+		{UserID: 1, Mode: types.ModeCapture, Map: types.MapCityUnderSiege, Points: 10},
+		{UserID: 2, Mode: types.ModeCapture, Map: types.MapGhostFactory, Points: 20},
+		{UserID: 3, Mode: types.ModeCapture, Map: types.MapGhostFactory, Points: 15},
+		{UserID: 4, Mode: types.ModeCapture, Map: types.MapGhostFactory, Points: 1},
+		{UserID: 1, Mode: types.ModeDeathmatch, Map: types.MapGhostFactory, Points: 1},
+	}
+	RankByPoints(rows)
+
+	expected := []uint32{2, 2, 1, 2, 4, 1}
+	for i, row := range rows {
+		if row.Rank != expected[i] {
+			t.Errorf("Expected row %d (user %d) to be rank %d, got %d", i, row.UserID, expected[i], row.Rank)
+		}
+	}
+}
+
+func TestReportsLeaveArchiveAlone(t *testing.T) {
+	db, err := configurations.DatabaseConfig{Type: configurations.SQLite, DSN: t.TempDir() + "/game.db"}.Open(&gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = migrations.MigrateModels(migrations.GameDBMigrationType, db); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := types.GameRules{Mode: types.ModeCapture, Map: types.MapGhostFactory}
+	report := types.HostReportedStats{Kills: 3, Points: 10, PlayTime: 60}
+	if _, err = models.ApplyHostReportedStats(db, 1, rules, report); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ArchiveWeeklyStats(db); err != nil {
+		t.Fatal(err)
+	}
+	if created, err := models.ApplyHostReportedStats(db, 1, rules, report); err != nil || created {
+		t.Fatalf("Expected the existing rows to be updated, got created %v, error %v", created, err)
+	}
+
+	expected := map[types.PlayerStatsPeriod]int32{
+		types.PeriodWeekly:  20,
+		types.PeriodAllTime: 20,
+		types.PeriodArchive: 10,
+	}
+	var rows []models.PlayerStats
+	if err = db.Where("user_id = ?", 1).Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("Expected %d stats rows, got %d", len(expected), len(rows))
+	}
+	for _, row := range rows {
+		if row.Points != expected[row.Period] {
+			t.Errorf("Expected period %d to have %d points, got %d", row.Period, expected[row.Period], row.Points)
+		}
+	}
+}
@@ -1,9 +1,146 @@
 package events
 
-import "github.com/gorilla/websocket"
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// PingPeriod is how often idle connections are pinged, or sent an SSE comment, to keep proxies from closing them
+	PingPeriod = 30 * time.Second
+	// PongWait is how long a websocket client has to answer a ping, or send anything, before it's disconnected
+	PongWait = 2 * PingPeriod
+	// maxClientMessage limits the size of a ClientMessage
+	maxClientMessage = 4096
+)
+
+// sink writes to the client's connection, only the client's writer goroutine uses it
+type sink interface {
+	// write sends an event, or a reply when the record's envelope has no id
+	write(r *record, deadline time.Time) error
+	ping(deadline time.Time) error
+}
 
 type Client struct {
-	id      string
-	conn    *websocket.Conn
-	service *Service
+	id          string
+	service     *Service
+	transport   string
+	remoteAddr  string
+	connectedAt time.Time
+	// replay is queued when the client is added
+	replay Replay
+	// live clients get the live games updates instead of events
+	live bool
+
+	// mu guards the filter, the service's lock must be taken first when both are needed
+	mu     sync.Mutex
+	filter Filter
+
+	// queue holds the records waiting to be written, a replay is queued as a single batch
+	queue     chan []*record
+	done      chan struct{}
+	closeOnce sync.Once
+	sent      atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+func (s *Service) newClient(id string, transport string, remoteAddr string, filter Filter, replay Replay) *Client {
+	return &Client{
+		id:          id,
+		service:     s,
+		transport:   transport,
+		remoteAddr:  remoteAddr,
+		connectedAt: time.Now(),
+		replay:      replay,
+		filter:      filter,
+		queue:       make(chan []*record, s.queueSize),
+		done:        make(chan struct{}),
+	}
+}
+
+// send queues an event if it matches the client's filter, the caller must hold c.mu
+func (c *Client) send(r *record) {
+	if c.filter.Matches(&r.envelope) {
+		c.enqueue([]*record{r})
+	}
+}
+
+// reply queues a non-event message
+func (c *Client) reply(msg ServerMessage) {
+	if r := replyRecord(msg); r != nil {
+		c.enqueue([]*record{r})
+	}
+}
+
+func replyRecord(msg ServerMessage) *record {
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	return &record{message: bs}
+}
+
+// enqueue never blocks, when the queue is full the service's slow consumer policy decides what happens
+func (c *Client) enqueue(batch []*record) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	select {
+	case c.queue <- batch:
+		return
+	default:
+	}
+
+	l := c.service.Log.WithField("client_id", c.id).WithField("remote_addr", c.remoteAddr)
+	if c.service.dropSlow {
+		if c.dropped.Add(uint64(len(batch))) == uint64(len(batch)) {
+			l.Warn("Client queue is full, dropping events")
+		}
+		c.service.dropped.Add(uint64(len(batch)))
+		return
+	}
+	l.Warn("Client queue is full, disconnecting slow client")
+	c.service.disconnected.Add(1)
+	c.close()
+}
+
+// close stops the writer, the connection handler then closes the connection and removes the client
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// writePump writes the queued records until the client is closed or a write fails, it pings the client whenever it's
+// been idle for PingPeriod
+func (c *Client) writePump(out sink) {
+	defer c.close()
+	ticker := time.NewTicker(PingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case batch := <-c.queue:
+			for _, r := range batch {
+				if err := out.write(r, time.Now().Add(c.service.writeTimeout)); err != nil {
+					c.service.Log.WithError(err).WithField("client_id", c.id).Info("Failed to write to client")
+					return
+				}
+				c.sent.Add(1)
+			}
+			ticker.Reset(PingPeriod)
+		case <-ticker.C:
+			if err := out.ping(time.Now().Add(c.service.writeTimeout)); err != nil {
+				c.service.Log.WithError(err).WithField("client_id", c.id).Info("Failed to ping client")
+				return
+			}
+		}
+	}
 }
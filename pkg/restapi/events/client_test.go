@@ -0,0 +1,36 @@
+package events
+
+import (
+	"github.com/sirupsen/logrus"
+	"testing"
+	"tx55/pkg/configurations"
+	schema "tx55/pkg/events"
+)
+
+func TestSlowConsumer(t *testing.T) {
+	for _, policy := range []configurations.SlowConsumerPolicy{configurations.SlowConsumerDrop, configurations.SlowConsumerDisconnect} {
+		s, _ := NewService(logrus.New(), configurations.RestAPIEvents{QueueSize: 2, SlowConsumer: policy}, nil)
+		client := s.newClient("slow", "test", "", Filter{}, Replay{})
+		s.clients[client.id] = client
+		for i := 0; i < 5; i++ {
+			s.Publish(schema.Envelope{Event: schema.TypeLogin})
+		}
+
+		stats := s.Stats()
+		if stats.MaxQueueDepth != 2 || stats.Published != 5 {
+			t.Errorf("%s: stats %+v, want a full queue and 5 published", policy, stats)
+		}
+		closed := false
+		select {
+		case <-client.done:
+			closed = true
+		default:
+		}
+		if policy == configurations.SlowConsumerDrop && (closed || stats.Dropped != 3 || client.dropped.Load() != 3) {
+			t.Errorf("%s: closed %v, dropped %d, want the client open with 3 dropped", policy, closed, stats.Dropped)
+		}
+		if policy == configurations.SlowConsumerDisconnect && (!closed || stats.Disconnected != 1 || stats.Dropped != 0) {
+			t.Errorf("%s: closed %v, disconnected %d, want the client closed", policy, closed, stats.Disconnected)
+		}
+	}
+}
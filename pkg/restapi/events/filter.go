@@ -0,0 +1,144 @@
+package events
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+	schema "tx55/pkg/events"
+)
+
+// Filter limits the events a client receives, empty lists match everything
+type Filter struct {
+	Types   []schema.Type `json:"types"`
+	Lobbies []uint        `json:"lobbies"`
+	GameIDs []uint        `json:"game_ids"`
+	UserIDs []uint        `json:"user_ids"`
+}
+
+func (f *Filter) Matches(e *schema.Envelope) bool {
+	if len(f.Types) > 0 && !contains(f.Types, e.Event) {
+		return false
+	}
+	if len(f.Lobbies) > 0 && !contains(f.Lobbies, e.Lobby) {
+		return false
+	}
+	if len(f.GameIDs) > 0 && !contains(f.GameIDs, e.GameID) {
+		return false
+	}
+	if len(f.UserIDs) > 0 && !contains(f.UserIDs, e.UserID) {
+		return false
+	}
+	return true
+}
+
+// Validate rejects event types that don't exist, they'd silently match nothing
+func (f *Filter) Validate() error {
+	known := schema.Types()
+	for _, t := range f.Types {
+		if !contains(known, t) {
+			return errors.New("unknown event type " + string(t))
+		}
+	}
+	return nil
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Replay asks for recent events before the live ones. Since takes priority over Last, zero values don't replay
+// anything.
+type Replay struct {
+	// Last is the number of most recent events matching the filter
+	Last int `json:"last"`
+	// Since replays every event after the event with this id
+	Since uint `json:"since"`
+}
+
+// ClientMessage is what websocket clients send to change their subscription
+type ClientMessage struct {
+	// Action is "subscribe" to replace the filter, optionally with a replay, or "replay" to replay with the current
+	// filter
+	Action string `json:"action" enums:"subscribe,replay"`
+	Filter
+	Replay
+}
+
+// ServerMessage acknowledges a ClientMessage, it's told apart from events by not having an "event" field
+type ServerMessage struct {
+	Ack    string  `json:"ack,omitempty"`
+	Filter *Filter `json:"filter,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// queryList splits repeated and comma separated query values
+func queryList(c *gin.Context, key string) []string {
+	var out []string
+	for _, value := range c.QueryArray(key) {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+func queryUints(c *gin.Context, key string) ([]uint, error) {
+	var out []uint
+	for _, value := range queryList(c, key) {
+		v, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return nil, errors.New("invalid " + key)
+		}
+		out = append(out, uint(v))
+	}
+	return out, nil
+}
+
+// ParseFilter reads a filter from the type, lobby, game_id and user_id query parameters
+func ParseFilter(c *gin.Context) (filter Filter, err error) {
+	for _, t := range queryList(c, "type") {
+		filter.Types = append(filter.Types, schema.Type(t))
+	}
+	if filter.Lobbies, err = queryUints(c, "lobby"); err != nil {
+		return
+	}
+	if filter.GameIDs, err = queryUints(c, "game_id"); err != nil {
+		return
+	}
+	if filter.UserIDs, err = queryUints(c, "user_id"); err != nil {
+		return
+	}
+	err = filter.Validate()
+	return
+}
+
+// ParseQuery reads a filter and replay from the type, lobby, game_id, user_id, last and since query parameters
+func ParseQuery(c *gin.Context) (filter Filter, replay Replay, err error) {
+	if filter, err = ParseFilter(c); err != nil {
+		return
+	}
+
+	if v := c.Query("last"); v != "" {
+		if replay.Last, err = strconv.Atoi(v); err != nil || replay.Last < 0 {
+			err = errors.New("invalid last")
+			return
+		}
+	}
+	if v := c.Query("since"); v != "" {
+		var since uint64
+		if since, err = strconv.ParseUint(v, 10, 0); err != nil {
+			err = errors.New("invalid since")
+			return
+		}
+		replay.Since = uint(since)
+	}
+	return
+}
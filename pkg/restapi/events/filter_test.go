@@ -0,0 +1,73 @@
+package events
+
+import (
+	"github.com/sirupsen/logrus"
+	"testing"
+	"tx55/pkg/configurations"
+	schema "tx55/pkg/events"
+)
+
+func TestFilterMatches(t *testing.T) {
+	e := &schema.Envelope{Event: schema.TypeGamePlayerJoined, Lobby: 2, GameID: 10, UserID: 5}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"type", Filter{Types: []schema.Type{schema.TypeGameCreated, schema.TypeGamePlayerJoined}}, true},
+		{"other type", Filter{Types: []schema.Type{schema.TypeGameCreated}}, false},
+		{"lobby", Filter{Lobbies: []uint{2}}, true},
+		{"other lobby", Filter{Lobbies: []uint{3}}, false},
+		{"game and user", Filter{GameIDs: []uint{10}, UserIDs: []uint{5}}, true},
+		{"other user", Filter{GameIDs: []uint{10}, UserIDs: []uint{6}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(e); got != tt.want {
+			t.Errorf("%s: Matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if err := (&Filter{Types: []schema.Type{"nope"}}).Validate(); err == nil {
+		t.Error("Validate() accepted an unknown type")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s, _ := NewService(logrus.New(), configurations.RestAPIEvents{ReplaySize: 5}, nil)
+	for i := uint(1); i <= 8; i++ {
+		s.Publish(schema.Envelope{Event: schema.TypeLogin, Lobby: i % 2})
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		replay Replay
+		want   []uint
+	}{
+		{"none", Filter{}, Replay{}, nil},
+		{"last", Filter{}, Replay{Last: 2}, []uint{7, 8}},
+		{"last filtered", Filter{Lobbies: []uint{0}}, Replay{Last: 2}, []uint{6, 8}},
+		{"last more than kept", Filter{}, Replay{Last: 10}, []uint{4, 5, 6, 7, 8}},
+		{"since", Filter{}, Replay{Since: 6}, []uint{7, 8}},
+		{"since filtered", Filter{Lobbies: []uint{1}}, Replay{Since: 4}, []uint{5, 7}},
+		{"since older than kept", Filter{}, Replay{Since: 1}, []uint{4, 5, 6, 7, 8}},
+		{"since latest", Filter{}, Replay{Since: 8}, nil},
+	}
+	for _, tt := range tests {
+		var got []uint
+		for _, r := range s.replayRecords(&Client{filter: tt.filter}, tt.replay) {
+			got = append(got, r.envelope.ID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: replayed %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: replayed %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -1,19 +1,44 @@
 package events
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
+	schema "tx55/pkg/events"
 )
 
-// AcceptGinWebsocket is the gin compatible request handler that upgrades to a websocket connection
+// AcceptGinWebsocket is the gin compatible request handler that upgrades to a websocket connection. The initial filter
+// and replay are read from the same query parameters as AcceptGinSSE, and can be changed by sending a ClientMessage.
 func (s *Service) AcceptGinWebsocket(c *gin.Context) {
-	s.HandleWebSocketConnection(c.Writer, c.Request)
+	filter, replay, err := ParseQuery(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	s.HandleWebSocketConnection(c.Writer, c.Request, filter, replay)
 }
 
 // HandleWebSocketConnection is a more generic request handler that upgrades to a websocket connection
-func (s *Service) HandleWebSocketConnection(w http.ResponseWriter, r *http.Request) {
+func (s *Service) HandleWebSocketConnection(w http.ResponseWriter, r *http.Request, filter Filter, replay Replay) {
+	s.serveWebsocket(w, r, s.newClient(uuid.New().String(), "websocket", r.RemoteAddr, filter, replay))
+}
+
+// AcceptGinLiveWebsocket streams the live games, every game when the client connects then each change as a
+// LiveUpdateJSON
+func (s *Service) AcceptGinLiveWebsocket(c *gin.Context) {
+	client := s.newClient(uuid.New().String(), "live", c.Request.RemoteAddr, Filter{}, Replay{})
+	client.live = true
+	s.serveWebsocket(c.Writer, c.Request, client)
+}
+
+func (s *Service) serveWebsocket(w http.ResponseWriter, r *http.Request, client *Client) {
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		s.Log.WithError(err).Error("Upgrade error")
@@ -21,28 +46,140 @@ func (s *Service) HandleWebSocketConnection(w http.ResponseWriter, r *http.Reque
 	}
 	defer func() { _ = conn.Close() }()
 
-	clientID := uuid.New().String()
-	client := &Client{
-		id:      clientID,
-		conn:    conn,
-		service: s,
-	}
-
 	s.addCh <- client
 	defer func() {
+		client.close()
 		s.removeCh <- client
 	}()
 
+	// The writer closes the connection when it stops, so a slow or broken client also ends the read loop
+	go func() {
+		client.writePump(&websocketSink{conn})
+		_ = conn.Close()
+	}()
+
+	conn.SetReadLimit(maxClientMessage)
+	_ = conn.SetReadDeadline(time.Now().Add(PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(PongWait))
+	})
 	for {
 		_, msg, err := conn.ReadMessage()
 		if err != nil {
-			s.Log.WithError(err).Error("ReadMessage error")
+			s.Log.WithError(err).Debug("ReadMessage error")
 			break
 		}
-		s.Log.Info(string(msg))
+		_ = conn.SetReadDeadline(time.Now().Add(PongWait))
+		if !client.live {
+			s.handleClientMessage(client, msg)
+		}
+	}
+}
+
+type websocketSink struct {
+	conn *websocket.Conn
+}
+
+func (w *websocketSink) write(r *record, deadline time.Time) error {
+	if err := w.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	return w.conn.WriteMessage(websocket.TextMessage, r.message)
+}
+
+func (w *websocketSink) ping(deadline time.Time) error {
+	return w.conn.WriteControl(websocket.PingMessage, nil, deadline)
+}
+
+func (s *Service) handleClientMessage(client *Client, msg []byte) {
+	var m ClientMessage
+	err := json.Unmarshal(msg, &m)
+	if err == nil {
+		err = m.Filter.Validate()
+	}
+	if err == nil && m.Last < 0 {
+		err = errors.New("invalid last")
+	}
+	if err != nil {
+		client.reply(ServerMessage{Error: err.Error()})
+		return
+	}
+
+	switch m.Action {
+	case "subscribe":
+		s.subscribe(client, m.Filter, m.Replay)
+	case "replay":
+		s.replay(client, m.Replay)
+	default:
+		client.reply(ServerMessage{Error: "unknown action"})
 	}
 }
 
+// AcceptGinSSE streams the events as Server-Sent Events, each with the event's stream id so a reconnecting
+// EventSource resumes where it left off through the Last-Event-ID header. The filter can't be changed after
+// connecting.
+func (s *Service) AcceptGinSSE(c *gin.Context) {
+	filter, replay, err := ParseQuery(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if lastID := c.GetHeader("Last-Event-ID"); lastID != "" && replay.Since == 0 {
+		if since, err := strconv.ParseUint(lastID, 10, 0); err == nil {
+			replay = Replay{Since: uint(since)}
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+	c.Writer.Flush()
+
+	client := s.newClient(uuid.New().String(), "sse", c.Request.RemoteAddr, filter, replay)
+	s.addCh <- client
+	defer func() {
+		s.removeCh <- client
+	}()
+
+	// The client is closed when the request is cancelled so the writer doesn't wait for the next ping to notice
+	go func() {
+		select {
+		case <-c.Request.Context().Done():
+			client.close()
+		case <-client.done:
+		}
+	}()
+	client.writePump(&sseSink{w: c.Writer, rc: http.NewResponseController(c.Writer)})
+}
+
+type sseSink struct {
+	w  gin.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *sseSink) write(r *record, deadline time.Time) error {
+	// Replies only make sense on a websocket, an SSE client can't send anything to reply to
+	if r.envelope.ID == 0 {
+		return nil
+	}
+	return s.send(fmt.Sprintf("id: %d\ndata: %s\n\n", r.envelope.ID, r.message), deadline)
+}
+
+func (s *sseSink) ping(deadline time.Time) error {
+	return s.send(": ping\n\n", deadline)
+}
+
+func (s *sseSink) send(frame string, deadline time.Time) error {
+	if err := s.rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := io.WriteString(s.w, frame); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
 // PostNewEvent is the endpoint the game server should point to when it wants to broadcast an event
 func (s *Service) PostNewEvent(c *gin.Context) {
 	token := c.Param("token")
@@ -51,12 +188,46 @@ func (s *Service) PostNewEvent(c *gin.Context) {
 		return
 	}
 
-	bs, err := io.ReadAll(c.Request.Body)
-	if err != nil {
+	var envelope schema.Envelope
+	if err := c.ShouldBindJSON(&envelope); err != nil {
 		s.Log.WithError(err).Error("failed to read body")
 		c.JSON(400, "body error")
 		return
 	}
-	s.broadcast(bs)
+	event, err := envelope.Decode()
+	if err != nil {
+		s.Log.WithError(err).WithField("event", envelope.Event).Warn("rejected invalid event")
+		c.JSON(400, err.Error())
+		return
+	}
+	// The ids the filters, history and live games go by always match the event's data
+	envelope.GameID = schema.GameIDOf(event)
+	envelope.UserID = schema.UserIDOf(event)
+	if err = s.Publish(envelope); err != nil {
+		s.Log.WithError(err).WithField("event", envelope.Event).Error("failed to publish event")
+		c.JSON(500, "failed to publish event")
+		return
+	}
 	c.JSON(200, "ok")
 }
+
+// Schema responds with the JSON schema of the events sent to the websocket clients
+func Schema(c *gin.Context) {
+	c.JSON(200, schema.Schema())
+}
+
+// Publish broadcasts an event the restapi itself created. It does nothing when the events service is disabled.
+func Publish(c *gin.Context, event schema.Event) {
+	s, _ := c.MustGet("events").(*Service)
+	if s == nil {
+		return
+	}
+	envelope, err := schema.NewEnvelope(0, event)
+	if err != nil {
+		s.Log.WithError(err).WithField("event", event.EventType()).Error("failed to encode event")
+		return
+	}
+	if err = s.Publish(envelope); err != nil {
+		s.Log.WithError(err).WithField("event", event.EventType()).Error("failed to publish event")
+	}
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"time"
+	schema "tx55/pkg/events"
+	"tx55/pkg/metalgearonline1/models"
+)
+
+const (
+	DefaultHistoryRetentionDays = 30
+	DefaultHistoryLimit         = 50
+	MaxHistoryLimit             = 500
+)
+
+func ToEnvelope(row models.StreamEvent) schema.Envelope {
+	return schema.Envelope{
+		ID:        row.ID,
+		Version:   row.Version,
+		Event:     schema.Type(row.Type),
+		Lobby:     row.Lobby,
+		GameID:    row.GameID,
+		UserID:    row.UserID,
+		CreatedAt: row.CreatedAt,
+		Data:      row.Data,
+	}
+}
+
+// Apply narrows a query on the stream events to the ones the filter matches
+func (f *Filter) Apply(q *gorm.DB) *gorm.DB {
+	if len(f.Types) > 0 {
+		q = q.Where("type IN ?", f.Types)
+	}
+	if len(f.Lobbies) > 0 {
+		q = q.Where("lobby IN ?", f.Lobbies)
+	}
+	if len(f.GameIDs) > 0 {
+		q = q.Where("game_id IN ?", f.GameIDs)
+	}
+	if len(f.UserIDs) > 0 {
+		q = q.Where("user_id IN ?", f.UserIDs)
+	}
+	return q
+}
+
+// loadHistory fills the replay buffer with the newest stored events so stream ids and replays carry on after a restart
+func (s *Service) loadHistory() error {
+	var rows []models.StreamEvent
+	if err := s.DB.Order("id desc").Limit(s.replaySize).Find(&rows).Error; err != nil {
+		return err
+	}
+	for i := len(rows) - 1; i >= 0; i-- {
+		envelope := ToEnvelope(rows[i])
+		bs, err := json.Marshal(envelope)
+		if err != nil {
+			return err
+		}
+		s.history = append(s.history, &record{envelope: envelope, message: bs})
+	}
+	if len(rows) > 0 {
+		s.lastID = rows[0].ID
+	}
+	return nil
+}
+
+// store saves the event and gives it its stream id. A redelivered gameserver event returns duplicate instead of being
+// stored again. Without a database the ids only count up from the last loaded event. The caller must hold s.publishMu.
+func (s *Service) store(envelope *schema.Envelope) (duplicate bool, err error) {
+	if envelope.CreatedAt.IsZero() {
+		envelope.CreatedAt = time.Now()
+	}
+	if s.DB == nil {
+		envelope.ID = s.lastID + 1
+		return false, nil
+	}
+
+	if envelope.ID != 0 {
+		var count int64
+		err = s.DB.Model(&models.StreamEvent{}).Where("source_id = ? AND lobby = ?", envelope.ID, envelope.Lobby).
+			Count(&count).Error
+		if err != nil || count > 0 {
+			return count > 0, err
+		}
+	}
+	row := models.StreamEvent{
+		CreatedAt: envelope.CreatedAt,
+		SourceID:  envelope.ID,
+		Lobby:     envelope.Lobby,
+		GameID:    envelope.GameID,
+		UserID:    envelope.UserID,
+		Type:      string(envelope.Event),
+		Version:   envelope.Version,
+		Data:      envelope.Data,
+	}
+	if err = s.DB.Create(&row).Error; err != nil {
+		return false, err
+	}
+	envelope.ID = row.ID
+	return false, nil
+}
@@ -0,0 +1,433 @@
+package events
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	schema "tx55/pkg/events"
+	"tx55/pkg/metalgearonline1/models"
+)
+
+type LiveRoundJSON struct {
+	Round     int        `json:"round"`
+	Map       string     `json:"map"`
+	Mode      string     `json:"mode"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+}
+
+type LivePlayerJSON struct {
+	UserID      uint      `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	Team        string    `json:"team"`
+	JoinedAt    time.Time `json:"joined_at"`
+	TeamSince   time.Time `json:"team_since"`
+	// TeamSeconds is how long the player has been on their current team
+	TeamSeconds int64 `json:"team_seconds"`
+	Kills       int32 `json:"kills"`
+	Deaths      int32 `json:"deaths"`
+	Points      int32 `json:"points"`
+}
+
+type LiveGameJSON struct {
+	ID          uint      `json:"id"`
+	Lobby       uint      `json:"lobby"`
+	Name        string    `json:"name"`
+	HostID      uint      `json:"host_id"`
+	Host        string    `json:"host"`
+	HasPassword bool      `json:"has_password"`
+	CreatedAt   time.Time `json:"created_at"`
+	Round       int       `json:"round"`
+	Map         string    `json:"map"`
+	Mode        string    `json:"mode"`
+	// RoundElapsedSeconds is how long the current round has been going when the game was sent
+	RoundElapsedSeconds int64 `json:"round_elapsed_seconds"`
+	// Timeline has every round played so far, the current round last without an ended_at
+	Timeline []LiveRoundJSON `json:"timeline"`
+	// Teams are the rosters keyed by "red", "blue", "spectator" or "unknown" for the modes without teams
+	Teams map[string][]LivePlayerJSON `json:"teams"`
+	// Rules are the rounds the host set up
+	Rules []schema.Round `json:"rules"`
+}
+
+// LiveUpdateJSON is what the live games websocket sends: every game when it connects, then a game whenever it changes
+// or the id of a game that closed
+type LiveUpdateJSON struct {
+	Games   []LiveGameJSON `json:"games,omitempty"`
+	Game    *LiveGameJSON  `json:"game,omitempty"`
+	Removed uint           `json:"removed,omitempty"`
+}
+
+type liveGame struct {
+	LiveGameJSON
+	players map[uint]*LivePlayerJSON
+}
+
+// Projection is the state of the running games, kept up to date from the events the service publishes
+type Projection struct {
+	mu    sync.RWMutex
+	db    *gorm.DB
+	games map[uint]*liveGame
+	// names caches display names from login events and lookups so joins don't always need the database
+	names map[uint]string
+}
+
+func NewProjection(db *gorm.DB) *Projection {
+	return &Projection{
+		db:    db,
+		games: map[uint]*liveGame{},
+		names: map[uint]string{},
+	}
+}
+
+// Rebuild loads the open games and their players from the database, then goes through the stored events of those
+// games to restore their round timelines and when players changed teams. The rosters themselves come from the
+// database, as older events may have been cleared.
+func (p *Projection) Rebuild() error {
+	var games []models.Game
+	err := p.db.Joins("GameOptions").Joins("User").Preload("Players").Preload("Players.User").Find(&games).Error
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.games = map[uint]*liveGame{}
+	ids := make([]uint, 0, len(games))
+	for _, game := range games {
+		p.games[game.ID] = seedGame(game)
+		ids = append(ids, game.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rows []models.StreamEvent
+	err = p.db.Where("game_id IN ? AND type IN ?", ids, []schema.Type{
+		schema.TypeGameCreated, schema.TypeGameNewRound, schema.TypeTeamChange,
+	}).Order("id").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		envelope := ToEnvelope(row)
+		event, err := envelope.Decode()
+		if err != nil {
+			continue
+		}
+		game := p.games[row.GameID]
+		switch e := event.(type) {
+		case *schema.GameCreated:
+			game.Timeline = nil
+			if len(game.Rules) > 0 {
+				game.startRound(0, game.Rules[0].Map, game.Rules[0].Mode, row.CreatedAt)
+			}
+		case *schema.GameNewRound:
+			game.startRound(e.Round, e.Map, e.Mode, row.CreatedAt)
+		case *schema.TeamChange:
+			player := game.players[e.UserID]
+			if player != nil && player.Team == teamKey(e.Team) && !row.CreatedAt.Before(player.JoinedAt) {
+				player.TeamSince = row.CreatedAt
+			}
+		}
+	}
+	return nil
+}
+
+func seedGame(game models.Game) *liveGame {
+	g := &liveGame{
+		LiveGameJSON: LiveGameJSON{
+			ID:          game.ID,
+			Lobby:       game.LobbyID,
+			Name:        string(game.GameOptions.Name),
+			HostID:      game.UserID,
+			Host:        string(game.User.DisplayName),
+			HasPassword: game.GameOptions.HasPassword,
+			CreatedAt:   game.CreatedAt,
+		},
+		players: map[uint]*LivePlayerJSON{},
+	}
+	for _, r := range game.GameOptions.Rules {
+		if r.Map == 0 {
+			break
+		}
+		g.Rules = append(g.Rules, schema.Round{Map: string(r.Map.String()), Mode: string(r.Mode.String())})
+	}
+	// Without the game's events the best guess for when the round started is the last update to the game
+	started := game.CreatedAt
+	if game.CurrentRound > 0 {
+		started = game.UpdatedAt
+	}
+	if int(game.CurrentRound) < len(g.Rules) {
+		rule := g.Rules[game.CurrentRound]
+		g.startRound(int(game.CurrentRound), rule.Map, rule.Mode, started)
+	}
+
+	for _, player := range game.Players {
+		g.players[player.UserID] = &LivePlayerJSON{
+			UserID:      player.UserID,
+			DisplayName: string(player.User.DisplayName),
+			Team:        teamKey(player.Team.ColorString()),
+			JoinedAt:    player.CreatedAt,
+			TeamSince:   player.CreatedAt,
+			Kills:       int32(player.Kills),
+			Deaths:      int32(player.Deaths),
+			Points:      int32(player.Score),
+		}
+	}
+	return g
+}
+
+func teamKey(team string) string {
+	if team == "" {
+		return "unknown"
+	}
+	return strings.ToLower(team)
+}
+
+// startRound ends the current round of the timeline and starts the next one
+func (g *liveGame) startRound(round int, gameMap string, mode string, at time.Time) {
+	if n := len(g.Timeline); n > 0 && g.Timeline[n-1].EndedAt == nil {
+		ended := at
+		g.Timeline[n-1].EndedAt = &ended
+	}
+	g.Timeline = append(g.Timeline, LiveRoundJSON{Round: round, Map: gameMap, Mode: mode, StartedAt: at})
+	g.Round = round
+	g.Map = gameMap
+	g.Mode = mode
+}
+
+// name returns the display name of a player from the cache, see Resolve. The caller must hold p.mu.
+func (p *Projection) name(userID uint) string {
+	return p.names[userID]
+}
+
+// Resolve looks up the display name of a player the event adds to a game when it hasn't been seen in an event. It's
+// called before Apply, outside of the service's lock, so a slow lookup doesn't hold up the other clients.
+func (p *Projection) Resolve(envelope schema.Envelope) {
+	if p.db == nil {
+		return
+	}
+	event, err := envelope.Decode()
+	if err != nil {
+		return
+	}
+	var userID uint
+	switch e := event.(type) {
+	case *schema.GameCreated:
+		if e.Host != "" {
+			return
+		}
+		userID = e.UserID
+	case *schema.GamePlayerJoined:
+		userID = e.UserID
+	default:
+		return
+	}
+
+	p.mu.RLock()
+	_, found := p.names[userID]
+	p.mu.RUnlock()
+	if found {
+		return
+	}
+
+	var user models.User
+	if err := p.db.Select("id", "display_name").Limit(1).Find(&user, userID).Error; err != nil || user.ID == 0 {
+		return
+	}
+	p.mu.Lock()
+	p.names[userID] = string(user.DisplayName)
+	p.mu.Unlock()
+}
+
+// Apply updates the projection with an event. changed is false when the event didn't affect a game, otherwise gameID
+// is the game that changed and removed is set when it closed.
+func (p *Projection) Apply(envelope schema.Envelope) (gameID uint, removed bool, changed bool) {
+	event, err := envelope.Decode()
+	if err != nil {
+		return 0, false, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch e := event.(type) {
+	case *schema.Login:
+		p.names[e.UserID] = e.DisplayName
+		return 0, false, false
+	case *schema.LobbyJoin:
+		p.names[e.UserID] = e.DisplayName
+		return 0, false, false
+	case *schema.GameCreated:
+		game := &liveGame{
+			LiveGameJSON: LiveGameJSON{
+				ID:          e.GameID,
+				Lobby:       envelope.Lobby,
+				Name:        e.Name,
+				HostID:      e.UserID,
+				Host:        e.Host,
+				HasPassword: e.HasPassword,
+				CreatedAt:   envelope.CreatedAt,
+				Rules:       e.Rules,
+			},
+			players: map[uint]*LivePlayerJSON{},
+		}
+		if len(e.Rules) > 0 {
+			game.startRound(0, e.Rules[0].Map, e.Rules[0].Mode, envelope.CreatedAt)
+		}
+		// The host is in their own game from the start, older gameservers never sent a join for them
+		if e.Host != "" {
+			p.names[e.UserID] = e.Host
+		}
+		game.join(e.UserID, p.name(e.UserID), envelope.CreatedAt)
+		p.games[e.GameID] = game
+		return e.GameID, false, true
+	case *schema.GameDeleted:
+		return p.remove(e.GameID)
+	case *schema.HostQuit:
+		return p.remove(e.GameID)
+	}
+
+	gameID = schema.GameIDOf(event)
+	game := p.games[gameID]
+	if game == nil {
+		return 0, false, false
+	}
+	switch e := event.(type) {
+	case *schema.GameNewRound:
+		game.startRound(e.Round, e.Map, e.Mode, envelope.CreatedAt)
+	case *schema.GamePlayerJoined:
+		if _, found := game.players[e.UserID]; found {
+			return 0, false, false
+		}
+		game.join(e.UserID, p.name(e.UserID), envelope.CreatedAt)
+	case *schema.GamePlayerLeft:
+		delete(game.players, e.UserID)
+	case *schema.PlayerKicked:
+		delete(game.players, e.UserID)
+	case *schema.TeamChange:
+		player := game.players[e.UserID]
+		if player == nil {
+			return 0, false, false
+		}
+		if team := teamKey(e.Team); team != player.Team {
+			player.Team = team
+			player.TeamSince = envelope.CreatedAt
+		}
+	case *schema.StatsReported:
+		player := game.players[e.UserID]
+		// Added like the game's overview stats, which count quarantined reports too
+		if player == nil {
+			return 0, false, false
+		}
+		player.Kills += e.Kills
+		player.Deaths += e.Deaths
+		player.Points += e.Points
+	default:
+		return 0, false, false
+	}
+	return gameID, false, true
+}
+
+// join adds the player to the game without a team
+func (g *liveGame) join(userID uint, name string, at time.Time) {
+	g.players[userID] = &LivePlayerJSON{
+		UserID:      userID,
+		DisplayName: name,
+		Team:        teamKey(""),
+		JoinedAt:    at,
+		TeamSince:   at,
+	}
+}
+
+func (p *Projection) remove(gameID uint) (uint, bool, bool) {
+	if _, found := p.games[gameID]; !found {
+		return 0, false, false
+	}
+	delete(p.games, gameID)
+	return gameID, true, true
+}
+
+// snapshot copies the game with the elapsed times worked out at now, the caller must hold p.mu
+func (g *liveGame) snapshot(now time.Time) LiveGameJSON {
+	out := g.LiveGameJSON
+	out.Timeline = append([]LiveRoundJSON{}, g.Timeline...)
+	out.Rules = append([]schema.Round{}, g.Rules...)
+	if n := len(g.Timeline); n > 0 {
+		out.RoundElapsedSeconds = int64(now.Sub(g.Timeline[n-1].StartedAt).Seconds())
+	}
+
+	out.Teams = map[string][]LivePlayerJSON{}
+	for _, player := range g.players {
+		p := *player
+		p.TeamSeconds = int64(now.Sub(p.TeamSince).Seconds())
+		out.Teams[p.Team] = append(out.Teams[p.Team], p)
+	}
+	for _, roster := range out.Teams {
+		sort.Slice(roster, func(i, j int) bool {
+			return roster[i].JoinedAt.Before(roster[j].JoinedAt)
+		})
+	}
+	return out
+}
+
+// Games returns every running game ordered by id
+func (p *Projection) Games() []LiveGameJSON {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	out := make([]LiveGameJSON, 0, len(p.games))
+	for _, game := range p.games {
+		out = append(out, game.snapshot(now))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Game returns a running game, found is false if it isn't running
+func (p *Projection) Game(id uint) (game LiveGameJSON, found bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if g := p.games[id]; g != nil {
+		return g.snapshot(time.Now()), true
+	}
+	return LiveGameJSON{}, false
+}
+
+// liveRecord encodes an update for the live games websocket clients
+func liveRecord(update LiveUpdateJSON) *record {
+	bs, err := json.Marshal(update)
+	if err != nil {
+		return nil
+	}
+	return &record{message: bs}
+}
+
+// sendLive queues the change to a game for the live games clients, the caller must hold s.mu
+func (s *Service) sendLive(gameID uint, removed bool) {
+	update := LiveUpdateJSON{Removed: gameID}
+	if !removed {
+		game, found := s.Live.Game(gameID)
+		if !found {
+			return
+		}
+		update = LiveUpdateJSON{Game: &game}
+	}
+	r := liveRecord(update)
+	if r == nil {
+		return
+	}
+	for _, client := range s.clients {
+		if client.live {
+			client.enqueue([]*record{r})
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package events
+
+import (
+	"gorm.io/gorm"
+	"testing"
+	"time"
+	"tx55/pkg/configurations"
+	schema "tx55/pkg/events"
+	"tx55/pkg/metalgearonline1/models"
+)
+
+func TestProjection(t *testing.T) {
+	p := NewProjection(nil)
+	start := time.Now().Add(-10 * time.Minute)
+	apply := func(minute int, e schema.Event) bool {
+		envelope, err := schema.NewEnvelope(1, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		envelope.CreatedAt = start.Add(time.Duration(minute) * time.Minute)
+		_, _, changed := p.Apply(envelope)
+		return changed
+	}
+
+	game := schema.Game{GameID: 7}
+	apply(0, schema.Login{User: schema.User{UserID: 2}, DisplayName: "bob"})
+	apply(0, schema.GameCreated{Game: game, User: schema.User{UserID: 1}, Name: "test", Host: "alice", Rules: []schema.Round{
+		{Map: "lost forest", Mode: "capture"},
+		{Map: "ghost factory", Mode: "team deathmatch"},
+	}})
+	apply(1, schema.GamePlayerJoined{Game: game, User: schema.User{UserID: 2}})
+	apply(2, schema.TeamChange{Game: game, User: schema.User{UserID: 2}, Team: "Red"})
+	apply(4, schema.GameNewRound{Game: game, Round: 1, Map: "ghost factory", Mode: "team deathmatch"})
+	apply(5, schema.StatsReported{Game: game, User: schema.User{UserID: 2}, Kills: 3, Deaths: 1, Points: 4})
+	if apply(5, schema.GamePlayerJoined{Game: schema.Game{GameID: 8}, User: schema.User{UserID: 3}}) {
+		t.Error("an event of an unknown game changed the projection")
+	}
+
+	g, found := p.Game(7)
+	if !found {
+		t.Fatal("game not found")
+	}
+	if g.Round != 1 || g.Map != "ghost factory" || len(g.Timeline) != 2 || g.Timeline[0].EndedAt == nil || g.Timeline[1].EndedAt != nil {
+		t.Errorf("unexpected rounds %+v", g)
+	}
+	if g.RoundElapsedSeconds < 359 || g.RoundElapsedSeconds > 361 {
+		t.Errorf("round elapsed %d, want 360", g.RoundElapsedSeconds)
+	}
+	red := g.Teams["red"]
+	if len(red) != 1 || red[0].DisplayName != "bob" || red[0].Kills != 3 || red[0].TeamSeconds < 479 || red[0].TeamSeconds > 481 {
+		t.Errorf("unexpected red team %+v", red)
+	}
+
+	apply(6, schema.GameDeleted{Game: game})
+	if games := p.Games(); len(games) != 0 {
+		t.Errorf("games %+v, want none after the game was deleted", games)
+	}
+}
+
+func TestProjectionHost(t *testing.T) {
+	p := NewProjection(nil)
+	apply := func(e schema.Event) {
+		envelope, err := schema.NewEnvelope(1, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Apply(envelope)
+	}
+
+	game := schema.Game{GameID: 7}
+	host := schema.User{UserID: 1}
+	apply(schema.GameCreated{Game: game, User: host, Name: "test", Host: "alice", Rules: []schema.Round{
+		{Map: "lost forest", Mode: "capture"},
+	}})
+	apply(schema.TeamChange{Game: game, User: host, Team: "Blue"})
+	// A gameserver that sends the host's join too shouldn't move them off their team
+	apply(schema.GamePlayerJoined{Game: game, User: host})
+	apply(schema.StatsReported{Game: game, User: host, Kills: 2, Points: 3})
+
+	g, found := p.Game(7)
+	if !found {
+		t.Fatal("game not found")
+	}
+	blue := g.Teams["blue"]
+	if len(blue) != 1 || blue[0].UserID != 1 || blue[0].DisplayName != "alice" || blue[0].Kills != 2 || blue[0].Points != 3 {
+		t.Errorf("unexpected blue team %+v, want the host", g.Teams)
+	}
+}
+
+func TestProjectionResolve(t *testing.T) {
+	db, err := configurations.DatabaseConfig{Type: configurations.SQLite, DSN: t.TempDir() + "/game.db"}.Open(&gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Create(&models.User{Username: []byte("bob"), DisplayName: []byte("bob"), Password: "bobpassword"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProjection(db)
+	game := schema.Game{GameID: 7}
+	created, _ := schema.NewEnvelope(1, schema.GameCreated{Game: game, User: schema.User{UserID: 5}, Name: "test", Host: "alice"})
+	joined, _ := schema.NewEnvelope(1, schema.GamePlayerJoined{Game: game, User: schema.User{UserID: 1}})
+	p.Resolve(created)
+	p.Apply(created)
+	// Apply never looks names up itself
+	p.Apply(joined)
+	if name := playerName(p, 7, 1); name != "" {
+		t.Fatalf("bob was named %q without being resolved", name)
+	}
+
+	left, _ := schema.NewEnvelope(1, schema.GamePlayerLeft{Game: game, User: schema.User{UserID: 1}})
+	p.Apply(left)
+	p.Resolve(joined)
+	p.Apply(joined)
+	if name := playerName(p, 7, 1); name != "bob" {
+		t.Errorf("bob was named %q, want the resolved name", name)
+	}
+}
+
+func playerName(p *Projection, gameID uint, userID uint) string {
+	g, _ := p.Game(gameID)
+	for _, roster := range g.Teams {
+		for _, player := range roster {
+			if player.UserID == userID {
+				return player.DisplayName
+			}
+		}
+	}
+	return ""
+}
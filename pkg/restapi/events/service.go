@@ -1,36 +1,106 @@
 package events
 
 import (
+	"encoding/json"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+	"tx55/pkg/configurations"
+	schema "tx55/pkg/events"
 )
 
+const (
+	DefaultReplaySize   = 1000
+	DefaultQueueSize    = 256
+	DefaultWriteTimeout = 10 * time.Second
+)
+
+// record is an event as it was sent to the clients
+type record struct {
+	envelope schema.Envelope
+	message  []byte
+}
+
 type Service struct {
-	clients     map[string]*Client
-	addCh       chan *Client
-	removeCh    chan *Client
-	mu          sync.Mutex
-	Log         logrus.FieldLogger
+	clients  map[string]*Client
+	addCh    chan *Client
+	removeCh chan *Client
+	// mu guards the clients, the history and the last stream id. It's held while an event is sent so every client
+	// sees the events in the same order, and replays can't miss or repeat an event.
+	mu sync.Mutex
+	// publishMu orders the publishers, it's held while an event is stored so the stream ids are assigned in the order
+	// the events are sent without a slow database holding up the clients
+	publishMu sync.Mutex
+	Log       logrus.FieldLogger
+	// DB stores the events for the history endpoint and replays after a restart, without it nothing is stored
+	DB *gorm.DB
+	// Live is the state of the running games built from the published events
+	Live        *Projection
 	upgrader    websocket.Upgrader
 	ValidTokens []string
+
+	// lastID is the stream id of the last event
+	lastID     uint
+	history    []*record
+	replaySize int
+
+	queueSize    int
+	writeTimeout time.Duration
+	// dropSlow drops events for clients with a full queue instead of disconnecting them
+	dropSlow bool
+
+	published    atomic.Uint64
+	dropped      atomic.Uint64
+	disconnected atomic.Uint64
 }
 
-func NewService(logger logrus.FieldLogger, validTokens []string) *Service {
+// NewService creates the events service and loads the newest events from db for replays, db may be nil to keep the
+// events in memory only
+func NewService(logger logrus.FieldLogger, config configurations.RestAPIEvents, db *gorm.DB) (*Service, error) {
+	replaySize := config.ReplaySize
+	if replaySize <= 0 {
+		replaySize = DefaultReplaySize
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	writeTimeout := time.Duration(config.WriteTimeoutSeconds) * time.Second
+	if writeTimeout <= 0 {
+		writeTimeout = DefaultWriteTimeout
+	}
 	s := &Service{
-		clients:     make(map[string]*Client),
-		addCh:       make(chan *Client),
-		removeCh:    make(chan *Client),
-		ValidTokens: validTokens,
-		Log:         logger,
+		clients:      make(map[string]*Client),
+		addCh:        make(chan *Client),
+		removeCh:     make(chan *Client),
+		ValidTokens:  config.AccessTokens,
+		Log:          logger,
+		DB:           db,
+		Live:         NewProjection(db),
+		replaySize:   replaySize,
+		queueSize:    queueSize,
+		writeTimeout: writeTimeout,
+		dropSlow:     config.SlowConsumer == configurations.SlowConsumerDrop,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true
 			},
 		},
 	}
-	return s
+	if db != nil {
+		if err := s.loadHistory(); err != nil {
+			return nil, err
+		}
+		if err := s.Live.Rebuild(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
 // CheckToken is a simple utility function that determines if the token is valid for this service
@@ -43,16 +113,160 @@ func (s *Service) CheckToken(token string) bool {
 	return false
 }
 
-func (s *Service) broadcast(message []byte) {
+// Publish stores the event and sends it to every connected client whose filter matches it. The envelope's id is
+// replaced with its stream id, which is what clients use to ask for a replay. An event the gameserver redelivers is
+// ignored.
+func (s *Service) Publish(envelope schema.Envelope) error {
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+
+	duplicate, err := s.store(&envelope)
+	if err != nil || duplicate {
+		return err
+	}
+	bs, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	s.Live.Resolve(envelope)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.lastID = envelope.ID
+	s.published.Add(1)
 
+	r := &record{envelope: envelope, message: bs}
+	s.history = append(s.history, r)
+	if len(s.history) > s.replaySize {
+		s.history = s.history[len(s.history)-s.replaySize:]
+	}
+	s.broadcast(r)
+	if gameID, removed, changed := s.Live.Apply(envelope); changed {
+		s.sendLive(gameID, removed)
+	}
+	return nil
+}
+
+// broadcast queues the record for every client, the caller must hold s.mu
+func (s *Service) broadcast(r *record) {
 	for _, client := range s.clients {
-		err := client.conn.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			s.Log.WithError(err).WithField("client_id", client.id).Error("broadcast error")
+		if client.live {
+			continue
+		}
+		client.mu.Lock()
+		client.send(r)
+		client.mu.Unlock()
+	}
+}
+
+// replayRecords returns the events the replay asks for that match the client's filter, the caller must hold s.mu and
+// client.mu
+func (s *Service) replayRecords(client *Client, replay Replay) []*record {
+	var records []*record
+	if replay.Since > 0 {
+		for _, r := range s.history {
+			if r.envelope.ID > replay.Since && client.filter.Matches(&r.envelope) {
+				records = append(records, r)
+			}
+		}
+	} else if replay.Last > 0 {
+		for i := len(s.history) - 1; i >= 0 && len(records) < replay.Last; i-- {
+			if client.filter.Matches(&s.history[i].envelope) {
+				records = append(records, s.history[i])
+			}
+		}
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+	}
+	return records
+}
+
+// subscribe replaces the client's filter and queues the replay before any event published after it
+func (s *Service) subscribe(client *Client, filter Filter, replay Replay) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.filter = filter
+	ack := replyRecord(ServerMessage{Ack: "subscribe", Filter: &client.filter})
+	client.enqueue(append([]*record{ack}, s.replayRecords(client, replay)...))
+}
+
+func (s *Service) replay(client *Client, replay Replay) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	ack := replyRecord(ServerMessage{Ack: "replay"})
+	client.enqueue(append([]*record{ack}, s.replayRecords(client, replay)...))
+}
+
+// ClientStats describes a connected client and its send queue
+type ClientStats struct {
+	ID          string    `json:"id"`
+	Transport   string    `json:"transport"`
+	RemoteAddr  string    `json:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+	Filter      Filter    `json:"filter"`
+	// QueueDepth is how many messages are waiting to be sent, a replay counts as one
+	QueueDepth int    `json:"queue_depth"`
+	QueueSize  int    `json:"queue_size"`
+	Sent       uint64 `json:"sent"`
+	Dropped    uint64 `json:"dropped"`
+}
+
+type Stats struct {
+	Clients       []ClientStats `json:"clients"`
+	MaxQueueDepth int           `json:"max_queue_depth"`
+	// Published, Dropped and Disconnected count from when the service started
+	Published    uint64 `json:"published"`
+	Dropped      uint64 `json:"dropped"`
+	Disconnected uint64 `json:"disconnected"`
+	LastID       uint   `json:"last_id"`
+	ReplaySize   int    `json:"replay_size"`
+	Replayable   int    `json:"replayable"`
+}
+
+// Stats reports the connected clients and their queue depths, ordered by when they connected
+func (s *Service) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := Stats{
+		Clients:      []ClientStats{},
+		Published:    s.published.Load(),
+		Dropped:      s.dropped.Load(),
+		Disconnected: s.disconnected.Load(),
+		LastID:       s.lastID,
+		ReplaySize:   s.replaySize,
+		Replayable:   len(s.history),
+	}
+	for _, client := range s.clients {
+		client.mu.Lock()
+		c := ClientStats{
+			ID:          client.id,
+			Transport:   client.transport,
+			RemoteAddr:  client.remoteAddr,
+			ConnectedAt: client.connectedAt,
+			Filter:      client.filter,
+			QueueDepth:  len(client.queue),
+			QueueSize:   cap(client.queue),
+			Sent:        client.sent.Load(),
+			Dropped:     client.dropped.Load(),
+		}
+		client.mu.Unlock()
+		if c.QueueDepth > stats.MaxQueueDepth {
+			stats.MaxQueueDepth = c.QueueDepth
 		}
+		stats.Clients = append(stats.Clients, c)
 	}
+	sort.Slice(stats.Clients, func(i, j int) bool {
+		return stats.Clients[i].ConnectedAt.Before(stats.Clients[j].ConnectedAt)
+	})
+	return stats
 }
 
 func (s *Service) Run() {
@@ -62,6 +276,17 @@ func (s *Service) Run() {
 		case client := <-s.addCh:
 			s.mu.Lock()
 			s.clients[client.id] = client
+			if client.live {
+				if r := liveRecord(LiveUpdateJSON{Games: s.Live.Games()}); r != nil {
+					client.enqueue([]*record{r})
+				}
+			} else {
+				client.mu.Lock()
+				if replay := s.replayRecords(client, client.replay); len(replay) > 0 {
+					client.enqueue(replay)
+				}
+				client.mu.Unlock()
+			}
 			s.mu.Unlock()
 			s.Log.Info("Client connected")
 		case client := <-s.removeCh:
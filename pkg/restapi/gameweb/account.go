@@ -4,7 +4,12 @@ import (
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"mime"
+	"strings"
 	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/rating"
+	"tx55/pkg/restapi/iso8859"
+	"tx55/pkg/restapi/validation"
 )
 
 type ArgsRegister struct {
@@ -26,10 +31,36 @@ func RegisterAccount(c *gin.Context) {
 	}
 
 	db := c.MustGet("db").(*gorm.DB)
+	rules := c.MustGet("validation").(*validation.Rules)
+
+	if allowed, err := rules.AllowRegistration(db, c.ClientIP()); err != nil {
+		log.WithError(err).Error("Failed to check registrations from address")
+		c.String(500, "Database error")
+		return
+	} else if !allowed {
+		log.WithField("ip", c.ClientIP()).Info("Too many registrations from address")
+		c.String(429, "Too many registrations")
+		return
+	}
+
+	var newUser models.User
+	var err error
+	if newUser.Username, err = rules.Username(decodeFormValue(c, args.Username)); err != nil {
+		registrationError(c, err)
+		return
+	}
+	if newUser.DisplayName, err = rules.DisplayName(db, 0, decodeFormValue(c, args.DisplayName)); err != nil {
+		registrationError(c, err)
+		return
+	}
+	if newUser.Password, err = validation.EncodePassword(decodeFormValue(c, args.Password)); err != nil {
+		registrationError(c, err)
+		return
+	}
 
 	// Do not allow registering the same username even if it was deleted
 	var existingUser models.User
-	if tx := db.Unscoped().Where("username LIKE ?", args.Username).First(&existingUser); tx.Error == nil {
+	if tx := db.Unscoped().Where("username_canonical = ?", models.CanonicalUsername(newUser.Username)).First(&existingUser); tx.Error == nil {
 		log.WithFields(log.Fields{
 			"id":       existingUser.ID,
 			"username": string(existingUser.Username),
@@ -38,11 +69,10 @@ func RegisterAccount(c *gin.Context) {
 		return
 	}
 
-	var newUser models.User
-	newUser.Username = []byte(args.Username)
-	newUser.Password = args.Password
-	newUser.DisplayName = []byte(args.DisplayName)
-	newUser.VsRating = 1000
+	newUser.RegistrationIP = c.ClientIP()
+	newUser.VsRating = rating.DefaultRating
+	newUser.HostVsRating = rating.DefaultRating
+	newUser.ServerVsRating = rating.DefaultRating
 
 	if tx := db.Create(&newUser); tx.Error != nil {
 		log.WithError(tx.Error).Error("Failed to save user")
@@ -59,6 +89,25 @@ func RegisterAccount(c *gin.Context) {
 	c.String(200, "0")
 }
 
+// decodeFormValue converts the form value to UTF-8 so it can be validated like the api's input. The console posts
+// ISO-8859-1 without declaring a charset, so only forms that declare UTF-8 are taken as-is.
+func decodeFormValue(c *gin.Context, value string) string {
+	if _, params, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err == nil && strings.EqualFold(params["charset"], "utf-8") {
+		return value
+	}
+	decoded, _ := iso8859.Decode(value)
+	return decoded
+}
+
+func registrationError(c *gin.Context, err error) {
+	if _, ok := err.(validation.Error); ok {
+		c.String(400, err.Error())
+		return
+	}
+	log.WithError(err).Error("Failed to check registration")
+	c.String(500, "Database error")
+}
+
 func DeleteAccount(c *gin.Context) {
 	var args struct {
 		Username string `form:"name"`
@@ -70,14 +119,8 @@ func DeleteAccount(c *gin.Context) {
 	}
 
 	db := c.MustGet("db").(*gorm.DB)
-	var user models.User
-	if tx := db.Where("username LIKE ?", args.Username).First(&user); tx.Error != nil {
-		c.String(404, "User not found")
-		return
-	}
-
-	if !user.CheckRawPassword([]byte(args.Password)) {
-		c.String(404, "User not found")
+	user, ok := checkAccount(c, db, args.Username, args.Password)
+	if !ok {
 		return
 	}
 
@@ -106,21 +149,24 @@ func ChangePassword(c *gin.Context) {
 	}
 
 	db := c.MustGet("db").(*gorm.DB)
-	var user models.User
-	if tx := db.Where("username LIKE ?", args.Username).First(&user); tx.Error != nil {
-		c.String(404, "User not found")
+	user, ok := checkAccount(c, db, args.Username, args.Password)
+	if !ok {
 		return
 	}
-	if !user.CheckRawPassword([]byte(args.Password)) {
-		c.String(404, "User not found")
+
+	newPassword, err := validation.EncodePassword(decodeFormValue(c, args.NewPass))
+	if err != nil {
+		c.String(400, err.Error())
 		return
 	}
-
-	user.Password = args.NewPass
+	user.Password = newPassword
 	if err := db.Save(&user).Error; err != nil {
 		c.String(500, "Database error")
 		return
 	}
+	if _, err := models.RevokeUserSessions(db, user.ID); err != nil {
+		log.WithError(err).WithField("id", user.ID).Error("Failed to revoke sessions after a password change")
+	}
 
 	log.WithFields(log.Fields{
 		"id":       user.ID,
@@ -129,3 +175,63 @@ func ChangePassword(c *gin.Context) {
 
 	c.String(200, "0")
 }
+
+// checkAccount finds the user for the account pages and checks their password, responding with an error when it returns
+// false. The name and password are decoded and encoded like they are when registering.
+func checkAccount(c *gin.Context, db *gorm.DB, name string, password string) (user models.User, ok bool) {
+	name = decodeFormValue(c, name)
+	if !checkLoginThrottle(c, db, name) {
+		return
+	}
+
+	username, err := validation.EncodeName("Username", name)
+	if err == nil {
+		err = db.Where("username_canonical = ?", models.CanonicalUsername(username)).First(&user).Error
+	}
+	if err != nil {
+		recordLoginResult(c, db, name, false)
+		c.String(404, "User not found")
+		return
+	}
+
+	raw, err := iso8859.EncodeAsBytes(decodeFormValue(c, password))
+	if err != nil || !user.CheckRawPassword(raw) {
+		recordLoginResult(c, db, name, false)
+		c.String(404, "User not found")
+		return
+	}
+	recordLoginResult(c, db, name, true)
+	return user, true
+}
+
+// checkLoginThrottle must be called before checking a password, the game's account pages share the login throttle
+// with the game and the api
+func checkLoginThrottle(c *gin.Context, db *gorm.DB, username string) bool {
+	check, err := models.CheckLogin(db, models.LoginScopeGame, username, c.ClientIP())
+	if err != nil {
+		log.WithError(err).Error("Failed to check login throttle")
+		c.String(500, "Database error")
+		return false
+	}
+	if !check.Allowed {
+		log.WithFields(log.Fields{
+			"username": username,
+			"locked":   check.Locked,
+		}).Info("Account change throttled")
+		c.String(429, "Too many attempts")
+		return false
+	}
+	return true
+}
+
+func recordLoginResult(c *gin.Context, db *gorm.DB, username string, success bool) {
+	var err error
+	if success {
+		err = models.RecordLoginSuccess(db, models.LoginScopeGame, username)
+	} else {
+		err = models.RecordLoginFailure(db, models.LoginScopeGame, username, c.ClientIP())
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to record login attempt")
+	}
+}
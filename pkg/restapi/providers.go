@@ -8,11 +8,12 @@ import (
 
 // RequireAPIKey just requires that the X-API-TOKEN header is set to some value.
 // The particular value does not matter as the intent is purely to determine if
-// the call is has the ability to set custom headers on a request.
+// the call is has the ability to set custom headers on a request. An
+// Authorization header proves the same thing.
 func RequireAPIKey(c *gin.Context) {
 	if c.Request.Method == "POST" {
 		apiKey := c.GetHeader("X-API-TOKEN")
-		if apiKey == "" {
+		if apiKey == "" && c.GetHeader("Authorization") == "" {
 			Error(c, 401, "unauthorized")
 			return
 		}
@@ -30,15 +31,36 @@ func GameLoginRequired(c *gin.Context) {
 		c.Next()
 	}
 }
+
+// AdminAuthenticator authenticates an admin request that has no admin session, it returns false if the request isn't
+// authenticated. Authenticators that fail the request themselves must abort it.
+type AdminAuthenticator func(c *gin.Context) bool
+
+var adminAuthenticators []AdminAuthenticator
+
+// RegisterAdminAuthenticator adds another way for requests to authenticate as an admin, they're tried in the order
+// they were registered
+func RegisterAdminAuthenticator(a AdminAuthenticator) {
+	adminAuthenticators = append(adminAuthenticators, a)
+}
+
 func AdminLoginRequired(c *gin.Context) {
 	session := sessions.Default(c)
 	user := session.Get("admin_id")
-	if user == nil {
-		Error(c, 401, "unauthorized")
-		return
-	} else {
+	if user != nil {
 		c.Next()
+		return
+	}
+	for _, authenticate := range adminAuthenticators {
+		if authenticate(c) {
+			c.Next()
+			return
+		}
+		if c.IsAborted() {
+			return
+		}
 	}
+	Error(c, 401, "unauthorized")
 }
 
 func ProvideContextVar(name string, val any) gin.HandlerFunc {
@@ -2,6 +2,7 @@ package restapi
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gin-contrib/sessions"
 	gormsessions "github.com/gin-contrib/sessions/gorm"
 	"github.com/gin-gonic/gin"
@@ -15,6 +16,7 @@ import (
 	"tx55/pkg/configurations"
 	"tx55/pkg/restapi/events"
 	"tx55/pkg/restapi/gameweb"
+	"tx55/pkg/restapi/validation"
 )
 
 type Server struct {
@@ -55,6 +57,14 @@ func Register(level AuthLevel, method, endpoint string, handler gin.HandlerFunc)
 	})
 }
 
+// middleware runs before every route of its auth level, in the order it was registered
+var middleware = map[AuthLevel][]gin.HandlerFunc{}
+
+// RegisterMiddleware adds a handler that runs before every route of the auth level
+func RegisterMiddleware(level AuthLevel, handler gin.HandlerFunc) {
+	middleware[level] = append(middleware[level], handler)
+}
+
 func NewServer(config configurations.RestAPI) (s *Server, err error) {
 	gin.SetMode(gin.ReleaseMode)
 	s = &Server{
@@ -94,25 +104,45 @@ func NewServer(config configurations.RestAPI) (s *Server, err error) {
 	s.Engine.Use(ProvideContextVar("logger", engineLogger))
 	s.Engine.Use(ProvideContextVar("db", s.DB))
 	s.Engine.Use(ProvideContextVar("adminDB", s.AdminDB))
+	s.Engine.Use(ProvideContextVar("gameservers", config.Gameservers))
+	s.Engine.Use(ProvideContextVar("validation", validation.NewRules(config.Names)))
 
 	_ = s.Engine.SetTrustedProxies(config.TrustedProxies)
 
-	unauthGroup := s.Engine.Group(config.ApiPrefix)
-
-	userGroup := s.Engine.Group(config.ApiPrefix, RequireAPIKey, GameLoginRequired)
-	adminGroup := s.Engine.Group(config.ApiPrefix, RequireAPIKey, AdminLoginRequired)
-
 	if config.Events.Enabled {
 		if len(config.Events.AccessTokens) == 0 {
 			err = errors.New("no event access tokens specified")
 			return
 		}
-		s.EventService = events.NewService(engineLogger, config.Events.AccessTokens)
+		switch config.Events.SlowConsumer {
+		case "", configurations.SlowConsumerDisconnect, configurations.SlowConsumerDrop:
+		default:
+			err = fmt.Errorf("unknown events slow consumer policy %q", config.Events.SlowConsumer)
+			return
+		}
+		if s.EventService, err = events.NewService(engineLogger, config.Events, s.DB); err != nil {
+			return
+		}
 		go s.EventService.Run()
+	}
+	// Set even when the events service is disabled, events.Publish does nothing without it
+	s.Engine.Use(ProvideContextVar("events", s.EventService))
+
+	unauthGroup := s.Engine.Group(config.ApiPrefix)
+
+	userGroup := s.Engine.Group(config.ApiPrefix, RequireAPIKey, GameLoginRequired)
+	adminGroup := s.Engine.Group(config.ApiPrefix, RequireAPIKey, AdminLoginRequired)
+
+	unauthGroup.GET("/stream/events/schema", events.Schema)
+	if s.EventService != nil {
 		unauthGroup.POST("/stream/events/:token", s.EventService.PostNewEvent)
 		unauthGroup.GET("/stream/events", s.EventService.AcceptGinWebsocket)
+		unauthGroup.GET("/stream/events/sse", s.EventService.AcceptGinSSE)
+		unauthGroup.GET("/games/live/ws", s.EventService.AcceptGinLiveWebsocket)
 	} else {
 		unauthGroup.GET("/stream/events", notImplemented)
+		unauthGroup.GET("/stream/events/sse", notImplemented)
+		unauthGroup.GET("/games/live/ws", notImplemented)
 		unauthGroup.POST("/stream/events/:token", notImplemented)
 	}
 
@@ -128,6 +158,7 @@ func NewServer(config configurations.RestAPI) (s *Server, err error) {
 		default:
 			panic("unknown auth level")
 		}
+		group.Use(middleware[level]...)
 
 		for _, route := range endpoints {
 			switch route.method {
@@ -220,6 +220,8 @@ type PlayerStatsJSON struct {
 	ModeString   types.GameModeString          `json:"mode_string"`
 	Map          types.GameMap                 `json:"map"`
 	MapString    types.GameMapString           `json:"map_string"`
+	// SeasonID is the season archived stats belong to, it is not set for the all-time and weekly stats
+	SeasonID uint `json:"season_id,omitempty"`
 
 	// Rank will be the rank in the mode for the period. Though stats are broken down by map also, the rank value will only consider mode.
 	Rank uint32 `json:"rank"`
@@ -266,6 +268,39 @@ type RankingEntryJSON struct {
 	Points      uint   `json:"points"`
 }
 
+type SeasonJSON struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind" enums:"weekly,monthly,quarterly"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+}
+
+type AwardJSON struct {
+	Award      string    `json:"award"`
+	EmblemText string    `json:"emblem_text"`
+	AwardedAt  time.Time `json:"awarded_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Expired    bool      `json:"expired"`
+}
+
+type AchievementJSON struct {
+	Key         string               `json:"key"`
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	Stat        string               `json:"stat"`
+	Mode        types.GameMode       `json:"mode"`
+	ModeString  types.GameModeString `json:"mode_string"`
+	Threshold   uint64               `json:"threshold"`
+}
+
+type AchievementProgressJSON struct {
+	AchievementJSON
+	Value      uint64     `json:"value"`
+	Unlocked   bool       `json:"unlocked"`
+	UnlockedAt *time.Time `json:"unlocked_at,omitempty"`
+}
+
 type GamePlayedJSON struct {
 	GameID          uint   `json:"game_id"`
 	GameName        string `json:"game_name"`
@@ -281,6 +316,23 @@ type GamePlayedJSON struct {
 	Deaths    uint32    `json:"deaths"`
 }
 
+type PlaySessionJSON struct {
+	LobbyID   uint       `json:"lobby_id"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Seconds   int64      `json:"seconds"`
+	Online    bool       `json:"online"`
+}
+
+type PlayTimeJSON struct {
+	Sessions int64 `json:"sessions"`
+	// Seconds includes the time so far of the sessions that are still open
+	Seconds   int64     `json:"seconds"`
+	Online    bool      `json:"online"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
 type NewsJSON struct {
 	ID        uint      `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
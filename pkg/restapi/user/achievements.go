@@ -0,0 +1,63 @@
+package user
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"tx55/pkg/metalgearonline1/achievements"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelNone, "GET", "/achievements/list", getAchievementsList)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/user/:user_id/achievements", getUserAchievements)
+}
+
+// getAchievementsList godoc
+// @Summary      List Achievements
+// @Description  Lists every achievement that can be unlocked. An achievement unlocks once the all-time total of its stat reaches the threshold, either in a single mode or across every mode when the mode is overall.
+// @Tags         Achievements
+// @Produce      json
+// @Success      200  {object}  restapi.ResponseJSON{data=[]restapi.AchievementJSON{}}
+// @Router       /achievements/list [get]
+func getAchievementsList(c *gin.Context) {
+	out := make([]restapi.AchievementJSON, len(achievements.All))
+	for i, a := range achievements.All {
+		out[i] = restapi.ToAchievementJSON(a)
+	}
+	restapi.Success(c, out)
+}
+
+// getUserAchievements godoc
+// @Summary      Retrieve a user's achievement progress
+// @Description  Retrieves every achievement along with the user's current value for it and when it was unlocked
+// @Tags         Achievements
+// @Produce      json
+// @Param        user_id  path  int  true  "User ID"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]restapi.AchievementProgressJSON{}}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /user/{user_id}/achievements [get]
+func getUserAchievements(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	uid := restapi.ParamAsUint(c, "user_id", 0)
+	if uid == 0 {
+		restapi.Error(c, 400, "Invalid user id")
+		return
+	}
+
+	progress, err := achievements.UserProgress(db, uid)
+	if err != nil {
+		l.WithError(err).WithField("user_id", uid).Error("Failed to retrieve user achievements")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	out := make([]restapi.AchievementProgressJSON, len(progress))
+	for i, p := range progress {
+		out[i] = restapi.ToAchievementProgressJSON(p)
+	}
+	restapi.Success(c, out)
+}
@@ -0,0 +1,51 @@
+package user
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelNone, "GET", "/user/:user_id/awards", getUserAwards)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/user/:user_id/awards/:page", getUserAwards)
+}
+
+// getUserAwards godoc
+// @Summary      Retrieve awards a user has won
+// @Description  Retrieves the history of awards given to a user, newest first. Expired awards are included.
+// @Tags         GameUser
+// @Produce      json
+// @Param        user_id  path  int  true   "User ID"
+// @Param        page     path  int  false  "Page"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]restapi.AwardJSON{}}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /user/{user_id}/awards/{page} [get]
+func getUserAwards(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+	limit := 50
+
+	uid := restapi.ParamAsUint(c, "user_id", 0)
+	if uid == 0 {
+		restapi.Error(c, 400, "Invalid user id")
+		return
+	}
+	page := restapi.ParamAsInt(c, "page", 1)
+
+	var awards []models.AwardHistory
+	if err := db.Where("user_id = ?", uid).Order("created_at desc").Limit(limit).Offset((page - 1) * limit).Find(&awards).Error; err != nil {
+		l.WithError(err).WithField("user_id", uid).Error("Failed to retrieve user awards")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	out := make([]restapi.AwardJSON, len(awards))
+	for i, award := range awards {
+		out[i] = restapi.ToAwardJSON(award)
+	}
+	restapi.Success(c, out)
+}
@@ -0,0 +1,98 @@
+package user
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"strconv"
+	schema "tx55/pkg/events"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+	"tx55/pkg/restapi/events"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelNone, "GET", "/events", getEventHistory)
+}
+
+type EventHistoryJSON struct {
+	Events []schema.Envelope `json:"events"`
+	// Next is the since or before value of the next page, 0 when there are no more events
+	Next uint `json:"next"`
+}
+
+// getEventHistory godoc
+// @Summary      Event History
+// @Description  Pages through the events the event stream has sent, filtered like the stream itself. With `since` the
+// @Description  events after that stream id are returned oldest first, so a feed can catch up on what it missed.
+// @Description  Otherwise the newest events are returned first, and `before` pages back from a stream id. Events are
+// @Description  only kept for the configured number of days.
+// @Tags         Events
+// @Produce      json
+// @Param        type     query  string  false  "Event types, comma separated"
+// @Param        lobby    query  string  false  "Lobby IDs, comma separated"
+// @Param        game_id  query  string  false  "Game IDs, comma separated"
+// @Param        user_id  query  string  false  "User IDs, comma separated"
+// @Param        since    query  int     false  "Only events after this stream id, oldest first"
+// @Param        before   query  int     false  "Only events before this stream id, newest first"
+// @Param        limit    query  int     false  "Events per page, 50 by default and at most 500"
+// @Success      200  {object}  restapi.ResponseJSON{data=EventHistoryJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /events [get]
+func getEventHistory(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	filter, err := events.ParseFilter(c)
+	if err != nil {
+		restapi.Error(c, 400, err.Error())
+		return
+	}
+	var since, before uint64
+	if v := c.Query("since"); v != "" {
+		if since, err = strconv.ParseUint(v, 10, 0); err != nil {
+			restapi.Error(c, 400, "invalid since")
+			return
+		}
+	}
+	if v := c.Query("before"); v != "" {
+		if before, err = strconv.ParseUint(v, 10, 0); err != nil {
+			restapi.Error(c, 400, "invalid before")
+			return
+		}
+	}
+	limit := events.DefaultHistoryLimit
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > events.MaxHistoryLimit {
+			restapi.Error(c, 400, "invalid limit")
+			return
+		}
+	}
+
+	q := filter.Apply(db.Model(&models.StreamEvent{}))
+	if since > 0 {
+		q = q.Where("id > ?", since).Order("id")
+	} else {
+		q = q.Order("id desc")
+	}
+	if before > 0 {
+		q = q.Where("id < ?", before)
+	}
+
+	var rows []models.StreamEvent
+	if err = q.Limit(limit).Find(&rows).Error; err != nil {
+		l.WithError(err).Error("Error getting event history")
+		restapi.Error(c, 500, "Error getting event history")
+		return
+	}
+
+	out := EventHistoryJSON{Events: make([]schema.Envelope, len(rows))}
+	for i, row := range rows {
+		out.Events[i] = events.ToEnvelope(row)
+	}
+	if len(rows) == limit {
+		out.Next = rows[len(rows)-1].ID
+	}
+	restapi.Success(c, out)
+}
@@ -6,10 +6,12 @@ import (
 	"gorm.io/gorm"
 	"tx55/pkg/metalgearonline1/models"
 	"tx55/pkg/restapi"
+	"tx55/pkg/restapi/events"
 )
 
 func init() {
 	restapi.Register(restapi.AuthLevelNone, "GET", "/games/list", getGamesList)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/games/live", getLiveGames)
 	restapi.Register(restapi.AuthLevelNone, "GET", "/games/:game_id", getGame)
 }
 
@@ -81,3 +83,22 @@ func getGamesList(c *gin.Context) {
 	}
 
 }
+
+// getLiveGames godoc
+// @Summary      Retrieve the running games as they happen
+// @Description  Retrieves the running games built from the event stream, with the current round's map, mode and
+// @Description  elapsed time, the timeline of rounds played so far and the team rosters with how long each player has
+// @Description  been on their team. The same games are streamed as they change by the /games/live/ws websocket.
+// @Tags         Games
+// @Produce      json
+// @Success      200  {object}  restapi.ResponseJSON{data=[]events.LiveGameJSON{}}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Router       /games/live [get]
+func getLiveGames(c *gin.Context) {
+	s, _ := c.MustGet("events").(*events.Service)
+	if s == nil {
+		restapi.Error(c, 404, "Live games need the events service")
+		return
+	}
+	restapi.Success(c, s.Live.Games())
+}
@@ -0,0 +1,141 @@
+package user
+
+import (
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelUser, "GET", "/user/game_sessions", getGameSessions)
+	restapi.Register(restapi.AuthLevelUser, "POST", "/user/game_sessions/revoke_all", revokeAllGameSessions)
+	restapi.Register(restapi.AuthLevelUser, "POST", "/user/game_sessions/:id/revoke", revokeGameSession)
+}
+
+type GameSessionJSON struct {
+	// ID is a handle for revoking the session, the session id itself is a credential and is never shown
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	LastIP     string    `json:"last_ip"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type RevokedJSON struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// getGameSessions godoc
+// @Summary      List Game Sessions
+// @Description  Lists the sessions the game was given when logging into the currently logged in user, most recently
+// @Description  used first. Each session is extended whenever the game uses it and expires when it goes unused.
+// @Tags         GameUserLogin
+// @Produce      json
+// @Success      200  {object}  restapi.ResponseJSON{data=[]GameSessionJSON}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /user/game_sessions [get]
+// @Security ApiKeyAuth
+func getGameSessions(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := sessions.Default(c).Get("user_id").(uint)
+
+	var rows []models.Session
+	if err := db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).Order("last_used_at desc").Find(&rows).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting game sessions")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	out := make([]GameSessionJSON, len(rows))
+	for i, row := range rows {
+		out[i] = GameSessionJSON{
+			ID:         row.Handle(),
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: row.LastUsedAt,
+			LastIP:     row.LastIP,
+			ExpiresAt:  row.ExpiresAt,
+		}
+	}
+	restapi.Success(c, out)
+}
+
+// revokeGameSession godoc
+// @Summary      Revoke Game Session
+// @Description  Revokes one of the currently logged in user's game sessions, the game has to log in with the password
+// @Description  again. A game that is already connected stays connected until it disconnects.
+// @Tags         GameUserLogin
+// @Produce      json
+// @Param        id  path  string  true  "Session handle from the session list"
+// @Success      200  {object}  restapi.ResponseJSON{data=RevokedJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /user/game_sessions/{id}/revoke [post]
+// @Security ApiKeyAuth
+func revokeGameSession(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := sessions.Default(c).Get("user_id").(uint)
+
+	handle := c.Param("id")
+	if len(handle) != 16 {
+		restapi.Error(c, 400, "Invalid session handle")
+		return
+	}
+
+	var rows []models.Session
+	if err := db.Select("id").Where("user_id = ?", userID).Find(&rows).Error; err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error getting game sessions")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+	var ids []uuid.UUID
+	for _, row := range rows {
+		if row.Handle() == handle {
+			ids = append(ids, row.ID)
+		}
+	}
+	if len(ids) == 0 {
+		restapi.Error(c, 404, "Session not found")
+		return
+	}
+
+	tx := db.Where("id IN ? AND user_id = ?", ids, userID).Delete(&models.Session{})
+	if tx.Error != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(tx.Error).Error("Error revoking game session")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+	if tx.RowsAffected == 0 {
+		restapi.Error(c, 404, "Session not found")
+		return
+	}
+	restapi.Success(c, RevokedJSON{Revoked: tx.RowsAffected})
+}
+
+// revokeAllGameSessions godoc
+// @Summary      Revoke All Game Sessions
+// @Description  Revokes every game session of the currently logged in user, the game has to log in with the password
+// @Description  again. A game that is already connected stays connected until it disconnects.
+// @Tags         GameUserLogin
+// @Produce      json
+// @Success      200  {object}  restapi.ResponseJSON{data=RevokedJSON}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /user/game_sessions/revoke_all [post]
+// @Security ApiKeyAuth
+func revokeAllGameSessions(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	userID := sessions.Default(c).Get("user_id").(uint)
+
+	revoked, err := models.RevokeUserSessions(db, userID)
+	if err != nil {
+		c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error revoking game sessions")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+	restapi.Success(c, RevokedJSON{Revoked: revoked})
+}
@@ -0,0 +1,90 @@
+package user
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelNone, "GET", "/user/:user_id/sessions", getUserPlaySessions)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/user/:user_id/sessions/:page", getUserPlaySessions)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/user/:user_id/playtime", getUserPlayTime)
+}
+
+// getUserPlaySessions godoc
+// @Summary      Online history of a user
+// @Description  Lists when a user was logged into the lobbies, newest first. Sessions that are still open have no
+// @Description  ended_at and their seconds are the time so far. An open session whose lobby stopped responding isn't
+// @Description  online and only counts up to when it was last seen alive.
+// @Tags         GameUser
+// @Produce      json
+// @Param        user_id  path  int  true   "User ID"
+// @Param        page     path  int  false  "Page"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]restapi.PlaySessionJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /user/{user_id}/sessions/{page} [get]
+func getUserPlaySessions(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+	limit := 50
+
+	uid := restapi.ParamAsUint(c, "user_id", 0)
+	if uid == 0 {
+		restapi.Error(c, 400, "Invalid user id")
+		return
+	}
+	page := restapi.ParamAsInt(c, "page", 1)
+
+	var sessions []models.PlaySession
+	if err := db.Where("user_id = ?", uid).Order("started_at desc").Limit(limit).Offset((page - 1) * limit).Find(&sessions).Error; err != nil {
+		l.WithError(err).Error("Error getting user's play sessions")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	out := make([]restapi.PlaySessionJSON, len(sessions))
+	for i, s := range sessions {
+		out[i] = restapi.ToPlaySessionJSON(s)
+	}
+	restapi.Success(c, out)
+}
+
+// getUserPlayTime godoc
+// @Summary      Total time online of a user
+// @Description  Totals the sessions and time a user has been logged into the lobbies, including any session still open
+// @Description  up to when its lobby last marked it alive
+// @Tags         GameUser
+// @Produce      json
+// @Param        user_id  path  int  true  "User ID"
+// @Success      200  {object}  restapi.ResponseJSON{data=restapi.PlayTimeJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /user/{user_id}/playtime [get]
+func getUserPlayTime(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	uid := restapi.ParamAsUint(c, "user_id", 0)
+	if uid == 0 {
+		restapi.Error(c, 400, "Invalid user id")
+		return
+	}
+
+	total, err := models.UserPlayTime(db, uid, models.DefaultPlaySessionStaleAfter)
+	if err != nil {
+		l.WithError(err).Error("Error getting user's play time")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+	restapi.Success(c, restapi.PlayTimeJSON{
+		Sessions:  total.Sessions,
+		Seconds:   total.Seconds,
+		Online:    total.Online,
+		FirstSeen: total.FirstSeen,
+		LastSeen:  total.LastSeen,
+	})
+}
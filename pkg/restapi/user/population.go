@@ -0,0 +1,272 @@
+package user
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"sort"
+	"strconv"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelNone, "GET", "/population/hourly", getPopulationHourly)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/population/daily", getPopulationDaily)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/population/peak", getPopulationPeak)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/population/popularity", getPopularity)
+}
+
+const (
+	day = 24 * time.Hour
+	// maxHourlyRange and maxDailyRange limit how many samples a single request reads
+	maxHourlyRange = 31 * day
+	maxDailyRange  = 366 * day
+)
+
+type PopulationBucketJSON struct {
+	Start       time.Time `json:"start"`
+	Samples     int       `json:"samples"`
+	AvgPlayers  float64   `json:"avg_players"`
+	PeakPlayers uint      `json:"peak_players"`
+	AvgGames    float64   `json:"avg_games"`
+	PeakGames   uint      `json:"peak_games"`
+}
+
+type PopulationPeakJSON struct {
+	Players   uint       `json:"players"`
+	PlayersAt *time.Time `json:"players_at"`
+	Games     uint       `json:"games"`
+	GamesAt   *time.Time `json:"games_at"`
+	Samples   int        `json:"samples"`
+}
+
+type PopularityJSON struct {
+	Mode string `json:"mode,omitempty"`
+	Map  string `json:"map,omitempty"`
+	// Games is the number of games seen playing it summed over every sample
+	Games   uint `json:"games"`
+	Players uint `json:"players"`
+	// Share is the fraction of all the sampled games
+	Share float64 `json:"share"`
+}
+
+type PopularityReportJSON struct {
+	Modes  []PopularityJSON `json:"modes"`
+	Maps   []PopularityJSON `json:"maps"`
+	Rounds []PopularityJSON `json:"rounds"`
+}
+
+// populationRange reads the from, to and lobby_id query parameters, the range ends now and spans span by default. It
+// writes the error response and returns false if the range is invalid or longer than limit.
+func populationRange(c *gin.Context, span time.Duration, limit time.Duration) (from time.Time, to time.Time, lobbyID uint, ok bool) {
+	var err error
+	if v := c.Query("lobby_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			restapi.Error(c, 400, "invalid lobby_id")
+			return
+		}
+		lobbyID = uint(id)
+	}
+	to = time.Now()
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			restapi.Error(c, 400, "invalid to, expected an RFC 3339 time")
+			return
+		}
+	}
+	from = to.Add(-span)
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			restapi.Error(c, 400, "invalid from, expected an RFC 3339 time")
+			return
+		}
+	}
+	if !from.Before(to) {
+		restapi.Error(c, 400, "from must be before to")
+		return
+	}
+	if to.Sub(from) > limit {
+		restapi.Error(c, 400, "the range is too long")
+		return
+	}
+	return from, to, lobbyID, true
+}
+
+func populationBuckets(c *gin.Context, size time.Duration, span time.Duration, limit time.Duration) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	from, to, lobbyID, ok := populationRange(c, span, limit)
+	if !ok {
+		return
+	}
+	totals, err := models.PopulationTotals(db, from, to, lobbyID)
+	if err != nil {
+		l.WithError(err).Error("Error getting population samples")
+		restapi.Error(c, 500, "Error getting population samples")
+		return
+	}
+
+	buckets := models.BucketPopulation(totals, size)
+	out := make([]PopulationBucketJSON, len(buckets))
+	for i, b := range buckets {
+		out[i] = PopulationBucketJSON(b)
+	}
+	restapi.Success(c, out)
+}
+
+// getPopulationHourly godoc
+// @Summary      Hourly population
+// @Description  Averages and peaks of the players online and games running for each hour (UTC) with samples, oldest
+// @Description  first. The range defaults to the last day and can be at most 31 days.
+// @Tags         Population
+// @Produce      json
+// @Param        from      query  string  false  "Start of the range, RFC 3339"
+// @Param        to        query  string  false  "End of the range, RFC 3339, defaults to now"
+// @Param        lobby_id  query  int     false  "Only this lobby"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]PopulationBucketJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /population/hourly [get]
+func getPopulationHourly(c *gin.Context) {
+	populationBuckets(c, time.Hour, day, maxHourlyRange)
+}
+
+// getPopulationDaily godoc
+// @Summary      Daily population
+// @Description  Averages and peaks of the players online and games running for each day (UTC) with samples, oldest
+// @Description  first. The range defaults to the last 30 days and can be at most 366 days.
+// @Tags         Population
+// @Produce      json
+// @Param        from      query  string  false  "Start of the range, RFC 3339"
+// @Param        to        query  string  false  "End of the range, RFC 3339, defaults to now"
+// @Param        lobby_id  query  int     false  "Only this lobby"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]PopulationBucketJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /population/daily [get]
+func getPopulationDaily(c *gin.Context) {
+	populationBuckets(c, day, 30*day, maxDailyRange)
+}
+
+// getPopulationPeak godoc
+// @Summary      Peak concurrency
+// @Description  The most players online and games running at once, and when they were first sampled. The range
+// @Description  defaults to the last 30 days and can be at most 366 days.
+// @Tags         Population
+// @Produce      json
+// @Param        from      query  string  false  "Start of the range, RFC 3339"
+// @Param        to        query  string  false  "End of the range, RFC 3339, defaults to now"
+// @Param        lobby_id  query  int     false  "Only this lobby"
+// @Success      200  {object}  restapi.ResponseJSON{data=PopulationPeakJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /population/peak [get]
+func getPopulationPeak(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	from, to, lobbyID, ok := populationRange(c, 30*day, maxDailyRange)
+	if !ok {
+		return
+	}
+	totals, err := models.PopulationTotals(db, from, to, lobbyID)
+	if err != nil {
+		l.WithError(err).Error("Error getting population samples")
+		restapi.Error(c, 500, "Error getting population samples")
+		return
+	}
+
+	out := PopulationPeakJSON{Samples: len(totals)}
+	for i, t := range totals {
+		if out.PlayersAt == nil || t.Players > out.Players {
+			out.Players = t.Players
+			out.PlayersAt = &totals[i].SampledAt
+		}
+		if out.GamesAt == nil || t.Games > out.Games {
+			out.Games = t.Games
+			out.GamesAt = &totals[i].SampledAt
+		}
+	}
+	restapi.Success(c, out)
+}
+
+// getPopularity godoc
+// @Summary      Mode and map popularity
+// @Description  How often each mode, map and mode and map pair was being played, most played first. Each game counts
+// @Description  once for every sample it was running in, so longer rounds count for more. The range defaults to the
+// @Description  last 30 days and can be at most 366 days.
+// @Tags         Population
+// @Produce      json
+// @Param        from      query  string  false  "Start of the range, RFC 3339"
+// @Param        to        query  string  false  "End of the range, RFC 3339, defaults to now"
+// @Param        lobby_id  query  int     false  "Only this lobby"
+// @Success      200  {object}  restapi.ResponseJSON{data=PopularityReportJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /population/popularity [get]
+func getPopularity(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+
+	from, to, lobbyID, ok := populationRange(c, 30*day, maxDailyRange)
+	if !ok {
+		return
+	}
+	rounds, err := models.RoundPopularity(db, from, to, lobbyID)
+	if err != nil {
+		l.WithError(err).Error("Error getting population samples")
+		restapi.Error(c, 500, "Error getting population samples")
+		return
+	}
+
+	var total uint
+	modes := make(map[string]*PopularityJSON)
+	maps := make(map[string]*PopularityJSON)
+	out := PopularityReportJSON{Rounds: make([]PopularityJSON, len(rounds))}
+	for i, r := range rounds {
+		total += r.Games
+		out.Rounds[i] = PopularityJSON{Mode: r.Mode, Map: r.Map, Games: r.Games, Players: r.Players}
+		if modes[r.Mode] == nil {
+			modes[r.Mode] = &PopularityJSON{Mode: r.Mode}
+		}
+		modes[r.Mode].Games += r.Games
+		modes[r.Mode].Players += r.Players
+		if maps[r.Map] == nil {
+			maps[r.Map] = &PopularityJSON{Map: r.Map}
+		}
+		maps[r.Map].Games += r.Games
+		maps[r.Map].Players += r.Players
+	}
+	out.Modes = sortPopularity(modes, total)
+	out.Maps = sortPopularity(maps, total)
+	for i := range out.Rounds {
+		out.Rounds[i].Share = share(out.Rounds[i].Games, total)
+	}
+	restapi.Success(c, out)
+}
+
+func sortPopularity(in map[string]*PopularityJSON, total uint) []PopularityJSON {
+	out := make([]PopularityJSON, 0, len(in))
+	for _, p := range in {
+		p.Share = share(p.Games, total)
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Games != out[j].Games {
+			return out[i].Games > out[j].Games
+		}
+		return out[i].Mode+out[i].Map < out[j].Mode+out[j].Map
+	})
+	return out
+}
+
+func share(games uint, total uint) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(games) / float64(total)
+}
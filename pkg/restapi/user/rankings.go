@@ -16,7 +16,7 @@ func init() {
 // getRankings godoc
 // @Summary      Retrieve Player Rankings
 // @Description  Retrieves top players for a particular time-period and game-mode
-// @Description   - Period: all-time, weekly, archive
+// @Description   - Period: all-time, weekly. Archived rankings are available per season from /seasons
 // @Description   - Mode: Should be a game-mode (like cap, tdm, dm, etc.) or "all"
 // @Tags         Rankings
 // @Produce      json
@@ -40,6 +40,11 @@ func getRankings(c *gin.Context) {
 		return
 	}
 
+	if period == types.PeriodArchive {
+		restapi.Error(c, 400, "Archived rankings are listed per season under /seasons/{season_id}/rankings")
+		return
+	}
+
 	page := restapi.ParamAsInt(c, "page", 1)
 	gameMode := types.ModeOverall
 
@@ -64,9 +69,6 @@ func getRankings(c *gin.Context) {
 			query = `SELECT weekly_rank as ` + "`rank`" + `, id as user_id, t.points, display_name FROM users
 					INNER JOIN (SELECT user_id, SUM(points) as points FROM player_stats WHERE period = ? GROUP BY user_id) t ON users.id = t.user_id
 					WHERE users.weekly_rank > 0 ORDER BY users.weekly_rank ASC LIMIT ? OFFSET ?`
-		case types.PeriodArchive:
-			restapi.Error(c, 400, "Cannot get overall ranking from archive")
-			return
 		}
 		if err := db.Raw(query, period, limit, (page-1)*limit).Scan(&rankings).Error; err != nil {
 			restapi.Error(c, 500, "Database error")
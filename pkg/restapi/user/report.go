@@ -0,0 +1,115 @@
+package user
+
+import (
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelUser, "POST", "/user/report", ReportUser)
+}
+
+// MaxReportsPerDay limits how many reports a single user can send
+const MaxReportsPerDay = 10
+
+type ArgsReportUser struct {
+	UserID uint `json:"user_id" binding:"required"`
+	// GameID is optional, both users must have played in the game
+	GameID   uint   `json:"game_id"`
+	Category string `json:"category" binding:"required" enums:"cheating,harassment,offensive_name,griefing,other"`
+	Body     string `json:"body" binding:"required,max=1000"`
+}
+
+type ReportCreatedJSON struct {
+	ID uint `json:"id"`
+}
+
+// ReportUser godoc
+// @Summary      Report a player
+// @Description  Reports another player to the admins. Only one report per player can be open at a time, and a user
+// @Description  can send at most 10 reports a day.
+// @Tags         GameUserLogin
+// @Accept       json
+// @Produce      json
+// @Param        body  body  ArgsReportUser  true  "Report"
+// @Success      200  {object}  restapi.ResponseJSON{data=ReportCreatedJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      429  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /user/report [post]
+// @Security ApiKeyAuth
+func ReportUser(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+	uid := sessions.Default(c).Get("user_id").(uint)
+
+	var args ArgsReportUser
+	if err := c.ShouldBindJSON(&args); err != nil {
+		restapi.Error(c, 400, err.Error())
+		return
+	}
+
+	category := models.ReportCategory(args.Category)
+	if !category.Valid() {
+		restapi.Error(c, 400, "Invalid category")
+		return
+	}
+	if args.UserID == uid {
+		restapi.Error(c, 400, "You can't report yourself")
+		return
+	}
+
+	var target models.User
+	if err := db.First(&target, args.UserID).Error; err != nil {
+		restapi.Error(c, 404, "User not found")
+		return
+	}
+
+	if args.GameID != 0 {
+		var players int64
+		if err := db.Model(&models.GamePlayers{}).Unscoped().
+			Where("game_id = ? AND user_id IN ?", args.GameID, []uint{uid, args.UserID}).
+			Distinct("user_id").Count(&players).Error; err != nil {
+			l.WithError(err).Error("Failed to check game players")
+			restapi.Error(c, 500, "Database error")
+			return
+		}
+		if players != 2 {
+			restapi.Error(c, 400, "You and the reported player must have played in the game")
+			return
+		}
+	}
+
+	var open, recent int64
+	db.Model(&models.PlayerReport{}).Where("reporter_id = ? AND target_id = ? AND status = ?", uid, args.UserID, models.ReportOpen).Count(&open)
+	if open > 0 {
+		restapi.Error(c, 400, "You already have an open report for this player")
+		return
+	}
+	db.Model(&models.PlayerReport{}).Where("reporter_id = ? AND created_at > ?", uid, time.Now().Add(-24*time.Hour)).Count(&recent)
+	if recent >= MaxReportsPerDay {
+		restapi.Error(c, 429, "Too many reports, try again later")
+		return
+	}
+
+	report := models.PlayerReport{
+		ReporterID: uid,
+		TargetID:   args.UserID,
+		GameID:     args.GameID,
+		Category:   category,
+		Body:       args.Body,
+		Status:     models.ReportOpen,
+	}
+	if err := db.Create(&report).Error; err != nil {
+		l.WithError(err).WithField("user_id", uid).Error("Failed to create report")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+	restapi.Success(c, ReportCreatedJSON{ID: report.ID})
+}
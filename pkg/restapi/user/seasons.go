@@ -0,0 +1,156 @@
+package user
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/metalgearonline1/types"
+	"tx55/pkg/restapi"
+)
+
+func init() {
+	restapi.Register(restapi.AuthLevelNone, "GET", "/seasons/list", getSeasonsList)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/seasons/list/:page", getSeasonsList)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/seasons/:season_id/rankings", getSeasonRankings)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/seasons/:season_id/rankings/:page", getSeasonRankings)
+	restapi.Register(restapi.AuthLevelNone, "GET", "/user/:user_id/seasons/:season_id/stats", getUserSeasonStats)
+}
+
+// getSeasonsList godoc
+// @Summary      List Seasons
+// @Description  Lists finished seasons, newest first. Every week is archived as a season, longer seasons are built from the weeks in them.
+// @Tags         Rankings
+// @Produce      json
+// @Param        page  path   int     false  "Page"
+// @Param        kind  query  string  false  "Only seasons of this kind" Enums(weekly, monthly, quarterly)
+// @Success      200  {object}  restapi.ResponseJSON{data=[]restapi.SeasonJSON{}}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /seasons/list/{page} [get]
+func getSeasonsList(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+
+	q := db.Order("ended_at desc")
+	if kindParam := c.Query("kind"); kindParam != "" {
+		kind := models.SeasonKindFromString(kindParam)
+		if kind == models.SeasonInvalid {
+			restapi.Error(c, 400, "Invalid kind")
+			return
+		}
+		q = q.Where("kind = ?", kind)
+	}
+
+	var seasons []models.Season
+	if err := q.Limit(limit).Offset((page - 1) * limit).Find(&seasons).Error; err != nil {
+		restapi.Error(c, 500, "Database error")
+		l.WithError(err).Error("Error getting seasons")
+		return
+	}
+
+	out := make([]restapi.SeasonJSON, len(seasons))
+	for i, season := range seasons {
+		out[i] = restapi.ToSeasonJSON(season)
+	}
+	restapi.Success(c, out)
+}
+
+// getSeasonRankings godoc
+// @Summary      Retrieve Season Rankings
+// @Description  Retrieves the final rankings of a season. Mode rankings use the rank stored when the season was archived, the overall ranking is ordered by total points.
+// @Tags         Rankings
+// @Produce      json
+// @Param        season_id  path   int                   true   "Season ID"
+// @Param        page       path   int                   false  "Page"
+// @Param        mode       query  types.GameModeString  false  "Game Mode"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]restapi.RankingEntryJSON{}}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      404  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /seasons/{season_id}/rankings/{page} [get]
+func getSeasonRankings(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+	limit := 50
+	page := restapi.ParamAsInt(c, "page", 1)
+
+	seasonID := restapi.ParamAsUint(c, "season_id", 0)
+	if seasonID == 0 {
+		restapi.Error(c, 400, "Invalid season id")
+		return
+	}
+
+	gameMode := types.ModeOverall
+	if modeParam := c.Query("mode"); modeParam != "" {
+		gameMode = types.GameModeString(modeParam).GameMode()
+		if gameMode == types.ModeInvalid {
+			restapi.Error(c, 400, "Invalid mode")
+			return
+		}
+	}
+
+	var season models.Season
+	if err := db.First(&season, seasonID).Error; err != nil {
+		restapi.Error(c, 404, "Season not found")
+		return
+	}
+
+	rankings := make([]restapi.RankingEntryJSON, 0, limit)
+	if gameMode == types.ModeOverall {
+		query := "SELECT user_id, u.display_name, SUM(points) as points FROM player_stats INNER JOIN users u ON u.id = player_stats.user_id WHERE period = ? AND season_id = ? GROUP BY user_id, u.display_name ORDER BY points DESC, user_id LIMIT ? OFFSET ?"
+		if err := db.Raw(query, types.PeriodArchive, season.ID, limit, (page-1)*limit).Scan(&rankings).Error; err != nil {
+			restapi.Error(c, 500, "Database error")
+			l.WithError(err).Error("Error getting overall season rankings")
+			return
+		}
+		for i := range rankings {
+			rankings[i].Rank = uint((page-1)*limit + i + 1)
+		}
+	} else {
+		query := "SELECT `rank`, user_id, u.display_name, SUM(points) as points FROM player_stats INNER JOIN users u ON u.id = player_stats.user_id WHERE period = ? AND season_id = ? AND mode = ? GROUP BY user_id ORDER BY `rank` LIMIT ? OFFSET ?"
+		if err := db.Raw(query, types.PeriodArchive, season.ID, gameMode, limit, (page-1)*limit).Scan(&rankings).Error; err != nil {
+			restapi.Error(c, 500, "Database error")
+			l.WithError(err).Error("Error getting mode season rankings")
+			return
+		}
+	}
+	restapi.Success(c, rankings)
+}
+
+// getUserSeasonStats godoc
+// @Summary      Retrieve a user's stats for a season
+// @Description  Retrieves the archived stats of a user for a finished season, split up by game mode and map.
+// @Tags         GameUser
+// @Produce      json
+// @Param        user_id    path  int  true  "User ID"
+// @Param        season_id  path  int  true  "Season ID"
+// @Success      200  {object}  restapi.ResponseJSON{data=[]restapi.PlayerStatsJSON}
+// @Failure      400  {object}  restapi.ResponseJSON{data=string}
+// @Failure      500  {object}  restapi.ResponseJSON{data=string}
+// @Router       /user/{user_id}/seasons/{season_id}/stats [get]
+func getUserSeasonStats(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	l := c.MustGet("logger").(*logrus.Logger)
+	uid := restapi.ParamAsUint(c, "user_id", 0)
+	seasonID := restapi.ParamAsUint(c, "season_id", 0)
+	if uid == 0 || seasonID == 0 {
+		restapi.Error(c, 400, "Invalid user or season id")
+		return
+	}
+
+	var stats []models.PlayerStats
+	if err := db.Find(&stats, "user_id = ? AND period = ? AND season_id = ?", uid, types.PeriodArchive, seasonID).Error; err != nil {
+		l.WithError(err).WithField("user_id", uid).Error("Failed to retrieve user season stats")
+		restapi.Error(c, 500, "Database error")
+		return
+	}
+
+	out := make([]restapi.PlayerStatsJSON, len(stats))
+	for i, stat := range stats {
+		out[i] = restapi.ToPlayerStatsJSON(stat)
+	}
+	restapi.Success(c, out)
+}
@@ -9,6 +9,7 @@ import (
 	"tx55/pkg/metalgearonline1/types"
 	"tx55/pkg/restapi"
 	"tx55/pkg/restapi/iso8859"
+	"tx55/pkg/restapi/validation"
 )
 
 func init() {
@@ -83,7 +84,7 @@ func whoAmI(c *gin.Context) {
 
 // getUserStats godoc
 // @Summary      Retrieve stats for a user
-// @Description  Retrieves all stats generated by a particular user. Stats are split-up by game mode, map, and period. So a user may not have stats generated for certain combinations yet. But if there is a All-Time stat entry, there will be a matching weekly one, even if it's empty.
+// @Description  Retrieves all stats generated by a particular user. Stats are split-up by game mode, map, and period. So a user may not have stats generated for certain combinations yet. But if there is a All-Time stat entry, there will be a matching weekly one, even if it's empty. Archived season stats are retrieved per season from /user/{user_id}/seasons/{season_id}/stats
 // @Tags         GameUser
 // @Produce      json
 // @Param        user_id  path  int  true  "User ID"
@@ -100,7 +101,7 @@ func getUserStats(c *gin.Context) {
 		return
 	}
 	var stats []models.PlayerStats
-	if err := db.Find(&stats, "user_id = ?", uid).Error; err != nil {
+	if err := db.Find(&stats, "user_id = ? AND period != ?", uid, types.PeriodArchive).Error; err != nil {
 		if err != gorm.ErrRecordNotFound {
 			logger.WithError(err).WithField("user_id", uid).Error("Failed to retrieve user stats")
 		}
@@ -215,28 +216,16 @@ func UpdateUserProfile(c *gin.Context) {
 	user.ID = session.Get("user_id").(uint)
 
 	if args.DisplayName != "" {
-		if bs, err := iso8859.EncodeAsBytes(args.DisplayName); err != nil {
-			restapi.Error(c, 400, "Display name contains characters that can't be typed in-game")
+		bs, err := c.MustGet("validation").(*validation.Rules).DisplayName(db, user.ID, args.DisplayName)
+		if !validationOK(c, err) {
 			return
-		} else {
-			if len(bs) > 16 {
-				restapi.Error(c, 400, "Display name too long")
-				return
-			}
-			user.DisplayName = bs
 		}
+		user.DisplayName = bs
 	}
 
 	if args.Password != "" {
-		newPassword, err := iso8859.Encode(args.Password)
-		if err != nil {
-			restapi.Error(c, 400, "New Password contains characters that can't be typed in-game")
-			return
-		}
-
-		if len(newPassword) < 3 {
-			// Game will silently fail on this
-			restapi.Error(c, 400, "Password too short")
+		newPassword, err := validation.EncodePassword(args.Password)
+		if !validationOK(c, err) {
 			return
 		}
 
@@ -268,9 +257,30 @@ func UpdateUserProfile(c *gin.Context) {
 		restapi.Error(c, 500, "Database error")
 		return
 	}
+
+	// Anyone who learned the old password may have logged in with it, so the game has to log in again
+	if args.Password != "" {
+		if _, err := models.RevokeUserSessions(db, user.ID); err != nil {
+			c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error revoking sessions")
+		}
+	}
 	restapi.Success(c, nil)
 }
 
+// validationOK responds with the error from the validation package, if there is one
+func validationOK(c *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	if _, ok := err.(validation.Error); ok {
+		restapi.Error(c, 400, err.Error())
+		return false
+	}
+	c.MustGet("logger").(*logrus.Logger).WithError(err).Error("Error validating profile")
+	restapi.Error(c, 500, "Database error")
+	return false
+}
+
 func stringToOrientation(s string) types.SwitchOrientation {
 	switch s {
 	case types.CameraOrientation.String():
@@ -0,0 +1,175 @@
+package validation
+
+import (
+	"bytes"
+	"gorm.io/gorm"
+	"time"
+	"tx55/pkg/configurations"
+	"tx55/pkg/metalgearonline1/models"
+	"tx55/pkg/restapi/iso8859"
+)
+
+const (
+	// MaxNameLength is the size of the name fields in the game's packets
+	MaxNameLength = 16
+	// MinPasswordLength is the shortest password the game accepts, it silently fails to log in with shorter ones
+	MinPasswordLength = 3
+	MaxPasswordLength = 16
+)
+
+// DefaultReservedWords are used when the config doesn't list any
+var DefaultReservedWords = []string{"admin", "administrator", "moderator", "mod", "staff", "gm", "system", "server", "savemgo", "konami"}
+
+// Error is a problem with a name or password that can be shown to the player, any other error is from the database
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Rules are the checks shared by everywhere players choose a name or password
+type Rules struct {
+	reserved           [][]byte
+	blocked            [][]byte
+	registrationsPerIP int
+	registrationWindow time.Duration
+}
+
+func NewRules(config configurations.RestAPINames) *Rules {
+	r := &Rules{
+		registrationsPerIP: config.RegistrationsPerIP,
+		registrationWindow: time.Duration(config.RegistrationWindowHours) * time.Hour,
+	}
+	if r.registrationsPerIP == 0 {
+		r.registrationsPerIP = 3
+	}
+	if r.registrationWindow <= 0 {
+		r.registrationWindow = 24 * time.Hour
+	}
+
+	reserved := config.ReservedWords
+	if len(reserved) == 0 {
+		reserved = DefaultReservedWords
+	}
+	r.reserved = skeletons(reserved)
+	r.blocked = skeletons(config.BlockedWords)
+	return r
+}
+
+func skeletons(words []string) (out [][]byte) {
+	for _, word := range words {
+		bs, err := iso8859.EncodeAsBytes(word)
+		if err != nil {
+			continue
+		}
+		if skeleton := models.DisplayNameSkeleton(bs); len(skeleton) > 0 {
+			out = append(out, skeleton)
+		}
+	}
+	return
+}
+
+// EncodeName checks a name can be typed and shown in-game, and returns it encoded as ISO-8859-1. field is used in the
+// error messages.
+func EncodeName(field string, name string) ([]byte, error) {
+	bs, err := iso8859.EncodeAsBytes(name)
+	if err != nil {
+		return nil, Error(field + " contains characters that can't be typed in-game")
+	}
+	if len(bs) == 0 {
+		return nil, Error(field + " is missing")
+	}
+	if len(bs) > MaxNameLength {
+		return nil, Error(field + " too long")
+	}
+	for _, b := range bs {
+		// Control characters, including NUL which ends the name in-game
+		if b < 0x20 || (b >= 0x7F && b < 0xA0) {
+			return nil, Error(field + " contains characters that can't be typed in-game")
+		}
+	}
+	return bs, nil
+}
+
+// EncodePassword checks the password can be typed in-game and returns it encoded as ISO-8859-1
+func EncodePassword(password string) (string, error) {
+	encoded, err := iso8859.Encode(password)
+	if err != nil {
+		return "", Error("Password contains characters that can't be typed in-game")
+	}
+	if len(encoded) < MinPasswordLength {
+		return "", Error("Password too short")
+	}
+	if len(encoded) > MaxPasswordLength {
+		return "", Error("Password too long")
+	}
+	return encoded, nil
+}
+
+// checkWords rejects names made of a reserved word, or containing a blocked one
+func (r *Rules) checkWords(field string, name []byte) error {
+	skeleton := models.DisplayNameSkeleton(name)
+	for _, word := range r.reserved {
+		if bytes.Equal(skeleton, word) {
+			return Error(field + " is reserved")
+		}
+	}
+	for _, word := range r.blocked {
+		if bytes.Contains(skeleton, word) {
+			return Error(field + " is not allowed")
+		}
+	}
+	return nil
+}
+
+// Username checks a new username and returns it encoded as ISO-8859-1
+func (r *Rules) Username(username string) ([]byte, error) {
+	bs, err := EncodeName("Username", username)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.checkWords("Username", bs); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// DisplayName checks a display name for the user, or a new user when userID is 0, and returns it encoded as
+// ISO-8859-1. Names that look like another player's display name are rejected.
+func (r *Rules) DisplayName(db *gorm.DB, userID uint, displayName string) ([]byte, error) {
+	bs, err := EncodeName("Display name", displayName)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.checkWords("Display name", bs); err != nil {
+		return nil, err
+	}
+
+	skeleton := models.DisplayNameSkeleton(bs)
+	if len(skeleton) == 0 {
+		return bs, nil
+	}
+	var taken int64
+	if err = db.Model(&models.User{}).Where("display_name_skeleton = ? AND id != ?", skeleton, userID).Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, Error("Display name is too similar to another player's")
+	}
+	return bs, nil
+}
+
+// AllowRegistration checks the address hasn't registered too many accounts recently, deleted accounts still count
+func (r *Rules) AllowRegistration(db *gorm.DB, ip string) (bool, error) {
+	if r.registrationsPerIP < 0 || ip == "" {
+		return true, nil
+	}
+	var registrations int64
+	err := db.Unscoped().Model(&models.User{}).
+		Where("registration_ip = ? AND created_at > ?", ip, time.Now().Add(-r.registrationWindow)).
+		Count(&registrations).Error
+	if err != nil {
+		return false, err
+	}
+	return registrations < int64(r.registrationsPerIP), nil
+}
@@ -0,0 +1,46 @@
+package validation
+
+import (
+	"testing"
+	"tx55/pkg/configurations"
+)
+
+func TestEncodeName(t *testing.T) {
+	if bs, err := EncodeName("Name", "Snaké"); err != nil || string(bs) != "Snak\xe9" {
+		t.Errorf("Expected Snaké to be encoded as ISO-8859-1, got %q %v", bs, err)
+	}
+	for _, name := range []string{"", "Snake☺", "Sixteen+OneChars!", "Snake\x00", "Snake\n"} {
+		if _, err := EncodeName("Name", name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+	// The limit is on the encoded length, accented letters are a single byte in-game
+	if _, err := EncodeName("Name", "ÉÉÉÉÉÉÉÉÉÉÉÉÉÉÉÉ"); err != nil {
+		t.Errorf("Expected 16 accented letters to be accepted, got %v", err)
+	}
+}
+
+func TestEncodePassword(t *testing.T) {
+	for _, password := range []string{"ab", "password☺", "seventeen-chars!!"} {
+		if _, err := EncodePassword(password); err == nil {
+			t.Errorf("Expected %q to be rejected", password)
+		}
+	}
+	if _, err := EncodePassword("abc"); err != nil {
+		t.Errorf("Expected a 3 character password to be accepted, got %v", err)
+	}
+}
+
+func TestCheckWords(t *testing.T) {
+	rules := NewRules(configurations.RestAPINames{BlockedWords: []string{"Rude"}})
+	for _, name := range []string{"Admin", "4dm1n", "M o d", "xxRUDExx", "rud3boy"} {
+		if err := rules.checkWords("Name", []byte(name)); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+	for _, name := range []string{"Adminstrator", "Modest", "Snake"} {
+		if err := rules.checkWords("Name", []byte(name)); err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", name, err)
+		}
+	}
+}